@@ -5,7 +5,13 @@ import (
 	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/option"
 
 	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
 	"github.com/masudahiroto/bigquery-mcp-server/internal/mcp"
@@ -15,6 +21,44 @@ func main() {
 	projectID := flag.String("project", "", "Google Cloud project ID for BigQuery client")
 	region := flag.String("region", "", "BigQuery location for jobs")
 	filterStr := flag.String("table-filter", "", "regex to filter table names")
+	formatStr := flag.String("format", "json", "default query result format (json, jsonl, csv, markdown, columnar)")
+	datasetsStr := flag.String("datasets", "", "comma-separated datasets (dataset or project.dataset) published as resources; defaults to all datasets of the project")
+	pollInterval := flag.Duration("poll-interval", 5*time.Minute, "interval for refreshing resources and checking subscribed table schemas (0 disables)")
+	promptsDir := flag.String("prompts-dir", "", "directory with <prompt>.tmpl files overriding the built-in prompts")
+	completionTTL := flag.Duration("completion-ttl", time.Minute, "how long dataset, table and column listings used for completion are cached (0 disables)")
+	metadataCacheTTL := flag.Duration("metadata-cache-ttl", 5*time.Minute, "how long table schemas and listings are cached (0 disables the cache)")
+	metadataCacheSize := flag.Int("metadata-cache-size", 1000, "maximum number of cached schemas and listings")
+	metadataCacheFile := flag.String("metadata-cache-file", "", "file used to persist the metadata cache across restarts")
+	resultCacheTTL := flag.Duration("result-cache-ttl", 0, "how long query results are cached locally (0 disables the cache)")
+	resultCacheSize := flag.Int("result-cache-size", 100, "maximum number of cached query results")
+	resultCacheBytes := flag.Int("result-cache-bytes", 64<<20, "approximate memory limit for cached query results in bytes")
+	lint := flag.Bool("lint", false, "check queries for common mistakes before running them and report warnings")
+	lintReject := flag.String("lint-reject", "", "comma-separated lint rules whose findings reject the query (implies -lint)")
+	lintWideColumns := flag.Int("lint-wide-columns", 30, "column count above which SELECT * on a table is reported")
+	logQueries := flag.Bool("log-queries", false, "log the SQL of every query and dry run")
+	formatLoggedSQL := flag.Bool("log-queries-format", false, "format logged SQL for readability (implies -log-queries)")
+	bqSessions := flag.Bool("bigquery-sessions", false, "run the queries of each MCP session in a BigQuery session so that temporary tables and variables persist across calls")
+	jobLabels := flag.String("job-labels", "", "comma-separated key=value labels attached to every query job")
+	dynamicLabels := flag.Bool("job-labels-dynamic", false, "label query jobs with the tool, MCP session, principal and client name")
+	principalHeader := flag.String("principal-header", "", "HTTP header carrying the authenticated principal used for the mcp_principal label, e.g. X-Goog-Authenticated-User-Email")
+	queryTag := flag.Bool("query-tag", false, "prepend a comment listing the job labels to the SQL of every query job")
+	exportDir := flag.String("export-dir", "", "directory the export tool writes query results to (the tool is disabled when empty)")
+	exportMaxBytes := flag.Int64("export-max-bytes", 1<<30, "maximum size of an exported file in bytes (0 disables)")
+	writeMode := flag.Bool("write-mode", false, "enable the tools that create or modify BigQuery tables")
+	scratchDataset := flag.String("scratch-dataset", "", "dataset (dataset or project.dataset) owned by the server, into which write tools create tables")
+	scratchExpiration := flag.Duration("scratch-table-expiration", 24*time.Hour, "default lifetime of tables created in the scratch dataset (0 keeps them)")
+	loadDir := flag.String("load-dir", "", "directory the load tool reads files from (requires -write-mode and -scratch-dataset)")
+	loadMaxBytes := flag.Int64("load-max-bytes", 100<<20, "maximum size of a loaded file in bytes (0 disables)")
+	loadMaxRows := flag.Int64("load-max-rows", 1000000, "maximum number of rows of a loaded file (0 disables)")
+	redactColumns := flag.String("redact-columns", "", "comma-separated regular expressions of column names or paths whose values are redacted in query, preview and profile results")
+	redactPolicyTags := flag.String("redact-policy-tags", "", "comma-separated regular expressions of policy tag resource names whose columns are redacted")
+	redactValues := flag.String("redact-values", "", "comma-separated detectors of values redacted in any string column: email, phone, credit_card")
+	redactMode := flag.String("redact-mode", "mask", "how redacted values are returned: mask, hash or drop")
+	redactHashKey := flag.String("redact-hash-key", "", "key of the hashes of the hash redaction mode (random per process when empty)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time allowed at shutdown for requests to finish and scratch tables to be dropped")
+	endpoint := flag.String("endpoint", "", "BigQuery API endpoint, e.g. http://localhost:9050 for a local bigquery-emulator")
+	noAuth := flag.Bool("insecure-no-auth", false, "do not authenticate BigQuery requests (for emulators only)")
+	maxResultBytes := flag.Int("max-result-bytes", 64*1024, "approximate response-size budget for query results in bytes (0 disables)")
 	flag.Parse()
 
 	if *projectID == "" || *region == "" {
@@ -22,8 +66,50 @@ func main() {
 	}
 	os.Setenv("BQ_REGION", *region)
 
+	var clientOpts []option.ClientOption
+	if *endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(*endpoint))
+	}
+	if *noAuth {
+		clientOpts = append(clientOpts, option.WithoutAuthentication())
+	}
 	provider := func(ctx context.Context, project string) (bigquery.Client, error) {
-		return bigquery.NewClient(ctx, project)
+		return bigquery.NewClient(ctx, project, clientOpts...)
+	}
+	var metadataCache *bigquery.MetadataCache
+	if *metadataCacheTTL > 0 {
+		cache, err := bigquery.NewMetadataCache(bigquery.CacheOptions{
+			TTL:        *metadataCacheTTL,
+			MaxEntries: *metadataCacheSize,
+			Path:       *metadataCacheFile,
+		})
+		if err != nil {
+			log.Fatalf("failed to load metadata cache: %v", err)
+		}
+		metadataCache = cache
+		newClient := provider
+		provider = func(ctx context.Context, project string) (bigquery.Client, error) {
+			c, err := newClient(ctx, project)
+			if err != nil {
+				return nil, err
+			}
+			return cache.Wrap(c), nil
+		}
+	}
+	if *resultCacheTTL > 0 {
+		cache := bigquery.NewResultCache(bigquery.ResultCacheOptions{
+			TTL:        *resultCacheTTL,
+			MaxEntries: *resultCacheSize,
+			MaxBytes:   *resultCacheBytes,
+		})
+		newClient := provider
+		provider = func(ctx context.Context, project string) (bigquery.Client, error) {
+			c, err := newClient(ctx, project)
+			if err != nil {
+				return nil, err
+			}
+			return cache.Wrap(c), nil
+		}
 	}
 	var opts []mcp.Option
 	if *filterStr != "" {
@@ -33,8 +119,83 @@ func main() {
 			log.Fatalf("invalid table-filter regex: %v", err)
 		}
 	}
+	format, err := mcp.ParseFormat(*formatStr)
+	if err != nil {
+		log.Fatalf("invalid format: %v", err)
+	}
+	opts = append(opts, mcp.WithDefaultFormat(format), mcp.WithResultBudget(*maxResultBytes))
+	if *datasetsStr != "" {
+		opts = append(opts, mcp.WithDatasets(strings.Split(*datasetsStr, ",")))
+	}
+	if *lint || *lintReject != "" {
+		reject, err := mcp.ParseLintRules(*lintReject)
+		if err != nil {
+			log.Fatalf("invalid lint-reject: %v", err)
+		}
+		opts = append(opts, mcp.WithLint(mcp.LintConfig{Enabled: true, Reject: reject, WideTableColumns: *lintWideColumns}))
+	}
+	if *logQueries || *formatLoggedSQL {
+		opts = append(opts, mcp.WithQueryLog(*formatLoggedSQL))
+	}
+	staticLabels, err := mcp.ParseLabels(*jobLabels)
+	if err != nil {
+		log.Fatalf("invalid job-labels: %v", err)
+	}
+	opts = append(opts, mcp.WithJobLabels(mcp.LabelConfig{Static: staticLabels, Dynamic: *dynamicLabels, PrincipalHeader: *principalHeader, TagSQL: *queryTag}))
+	opts = append(opts, mcp.WithExport(mcp.ExportConfig{Dir: *exportDir, MaxBytes: *exportMaxBytes}))
+	if *loadDir != "" && (!*writeMode || *scratchDataset == "") {
+		log.Printf("load tool disabled: -load-dir requires -write-mode and -scratch-dataset")
+	}
+	opts = append(opts,
+		mcp.WithWriteMode(*writeMode),
+		mcp.WithScratchDataset(mcp.ScratchConfig{Dataset: *scratchDataset, Expiration: *scratchExpiration}),
+		mcp.WithLoad(mcp.LoadConfig{Dir: *loadDir, MaxBytes: *loadMaxBytes, MaxRows: *loadMaxRows}),
+	)
+	redaction, err := redactionConfig(*redactColumns, *redactPolicyTags, *redactValues, *redactMode)
+	if err != nil {
+		log.Fatalf("invalid redaction settings: %v", err)
+	}
+	redaction.HashKey = *redactHashKey
+	opts = append(opts, mcp.WithRedaction(redaction))
+	opts = append(opts, mcp.WithPollInterval(*pollInterval), mcp.WithPromptsDir(*promptsDir), mcp.WithCompletionTTL(*completionTTL), mcp.WithBigQuerySessions(*bqSessions))
 	srv := mcp.NewServer(provider, *projectID, opts...)
-	if err := srv.Start(":8080"); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := srv.RefreshResources(ctx); err != nil {
+		log.Printf("failed to list resources: %v", err)
+	}
+	go srv.WatchResources(ctx)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start(":8080") }()
+	select {
+	case err := <-errc:
 		log.Fatalf("failed to start MCP server: %v", err)
+	case <-ctx.Done():
+	}
+	// Drop the scratch tables of open sessions before exiting.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if metadataCache != nil {
+		metadataCache.Flush()
+	}
+}
+
+// redactionConfig parses the redaction flags.
+func redactionConfig(columns, policyTags, values, mode string) (mcp.RedactionConfig, error) {
+	var cfg mcp.RedactionConfig
+	var err error
+	if cfg.Columns, err = mcp.ParseRedactionPatterns(columns); err != nil {
+		return cfg, err
+	}
+	if cfg.PolicyTags, err = mcp.ParseRedactionPatterns(policyTags); err != nil {
+		return cfg, err
+	}
+	if cfg.Values, err = mcp.ParseValueDetectors(values); err != nil {
+		return cfg, err
 	}
+	cfg.Mode, err = mcp.ParseRedactionMode(mode)
+	return cfg, err
 }
@@ -0,0 +1,95 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// scenario holds the parameters of runBigQueryScenario.
+type scenario struct {
+	clientProject, dataProject, dataset, table, sql string
+}
+
+func (s scenario) vars() map[string]string {
+	return map[string]string{
+		"BQ_CLIENT_PROJECT": s.clientProject,
+		"BQ_PROJECT":        s.dataProject,
+		"BQ_DATASET":        s.dataset,
+		"BQ_TABLE":          s.table,
+		"BQ_SQL":            s.sql,
+	}
+}
+
+// setupScenario returns the scenario parameters and a client provider for
+// the calling test. When BQ_PROJECT, BQ_DATASET, BQ_TABLE and BQ_SQL are set
+// the scenario runs against BigQuery, and setting BQ_RECORD=1 additionally
+// records the calls into testdata/cassettes/<test>.json. Otherwise the calls
+// are replayed from that cassette, so the scenario runs offline.
+func setupScenario(t *testing.T) (scenario, func(context.Context, string) (bigquery.Client, error)) {
+	t.Helper()
+	path := filepath.Join("testdata", "cassettes", t.Name()+".json")
+	sc := scenario{
+		clientProject: os.Getenv("BQ_CLIENT_PROJECT"),
+		dataProject:   os.Getenv("BQ_PROJECT"),
+		dataset:       os.Getenv("BQ_DATASET"),
+		table:         os.Getenv("BQ_TABLE"),
+		sql:           os.Getenv("BQ_SQL"),
+	}
+	if sc.dataProject == "" || sc.dataset == "" || sc.table == "" || sc.sql == "" {
+		replay, err := bigquery.NewReplayClient(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Skipf("BQ_PROJECT, BQ_DATASET, BQ_TABLE and BQ_SQL must be set, or a cassette recorded at %s", path)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := replay.Vars()
+		// SOURCE tells synthetic cassettes from ones recorded against
+		// BigQuery.
+		if src := v["SOURCE"]; src != "bigquery" {
+			t.Logf("replaying %s (source: %s)", path, src)
+		}
+		sc = scenario{v["BQ_CLIENT_PROJECT"], v["BQ_PROJECT"], v["BQ_DATASET"], v["BQ_TABLE"], v["BQ_SQL"]}
+		t.Cleanup(func() {
+			if unused := replay.Unused(); len(unused) > 0 {
+				t.Errorf("recorded calls not replayed, re-record the cassette with BQ_RECORD=1: %v", unused)
+			}
+		})
+		return sc, func(context.Context, string) (bigquery.Client, error) { return replay, nil }
+	}
+	if sc.clientProject == "" {
+		sc.clientProject = sc.dataProject
+	}
+	provider := func(ctx context.Context, project string) (bigquery.Client, error) {
+		return bigquery.NewClient(ctx, project)
+	}
+	if os.Getenv("BQ_RECORD") == "" {
+		return sc, provider
+	}
+	vars := sc.vars()
+	vars["SOURCE"] = "bigquery"
+	rec := bigquery.NewRecorder(path, vars)
+	t.Cleanup(func() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Save(); err != nil {
+			t.Fatalf("save cassette: %v", err)
+		}
+	})
+	return sc, func(ctx context.Context, project string) (bigquery.Client, error) {
+		c, err := provider(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		return rec.Wrap(c), nil
+	}
+}
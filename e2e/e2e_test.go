@@ -8,7 +8,6 @@ import (
 	"encoding/json"
 	"io"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
@@ -17,7 +16,6 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	mcpserver "github.com/mark3labs/mcp-go/server"
 
-	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
 	internalmcp "github.com/masudahiroto/bigquery-mcp-server/internal/mcp"
 )
 
@@ -112,26 +110,12 @@ func runBigQueryScenario(t *testing.T, ctx context.Context, cli *client.Client,
 }
 
 func TestBigQueryServer_TLS(t *testing.T) {
-	clientProject := os.Getenv("BQ_CLIENT_PROJECT")
-	dataProject := os.Getenv("BQ_PROJECT")
-	dataset := os.Getenv("BQ_DATASET")
-	table := os.Getenv("BQ_TABLE")
-	sql := os.Getenv("BQ_SQL")
-
-	if dataProject == "" || dataset == "" || table == "" || sql == "" {
-		t.Skip("BQ_PROJECT, BQ_DATASET, BQ_TABLE and BQ_SQL must be set")
-	}
-	if clientProject == "" {
-		clientProject = dataProject
-	}
+	sc, provider := setupScenario(t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	provider := func(ctx context.Context, project string) (bigquery.Client, error) {
-		return bigquery.NewClient(ctx, project)
-	}
-	srv := internalmcp.NewServer(provider, clientProject)
+	srv := internalmcp.NewServer(provider, sc.clientProject)
 	httpSrv := mcpserver.NewStreamableHTTPServer(srv.MCPServer())
 
 	ts := httptest.NewTLSServer(httpSrv)
@@ -150,30 +134,16 @@ func TestBigQueryServer_TLS(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	}()
 
-       runBigQueryScenario(t, ctx, cli, dataProject, dataset, table, sql)
+       runBigQueryScenario(t, ctx, cli, sc.dataProject, sc.dataset, sc.table, sc.sql)
 }
 
 func TestBigQueryServer_Stdio(t *testing.T) {
-	clientProject := os.Getenv("BQ_CLIENT_PROJECT")
-	dataProject := os.Getenv("BQ_PROJECT")
-	dataset := os.Getenv("BQ_DATASET")
-	table := os.Getenv("BQ_TABLE")
-	sql := os.Getenv("BQ_SQL")
-
-	if dataProject == "" || dataset == "" || table == "" || sql == "" {
-		t.Skip("BQ_PROJECT, BQ_DATASET, BQ_TABLE and BQ_SQL must be set")
-	}
-	if clientProject == "" {
-		clientProject = dataProject
-	}
+	sc, provider := setupScenario(t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	provider := func(ctx context.Context, project string) (bigquery.Client, error) {
-		return bigquery.NewClient(ctx, project)
-	}
-	srv := internalmcp.NewServer(provider, clientProject)
+	srv := internalmcp.NewServer(provider, sc.clientProject)
 	stdioSrv := mcpserver.NewStdioServer(srv.MCPServer())
 
 	serverReader, clientWriter := io.Pipe()
@@ -191,5 +161,5 @@ func TestBigQueryServer_Stdio(t *testing.T) {
 	}
 	defer cli.Close()
 
-	runBigQueryScenario(t, ctx, cli, dataProject, dataset, table, sql)
+	runBigQueryScenario(t, ctx, cli, sc.dataProject, sc.dataset, sc.table, sc.sql)
 }
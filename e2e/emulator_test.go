@@ -0,0 +1,56 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"google.golang.org/api/option"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+	internalmcp "github.com/masudahiroto/bigquery-mcp-server/internal/mcp"
+)
+
+// TestBigQueryServer_Emulator runs the scenario against a local
+// bigquery-emulator loaded with testdata/emulator.yaml, so it needs no
+// Google credentials or network access. See scripts/run_e2e_emulator.sh.
+func TestBigQueryServer_Emulator(t *testing.T) {
+	endpoint := os.Getenv("BQ_EMULATOR_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BQ_EMULATOR_ENDPOINT must be set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	provider := func(ctx context.Context, project string) (bigquery.Client, error) {
+		return bigquery.NewClient(ctx, project, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	}
+	srv := internalmcp.NewServer(provider, "test")
+	stdioSrv := mcpserver.NewStdioServer(srv.MCPServer())
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+
+	go func() {
+		stdioSrv.Listen(ctx, serverReader, serverWriter)
+	}()
+
+	var logBuf bytes.Buffer
+	trans := transport.NewIO(clientReader, clientWriter, io.NopCloser(&logBuf))
+	cli := client.NewClient(trans)
+	if err := cli.Start(ctx); err != nil {
+		t.Fatalf("start client: %v", err)
+	}
+	defer cli.Close()
+
+	runBigQueryScenario(t, ctx, cli, "test", "dataset1", "users", "SELECT id, name FROM `test.dataset1.users` WHERE id = 1")
+}
@@ -0,0 +1,363 @@
+package bigquery
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// CacheOptions configures a MetadataCache.
+type CacheOptions struct {
+	// TTL is how long entries are served without contacting BigQuery.
+	// Expired table metadata is revalidated against the ETag or last
+	// modified time of the table and kept when unchanged; expired listings
+	// are fetched again.
+	TTL time.Duration
+	// MaxEntries bounds the number of cached entries; the least recently
+	// used entry is evicted first. Zero means unlimited.
+	MaxEntries int
+	// Path optionally persists the cache to a JSON file so that restarts
+	// are warm. Changes are written in the background, at most once per
+	// saveDelay; Flush writes pending changes.
+	Path string
+}
+
+// saveDelay batches the writes of a persisted cache.
+const saveDelay = 5 * time.Second
+
+type refreshKey struct{}
+
+// WithRefresh returns a context that makes caching clients bypass cached
+// entries and fetch fresh data.
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+func refreshRequested(ctx context.Context) bool {
+	v, _ := ctx.Value(refreshKey{}).(bool)
+	return v
+}
+
+// MetadataCache stores table metadata and table listings shared by all
+// clients wrapped with Wrap.
+type MetadataCache struct {
+	opts CacheOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	// pending is set while a background save is scheduled.
+	pending bool
+	// saveMu serializes writes of the cache file.
+	saveMu sync.Mutex
+}
+
+// cacheEntry is a cached table listing or table metadata.
+type cacheEntry struct {
+	Key      string                  `json:"key"`
+	Tables   []string                `json:"tables,omitempty"`
+	Metadata *bigquery.TableMetadata `json:"-"`
+	Table    *persistedTable         `json:"table,omitempty"`
+	Expires  time.Time               `json:"expires"`
+}
+
+// persistedTable is the subset of table metadata written to disk.
+type persistedTable struct {
+	Name             string                               `json:"name,omitempty"`
+	Description      string                               `json:"description,omitempty"`
+	Type             bigquery.TableType                   `json:"type,omitempty"`
+	Schema           bigquery.Schema                      `json:"schema"`
+	Labels           map[string]string                    `json:"labels,omitempty"`
+	TimePartitioning *bigquery.TimePartitioning           `json:"time_partitioning,omitempty"`
+	RangePartition   *bigquery.RangePartitioning          `json:"range_partitioning,omitempty"`
+	RequireFilter    bool                                 `json:"require_partition_filter,omitempty"`
+	Clustering       *bigquery.Clustering                 `json:"clustering,omitempty"`
+	ViewQuery        string                               `json:"view_query,omitempty"`
+	MaterializedView *bigquery.MaterializedViewDefinition `json:"materialized_view,omitempty"`
+	NumRows          uint64                               `json:"num_rows"`
+	NumBytes         int64                                `json:"num_bytes"`
+	CreationTime     time.Time                            `json:"creation_time"`
+	LastModifiedTime time.Time                            `json:"last_modified_time"`
+	ExpirationTime   time.Time                            `json:"expiration_time"`
+	ETag             string                               `json:"etag,omitempty"`
+}
+
+func persistTable(m *bigquery.TableMetadata) *persistedTable {
+	return &persistedTable{
+		Name: m.Name, Description: m.Description, Type: m.Type, Schema: m.Schema,
+		Labels: m.Labels, TimePartitioning: m.TimePartitioning, Clustering: m.Clustering,
+		RangePartition: m.RangePartitioning, RequireFilter: m.RequirePartitionFilter, ViewQuery: m.ViewQuery,
+		MaterializedView: m.MaterializedView,
+		NumRows:          m.NumRows, NumBytes: m.NumBytes, CreationTime: m.CreationTime,
+		LastModifiedTime: m.LastModifiedTime, ExpirationTime: m.ExpirationTime, ETag: m.ETag,
+	}
+}
+
+func (p *persistedTable) metadata() *bigquery.TableMetadata {
+	return &bigquery.TableMetadata{
+		Name: p.Name, Description: p.Description, Type: p.Type, Schema: p.Schema,
+		Labels: p.Labels, TimePartitioning: p.TimePartitioning, Clustering: p.Clustering,
+		RangePartitioning: p.RangePartition, RequirePartitionFilter: p.RequireFilter, ViewQuery: p.ViewQuery,
+		MaterializedView: p.MaterializedView,
+		NumRows:          p.NumRows, NumBytes: p.NumBytes, CreationTime: p.CreationTime,
+		LastModifiedTime: p.LastModifiedTime, ExpirationTime: p.ExpirationTime, ETag: p.ETag,
+	}
+}
+
+// NewMetadataCache creates a cache, loading persisted entries from
+// opts.Path when it exists.
+func NewMetadataCache(opts CacheOptions) (*MetadataCache, error) {
+	c := &MetadataCache{opts: opts, now: time.Now, lru: list.New(), entries: make(map[string]*list.Element)}
+	if opts.Path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(opts.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Table != nil {
+			e.Metadata = e.Table.metadata()
+		}
+		c.put(e)
+	}
+	return c, nil
+}
+
+// Wrap returns a Client that serves GetTableSchema, GetTableMetadata and
+// ListTables from the cache and delegates everything else to next. Tables
+// loaded, written by queries or deleted through the client are invalidated.
+func (c *MetadataCache) Wrap(next Client) Client {
+	return &cachingClient{Client: next, cache: c}
+}
+
+// InvalidateTable drops cached metadata of a table.
+func (c *MetadataCache) InvalidateTable(projectID, datasetID, tableID string) {
+	c.remove(tableKey(projectID, datasetID, tableID))
+}
+
+// InvalidateDataset drops the cached table listing of a dataset.
+func (c *MetadataCache) InvalidateDataset(projectID, datasetID string) {
+	c.remove(listKey(projectID, datasetID))
+}
+
+func tableKey(projectID, datasetID, tableID string) string {
+	return "table/" + projectID + "/" + datasetID + "/" + tableID
+}
+
+func listKey(projectID, datasetID string) string {
+	return "tables/" + projectID + "/" + datasetID
+}
+
+func (c *MetadataCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+func (c *MetadataCache) put(e *cacheEntry) {
+	c.mu.Lock()
+	if el, ok := c.entries[e.Key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[e.Key] = c.lru.PushFront(e)
+	}
+	for c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+	c.mu.Unlock()
+}
+
+func (c *MetadataCache) remove(key string) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	c.save()
+}
+
+// save schedules a background write of the cache to opts.Path, if
+// configured, so that cache misses do not wait for the file.
+func (c *MetadataCache) save() {
+	if c.opts.Path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending {
+		return
+	}
+	c.pending = true
+	time.AfterFunc(saveDelay, c.Flush)
+}
+
+// Flush writes the cache to opts.Path, if configured. Persistence is best
+// effort: failures only cost a cold start.
+func (c *MetadataCache) Flush() {
+	if c.opts.Path == "" {
+		return
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.Lock()
+	c.pending = false
+	entries := make([]*cacheEntry, 0, c.lru.Len())
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		entries = append(entries, el.Value.(*cacheEntry))
+	}
+	data, err := json.Marshal(entries)
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.opts.Path), ".metadata-cache-*")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), c.opts.Path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+type cachingClient struct {
+	Client
+	cache *MetadataCache
+}
+
+func (c *cachingClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
+	meta, err := c.GetTableMetadata(ctx, projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+	return meta.Schema, nil
+}
+
+// GetTableMetadata serves fresh entries from the cache. Expired entries are
+// revalidated with GetTableVersion, which is cheaper than fetching the
+// metadata again, and their TTL is extended when the table is unchanged.
+func (c *cachingClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	key := tableKey(projectID, datasetID, tableID)
+	now := c.cache.now()
+	if e := c.cache.get(key); e != nil && !refreshRequested(ctx) {
+		if now.Before(e.Expires) {
+			return e.Metadata, nil
+		}
+		if c.unchanged(ctx, e.Metadata, projectID, datasetID, tableID) {
+			c.cache.put(&cacheEntry{Key: key, Metadata: e.Metadata, Table: e.Table, Expires: now.Add(c.cache.opts.TTL)})
+			c.cache.save()
+			return e.Metadata, nil
+		}
+	}
+	meta, err := c.Client.GetTableMetadata(ctx, projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+	c.cache.put(&cacheEntry{Key: key, Metadata: meta, Table: persistTable(meta), Expires: now.Add(c.cache.opts.TTL)})
+	c.cache.save()
+	return meta, nil
+}
+
+// unchanged reports whether a table still has the version of its cached
+// metadata: the same ETag or, when either lacks one, the same last modified
+// time. Failures count as changes, leaving the error to the full fetch.
+func (c *cachingClient) unchanged(ctx context.Context, cached *bigquery.TableMetadata, projectID, datasetID, tableID string) bool {
+	v, err := c.Client.GetTableVersion(ctx, projectID, datasetID, tableID)
+	if err != nil || v == nil {
+		return false
+	}
+	if v.ETag != "" && cached.ETag != "" {
+		return v.ETag == cached.ETag
+	}
+	return !v.LastModifiedTime.IsZero() && v.LastModifiedTime.Equal(cached.LastModifiedTime)
+}
+
+func (c *cachingClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	key := listKey(projectID, datasetID)
+	now := c.cache.now()
+	if e := c.cache.get(key); e != nil && !refreshRequested(ctx) && now.Before(e.Expires) {
+		return e.Tables, nil
+	}
+	tables, err := c.Client.ListTables(ctx, projectID, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.put(&cacheEntry{Key: key, Tables: tables, Expires: now.Add(c.cache.opts.TTL)})
+	c.cache.save()
+	return tables, nil
+}
+
+func (c *cachingClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error) {
+	res, err := c.Client.LoadTable(ctx, projectID, datasetID, tableID, data, opts)
+	c.invalidate(projectID, datasetID, tableID)
+	return res, err
+}
+
+// RunQuery invalidates the destination table of queries writing to one.
+func (c *cachingClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	res, err := c.Client.RunQuery(ctx, sql)
+	if dst := QueryConfigFrom(ctx).Destination; dst != nil {
+		c.invalidate(dst.Project, dst.Dataset, dst.Table)
+	}
+	return res, err
+}
+
+// ExecuteQuery invalidates the destination table like RunQuery.
+func (c *cachingClient) ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	res, err := c.Client.ExecuteQuery(ctx, sql)
+	if dst := QueryConfigFrom(ctx).Destination; dst != nil {
+		c.invalidate(dst.Project, dst.Dataset, dst.Table)
+	}
+	return res, err
+}
+
+func (c *cachingClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	err := c.Client.DeleteTable(ctx, projectID, datasetID, tableID)
+	c.invalidate(projectID, datasetID, tableID)
+	return err
+}
+
+// invalidate drops a table and the listing of its dataset, which may gain or
+// lose the table.
+func (c *cachingClient) invalidate(projectID, datasetID, tableID string) {
+	c.cache.InvalidateTable(projectID, datasetID, tableID)
+	c.cache.InvalidateDataset(projectID, datasetID)
+}
@@ -0,0 +1,224 @@
+package bigquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+type countingClient struct {
+	*MockClient
+	metadataCalls int
+	listCalls     int
+	queryCalls    int
+}
+
+func (c *countingClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	c.queryCalls++
+	return c.MockClient.RunQuery(ctx, sql)
+}
+
+func (c *countingClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	c.metadataCalls++
+	return c.MockClient.GetTableMetadata(ctx, projectID, datasetID, tableID)
+}
+
+func (c *countingClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	c.listCalls++
+	return c.MockClient.ListTables(ctx, projectID, datasetID)
+}
+
+func newTestCache(t *testing.T, opts CacheOptions) (*MetadataCache, *time.Time) {
+	t.Helper()
+	cache, err := NewMetadataCache(opts)
+	if err != nil {
+		t.Fatalf("NewMetadataCache: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestCachingClientTTLAndRefresh(t *testing.T) {
+	next := &countingClient{MockClient: &MockClient{
+		MetadataRes: &bigquery.TableMetadata{ETag: "e1", Schema: bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}}},
+		TablesRes:   []string{"t1"},
+	}}
+	cache, now := newTestCache(t, CacheOptions{TTL: time.Minute})
+	c := cache.Wrap(next)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		schema, err := c.GetTableSchema(ctx, "p", "d", "t")
+		if err != nil || len(schema) != 1 {
+			t.Fatalf("GetTableSchema: %v %v", schema, err)
+		}
+		if _, err := c.ListTables(ctx, "p", "d"); err != nil {
+			t.Fatalf("ListTables: %v", err)
+		}
+	}
+	if next.metadataCalls != 1 || next.listCalls != 1 {
+		t.Fatalf("expected cached calls, got metadata=%d list=%d", next.metadataCalls, next.listCalls)
+	}
+
+	if _, err := c.ListTables(WithRefresh(ctx), "p", "d"); err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	if next.listCalls != 2 {
+		t.Fatalf("expected refresh to bypass cache, got %d calls", next.listCalls)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if _, err := c.GetTableSchema(ctx, "p", "d", "t"); err != nil {
+		t.Fatalf("GetTableSchema: %v", err)
+	}
+	if next.metadataCalls != 2 {
+		t.Fatalf("expected expired entry to be revalidated, got %d calls", next.metadataCalls)
+	}
+}
+
+func TestCachingClientRevalidatesExpiredEntries(t *testing.T) {
+	modified := time.Unix(500, 0)
+	next := &countingClient{MockClient: &MockClient{
+		MetadataRes: &bigquery.TableMetadata{ETag: "e1", LastModifiedTime: modified, Schema: bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}}},
+		VersionRes:  &bigquery.TableMetadata{ETag: "e1"},
+	}}
+	cache, now := newTestCache(t, CacheOptions{TTL: time.Minute})
+	c := cache.Wrap(next)
+	ctx := context.Background()
+
+	c.GetTableMetadata(ctx, "p", "d", "t")
+	*now = now.Add(2 * time.Minute)
+	if got, _ := c.GetTableMetadata(ctx, "p", "d", "t"); got.Schema[0].Name != "id" || next.metadataCalls != 1 {
+		t.Fatalf("expected the unchanged entry to be kept, got %#v after %d calls", got, next.metadataCalls)
+	}
+	// The TTL was extended by the revalidation.
+	*now = now.Add(30 * time.Second)
+	next.VersionRes = nil
+	c.GetTableMetadata(ctx, "p", "d", "t")
+	if next.metadataCalls != 1 {
+		t.Fatalf("expected the revalidated entry to be fresh, got %d calls", next.metadataCalls)
+	}
+
+	// Without ETags, the last modified time decides.
+	cache, now = newTestCache(t, CacheOptions{TTL: time.Minute})
+	c = cache.Wrap(next)
+	next.MetadataRes.ETag = ""
+	next.VersionRes = &bigquery.TableMetadata{LastModifiedTime: modified}
+	c.GetTableMetadata(ctx, "p", "d", "t")
+	*now = now.Add(2 * time.Minute)
+	c.GetTableMetadata(ctx, "p", "d", "t")
+	if next.metadataCalls != 2 {
+		t.Fatalf("expected the entry with an unchanged modification time to be kept, got %d calls", next.metadataCalls)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	next.VersionRes = &bigquery.TableMetadata{ETag: "e2", LastModifiedTime: modified.Add(time.Second)}
+	next.MetadataRes = &bigquery.TableMetadata{ETag: "e2", Schema: bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}}}
+	got, _ := c.GetTableMetadata(ctx, "p", "d", "t")
+	if got.Schema[0].Name != "name" || next.metadataCalls != 3 {
+		t.Fatalf("expected the changed entry to be replaced, got %#v after %d calls", got, next.metadataCalls)
+	}
+}
+
+func TestMetadataCacheEvictionAndInvalidation(t *testing.T) {
+	next := &countingClient{MockClient: &MockClient{TablesRes: []string{"t1"}}}
+	cache, _ := newTestCache(t, CacheOptions{TTL: time.Minute, MaxEntries: 2})
+	c := cache.Wrap(next)
+	ctx := context.Background()
+
+	for _, ds := range []string{"a", "b", "c"} {
+		c.ListTables(ctx, "p", ds)
+	}
+	c.ListTables(ctx, "p", "a")
+	if next.listCalls != 4 {
+		t.Fatalf("expected least recently used entry to be evicted, got %d calls", next.listCalls)
+	}
+	c.ListTables(ctx, "p", "c")
+	if next.listCalls != 4 {
+		t.Fatalf("expected c to stay cached, got %d calls", next.listCalls)
+	}
+	cache.InvalidateDataset("p", "c")
+	c.ListTables(ctx, "p", "c")
+	if next.listCalls != 5 {
+		t.Fatalf("expected invalidated entry to be fetched, got %d calls", next.listCalls)
+	}
+}
+
+func TestMetadataCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	next := &countingClient{MockClient: &MockClient{
+		MetadataRes: &bigquery.TableMetadata{
+			Type:             bigquery.MaterializedView,
+			MaterializedView: &bigquery.MaterializedViewDefinition{Query: "SELECT 1 AS id"},
+			Schema:           bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}},
+		},
+		TablesRes: []string{"t1", "t2"},
+	}}
+	cache, _ := newTestCache(t, CacheOptions{TTL: time.Hour, Path: path})
+	c := cache.Wrap(next)
+	ctx := context.Background()
+	c.GetTableSchema(ctx, "p", "d", "t")
+	c.ListTables(ctx, "p", "d")
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("cache file written in the request path")
+	}
+	cache.Flush()
+
+	restarted, err := NewMetadataCache(CacheOptions{TTL: time.Hour, Path: path})
+	if err != nil {
+		t.Fatalf("reload cache: %v", err)
+	}
+	restarted.now = cache.now
+	next2 := &countingClient{MockClient: &MockClient{}}
+	c2 := restarted.Wrap(next2)
+	schema, err := c2.GetTableSchema(ctx, "p", "d", "t")
+	if err != nil || len(schema) != 1 || schema[0].Name != "id" {
+		t.Fatalf("unexpected persisted schema: %v %v", schema, err)
+	}
+	if meta, _ := c2.GetTableMetadata(ctx, "p", "d", "t"); meta.MaterializedView == nil || meta.MaterializedView.Query != "SELECT 1 AS id" {
+		t.Fatalf("materialized view definition not persisted: %+v", meta)
+	}
+	tables, err := c2.ListTables(ctx, "p", "d")
+	if err != nil || len(tables) != 2 {
+		t.Fatalf("unexpected persisted tables: %v %v", tables, err)
+	}
+	if next2.metadataCalls != 0 || next2.listCalls != 0 {
+		t.Fatalf("expected warm cache after restart, got metadata=%d list=%d", next2.metadataCalls, next2.listCalls)
+	}
+}
+
+func TestCachingClientLoadInvalidates(t *testing.T) {
+	next := &countingClient{MockClient: &MockClient{
+		MetadataRes: &bigquery.TableMetadata{Schema: bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}}},
+		TablesRes:   []string{"t1"},
+		LoadRes:     &LoadResult{JobID: "load"},
+	}}
+	cache, _ := newTestCache(t, CacheOptions{TTL: time.Minute})
+	c := cache.Wrap(next)
+	ctx := context.Background()
+	c.GetTableMetadata(ctx, "p", "d", "t1")
+	c.ListTables(ctx, "p", "d")
+	if _, err := c.LoadTable(ctx, "p", "d", "t1", strings.NewReader("id\n1\n"), LoadOptions{Format: bigquery.CSV}); err != nil {
+		t.Fatalf("LoadTable: %v", err)
+	}
+	c.GetTableMetadata(ctx, "p", "d", "t1")
+	c.ListTables(ctx, "p", "d")
+	if next.metadataCalls != 2 || next.listCalls != 2 {
+		t.Fatalf("expected the load to invalidate the table and listing, got metadata=%d list=%d", next.metadataCalls, next.listCalls)
+	}
+
+	dst := WithQueryConfig(ctx, QueryConfig{Destination: &Destination{Project: "p", Dataset: "d", Table: "t1"}})
+	c.RunQuery(dst, "SELECT 1")
+	c.GetTableMetadata(ctx, "p", "d", "t1")
+	c.DeleteTable(ctx, "p", "d", "t1")
+	c.ListTables(ctx, "p", "d")
+	if next.metadataCalls != 3 || next.listCalls != 3 {
+		t.Fatalf("expected queries and deletes to invalidate the table and listing, got metadata=%d list=%d", next.metadataCalls, next.listCalls)
+	}
+}
@@ -0,0 +1,862 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/googleapi"
+)
+
+// cassette is a recording of the calls made to a Client, written by a
+// Recorder and served by a ReplayClient. Vars holds free-form values stored
+// alongside the interactions, such as the parameters of a test scenario.
+type cassette struct {
+	Vars         map[string]string `json:"vars,omitempty"`
+	Interactions []*interaction    `json:"interactions"`
+}
+
+// interaction is a single recorded call and its response.
+type interaction struct {
+	Method   string         `json:"method"`
+	Request  request        `json:"request"`
+	Response *response      `json:"response,omitempty"`
+	Error    *recordedError `json:"error,omitempty"`
+	used     bool
+}
+
+// request holds the arguments of a call. SQL is stored as given and
+// compared after whitespace normalization.
+type request struct {
+	Project  string       `json:"project,omitempty"`
+	Dataset  string       `json:"dataset,omitempty"`
+	Table    string       `json:"table,omitempty"`
+	SQL      string       `json:"sql,omitempty"`
+	JobID    string       `json:"job_id,omitempty"`
+	Location string       `json:"location,omitempty"`
+	Read     *ReadOptions `json:"read,omitempty"`
+	Config   *QueryConfig `json:"config,omitempty"`
+	Load     *loadRequest `json:"load,omitempty"`
+}
+
+// loadRequest holds the options of a load and a checksum of the loaded data.
+type loadRequest struct {
+	LoadOptions
+	Schema jsonSchema `json:"schema,omitempty"`
+	SHA256 string     `json:"sha256"`
+}
+
+// newLoadRequest reads data to compute its checksum and returns the request
+// together with a reader replaying the data. The expiration depends on the
+// time of the call and is left out.
+func newLoadRequest(projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (request, io.Reader, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return request{}, nil, err
+	}
+	opts.Expiration = time.Time{}
+	sum := sha256.Sum256(b)
+	load := &loadRequest{LoadOptions: opts, Schema: jsonSchema(opts.Schema), SHA256: hex.EncodeToString(sum[:])}
+	return request{Project: projectID, Dataset: datasetID, Table: tableID, Load: load}, bytes.NewReader(b), nil
+}
+
+// queryRequest returns the request of a query, including the settings
+// attached to ctx. Labels do not affect results and may carry per-run
+// values such as session IDs, so they are left out, as is the expiration of
+// the destination table, which depends on the time of the call.
+func queryRequest(ctx context.Context, sql string) request {
+	r := request{SQL: sql}
+	cfg := QueryConfigFrom(ctx)
+	cfg.Labels, cfg.TagSQL = nil, false
+	if cfg.Destination != nil {
+		dst := *cfg.Destination
+		dst.Expiration = time.Time{}
+		cfg.Destination = &dst
+	}
+	if !cfg.isZero() {
+		r.Config = &cfg
+	}
+	return r
+}
+
+func (r request) key() string {
+	r.SQL = normalizeSQL(r.SQL)
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+func (r request) String() string {
+	var parts []string
+	add := func(name, v string) {
+		if v != "" {
+			parts = append(parts, name+"="+strconv.Quote(v))
+		}
+	}
+	add("project", r.Project)
+	add("dataset", r.Dataset)
+	add("table", r.Table)
+	add("job_id", r.JobID)
+	add("location", r.Location)
+	add("sql", normalizeSQL(r.SQL))
+	if r.Read != nil {
+		parts = append(parts, fmt.Sprintf("read=%+v", *r.Read))
+	}
+	if r.Config != nil {
+		cfg := *r.Config
+		cfg.Destination = nil
+		parts = append(parts, fmt.Sprintf("config=%+v", cfg))
+		if dst := r.Config.Destination; dst != nil {
+			parts = append(parts, fmt.Sprintf("destination=%+v", *dst))
+		}
+	}
+	if r.Load != nil {
+		parts = append(parts, fmt.Sprintf("load={format:%s write_disposition:%s sha256:%s}", r.Load.Format, r.Load.WriteDisposition, r.Load.SHA256))
+	}
+	return strings.Join(parts, " ")
+}
+
+// response holds the result of a call. Rows are encoded with their schema
+// so that values decode to the types returned by BigQuery.
+type response struct {
+	Schema    jsonSchema       `json:"schema,omitempty"`
+	Rows      []map[string]any `json:"rows,omitempty"`
+	TotalRows uint64           `json:"total_rows,omitempty"`
+	JobID     string           `json:"job_id,omitempty"`
+	Location  string           `json:"location,omitempty"`
+	SessionID string           `json:"session_id,omitempty"`
+	Names     []string         `json:"names,omitempty"`
+	Table     *persistedTable  `json:"table,omitempty"`
+	Query     *recordedQuery   `json:"query,omitempty"`
+	Job       *recordedJob     `json:"job,omitempty"`
+	Load      *LoadResult      `json:"load,omitempty"`
+
+	Statements []*recordedStatement `json:"statements,omitempty"`
+}
+
+// recordedStatement is the result of a script statement.
+type recordedStatement struct {
+	JobID              string           `json:"job_id"`
+	StatementType      string           `json:"statement_type,omitempty"`
+	Schema             jsonSchema       `json:"schema,omitempty"`
+	Rows               []map[string]any `json:"rows,omitempty"`
+	TotalRows          uint64           `json:"total_rows,omitempty"`
+	NumDMLAffectedRows int64            `json:"num_dml_affected_rows,omitempty"`
+}
+
+// jsonSchema encodes a schema in the JSON format used by the bq tool, which
+// is more compact than the encoding of bigquery.FieldSchema.
+type jsonSchema bigquery.Schema
+
+func (s jsonSchema) MarshalJSON() ([]byte, error) {
+	return bigquery.Schema(s).ToJSONFields()
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	schema, err := bigquery.SchemaFromJSON(data)
+	*s = jsonSchema(schema)
+	return err
+}
+
+// recordedQuery is the subset of query statistics kept in cassettes.
+type recordedQuery struct {
+	CacheHit            bool                            `json:"cache_hit,omitempty"`
+	StatementType       string                          `json:"statement_type,omitempty"`
+	TotalBytesBilled    int64                           `json:"total_bytes_billed"`
+	TotalBytesProcessed int64                           `json:"total_bytes_processed"`
+	SlotMillis          int64                           `json:"slot_millis,omitempty"`
+	NumDMLAffectedRows  int64                           `json:"num_dml_affected_rows,omitempty"`
+	ReferencedTables    []string                        `json:"referenced_tables,omitempty"`
+	Schema              jsonSchema                      `json:"schema,omitempty"`
+	QueryPlan           []*bigquery.ExplainQueryStage   `json:"query_plan,omitempty"`
+	Timeline            []*bigquery.QueryTimelineSample `json:"timeline,omitempty"`
+}
+
+// recordedJob is the subset of job statistics kept in cassettes.
+type recordedJob struct {
+	CreationTime        time.Time      `json:"creation_time"`
+	StartTime           time.Time      `json:"start_time"`
+	EndTime             time.Time      `json:"end_time"`
+	TotalBytesProcessed int64          `json:"total_bytes_processed"`
+	Query               *recordedQuery `json:"query,omitempty"`
+}
+
+// recordedError keeps the HTTP status of API errors so that callers
+// checking for e.g. 404 behave the same on replay.
+type recordedError struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func recordError(err error) *recordedError {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return &recordedError{Code: apiErr.Code, Message: apiErr.Message}
+	}
+	return &recordedError{Message: err.Error()}
+}
+
+func (e *recordedError) err() error {
+	if e.Code != 0 {
+		return &googleapi.Error{Code: e.Code, Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+func recordQuery(qs *bigquery.QueryStatistics) *recordedQuery {
+	if qs == nil {
+		return nil
+	}
+	q := &recordedQuery{
+		CacheHit: qs.CacheHit, StatementType: qs.StatementType,
+		TotalBytesBilled: qs.TotalBytesBilled, TotalBytesProcessed: qs.TotalBytesProcessed,
+		SlotMillis: qs.SlotMillis, NumDMLAffectedRows: qs.NumDMLAffectedRows,
+		Schema: jsonSchema(qs.Schema), QueryPlan: qs.QueryPlan, Timeline: qs.Timeline,
+	}
+	for _, t := range qs.ReferencedTables {
+		q.ReferencedTables = append(q.ReferencedTables, t.ProjectID+"."+t.DatasetID+"."+t.TableID)
+	}
+	return q
+}
+
+func (q *recordedQuery) statistics() *bigquery.QueryStatistics {
+	if q == nil {
+		return nil
+	}
+	qs := &bigquery.QueryStatistics{
+		CacheHit: q.CacheHit, StatementType: q.StatementType,
+		TotalBytesBilled: q.TotalBytesBilled, TotalBytesProcessed: q.TotalBytesProcessed,
+		SlotMillis: q.SlotMillis, NumDMLAffectedRows: q.NumDMLAffectedRows,
+		Schema: bigquery.Schema(q.Schema), QueryPlan: q.QueryPlan, Timeline: q.Timeline,
+	}
+	for _, t := range q.ReferencedTables {
+		parts := strings.SplitN(t, ".", 3)
+		if len(parts) == 3 {
+			qs.ReferencedTables = append(qs.ReferencedTables, &bigquery.Table{ProjectID: parts[0], DatasetID: parts[1], TableID: parts[2]})
+		}
+	}
+	return qs
+}
+
+func recordJob(js *bigquery.JobStatistics) *recordedJob {
+	if js == nil {
+		return nil
+	}
+	j := &recordedJob{CreationTime: js.CreationTime, StartTime: js.StartTime, EndTime: js.EndTime, TotalBytesProcessed: js.TotalBytesProcessed}
+	if qs, ok := js.Details.(*bigquery.QueryStatistics); ok {
+		j.Query = recordQuery(qs)
+	}
+	return j
+}
+
+func (j *recordedJob) statistics() *bigquery.JobStatistics {
+	if j == nil {
+		return nil
+	}
+	js := &bigquery.JobStatistics{CreationTime: j.CreationTime, StartTime: j.StartTime, EndTime: j.EndTime, TotalBytesProcessed: j.TotalBytesProcessed}
+	if j.Query != nil {
+		js.Details = j.Query.statistics()
+	}
+	return js
+}
+
+func recordResult(res *QueryResult) *response {
+	if res == nil {
+		return nil
+	}
+	r := &response{Schema: jsonSchema(res.Schema), TotalRows: res.TotalRows, JobID: res.JobID, Location: res.Location, SessionID: res.SessionID}
+	for _, row := range res.Rows {
+		r.Rows = append(r.Rows, encodeRow(res.Schema, row))
+	}
+	for _, st := range res.Statements {
+		rs := &recordedStatement{JobID: st.JobID, StatementType: st.StatementType, Schema: jsonSchema(st.Schema), TotalRows: st.TotalRows, NumDMLAffectedRows: st.NumDMLAffectedRows}
+		for _, row := range st.Rows {
+			rs.Rows = append(rs.Rows, encodeRow(st.Schema, row))
+		}
+		r.Statements = append(r.Statements, rs)
+	}
+	return r
+}
+
+func (r *response) result() (*QueryResult, error) {
+	res := &QueryResult{Schema: bigquery.Schema(r.Schema), TotalRows: r.TotalRows, JobID: r.JobID, Location: r.Location, SessionID: r.SessionID}
+	for _, row := range r.Rows {
+		decoded, err := decodeRow(bigquery.Schema(r.Schema), row)
+		if err != nil {
+			return nil, err
+		}
+		res.Rows = append(res.Rows, decoded)
+	}
+	for _, rs := range r.Statements {
+		st := &StatementResult{JobID: rs.JobID, StatementType: rs.StatementType, Schema: bigquery.Schema(rs.Schema), TotalRows: rs.TotalRows, NumDMLAffectedRows: rs.NumDMLAffectedRows}
+		for _, row := range rs.Rows {
+			decoded, err := decodeRow(st.Schema, row)
+			if err != nil {
+				return nil, err
+			}
+			st.Rows = append(st.Rows, decoded)
+		}
+		res.Statements = append(res.Statements, st)
+	}
+	return res, nil
+}
+
+// encodeRow converts a row to JSON friendly values. Types without a natural
+// JSON form, such as dates and numerics, are written as their canonical
+// BigQuery string representation.
+func encodeRow(schema bigquery.Schema, row map[string]bigquery.Value) map[string]any {
+	out := make(map[string]any, len(row))
+	for _, f := range schema {
+		if v, ok := row[f.Name]; ok {
+			out[f.Name] = encodeValue(f, v)
+		}
+	}
+	return out
+}
+
+func encodeValue(f *bigquery.FieldSchema, v bigquery.Value) any {
+	if f.Repeated {
+		if list, ok := v.([]bigquery.Value); ok {
+			out := make([]any, len(list))
+			elem := *f
+			elem.Repeated = false
+			for i, e := range list {
+				out[i] = encodeValue(&elem, e)
+			}
+			return out
+		}
+	}
+	switch v := v.(type) {
+	case map[string]bigquery.Value:
+		return encodeRow(f.Schema, v)
+	case []bigquery.Value:
+		// Records read into a slice are ordered like the schema.
+		out := make(map[string]any, len(v))
+		for i, sub := range f.Schema {
+			if i < len(v) {
+				out[sub.Name] = encodeValue(sub, v[i])
+			}
+		}
+		return out
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case civil.Date, civil.DateTime, civil.Time:
+		return fmt.Sprint(v)
+	case *big.Rat:
+		if f.Type == bigquery.BigNumericFieldType {
+			return bigquery.BigNumericString(v)
+		}
+		return bigquery.NumericString(v)
+	case *bigquery.IntervalValue:
+		return v.String()
+	case float64:
+		// NaN and infinities have no JSON number form.
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return v
+}
+
+func decodeRow(schema bigquery.Schema, row map[string]any) (map[string]bigquery.Value, error) {
+	out := make(map[string]bigquery.Value, len(row))
+	for _, f := range schema {
+		v, ok := row[f.Name]
+		if !ok {
+			continue
+		}
+		d, err := decodeValue(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", f.Name, err)
+		}
+		out[f.Name] = d
+	}
+	return out, nil
+}
+
+func decodeValue(f *bigquery.FieldSchema, v any) (bigquery.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if f.Repeated {
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %T", v)
+		}
+		elem := *f
+		elem.Repeated = false
+		out := make([]bigquery.Value, len(list))
+		for i, e := range list {
+			d, err := decodeValue(&elem, e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = d
+		}
+		return out, nil
+	}
+	if f.Type == bigquery.RecordFieldType {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a record, got %T", v)
+		}
+		return decodeRow(f.Schema, m)
+	}
+	s := fmt.Sprint(v)
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		return strconv.ParseInt(s, 10, 64)
+	case bigquery.FloatFieldType:
+		return strconv.ParseFloat(s, 64)
+	case bigquery.BooleanFieldType:
+		return strconv.ParseBool(s)
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid numeric %q", s)
+		}
+		return r, nil
+	case bigquery.BytesFieldType:
+		return base64.StdEncoding.DecodeString(s)
+	case bigquery.TimestampFieldType:
+		return time.Parse(time.RFC3339Nano, s)
+	case bigquery.DateFieldType:
+		return civil.ParseDate(s)
+	case bigquery.DateTimeFieldType:
+		return civil.ParseDateTime(s)
+	case bigquery.TimeFieldType:
+		return civil.ParseTime(s)
+	case bigquery.IntervalFieldType:
+		return bigquery.ParseInterval(s)
+	}
+	return s, nil
+}
+
+// Recorder captures the calls made through the clients it wraps into a
+// cassette. Call Save to write the cassette once the calls are done.
+type Recorder struct {
+	path string
+
+	mu       sync.Mutex
+	cassette cassette
+}
+
+// NewRecorder creates a Recorder that saves to path. vars are stored in the
+// cassette and returned by ReplayClient.Vars.
+func NewRecorder(path string, vars map[string]string) *Recorder {
+	return &Recorder{path: path, cassette: cassette{Vars: vars}}
+}
+
+// Wrap returns a Client that records every call delegated to next.
+func (r *Recorder) Wrap(next Client) Client {
+	return &recordingClient{next: next, rec: r}
+}
+
+// Save writes the cassette as indented JSON.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(&r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+func (r *Recorder) add(method string, req request, resp *response, err error) {
+	in := &interaction{Method: method, Request: req, Response: resp}
+	if err != nil {
+		in.Response, in.Error = nil, recordError(err)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.mu.Unlock()
+}
+
+type recordingClient struct {
+	next Client
+	rec  *Recorder
+}
+
+func (c *recordingClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
+	schema, err := c.next.GetTableSchema(ctx, projectID, datasetID, tableID)
+	c.rec.add("GetTableSchema", request{Project: projectID, Dataset: datasetID, Table: tableID}, &response{Schema: jsonSchema(schema)}, err)
+	return schema, err
+}
+
+func (c *recordingClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	res, err := c.next.RunQuery(ctx, sql)
+	c.rec.add("RunQuery", queryRequest(ctx, sql), recordResult(res), err)
+	return res, err
+}
+
+func (c *recordingClient) ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	res, err := c.next.ExecuteQuery(ctx, sql)
+	c.rec.add("ExecuteQuery", queryRequest(ctx, sql), recordResult(res), err)
+	return res, err
+}
+
+func (c *recordingClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+	qs, err := c.next.DryRunQuery(ctx, sql)
+	c.rec.add("DryRunQuery", queryRequest(ctx, sql), &response{Query: recordQuery(qs)}, err)
+	return qs, err
+}
+
+func (c *recordingClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	tables, err := c.next.ListTables(ctx, projectID, datasetID)
+	c.rec.add("ListTables", request{Project: projectID, Dataset: datasetID}, &response{Names: tables}, err)
+	return tables, err
+}
+
+func (c *recordingClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	meta, err := c.next.GetTableMetadata(ctx, projectID, datasetID, tableID)
+	resp := &response{}
+	if meta != nil {
+		resp.Table = persistTable(meta)
+	}
+	c.rec.add("GetTableMetadata", request{Project: projectID, Dataset: datasetID, Table: tableID}, resp, err)
+	return meta, err
+}
+
+func (c *recordingClient) GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	meta, err := c.next.GetTableVersion(ctx, projectID, datasetID, tableID)
+	resp := &response{}
+	if meta != nil {
+		resp.Table = persistTable(meta)
+	}
+	c.rec.add("GetTableVersion", request{Project: projectID, Dataset: datasetID, Table: tableID}, resp, err)
+	return meta, err
+}
+
+func (c *recordingClient) ListDatasets(ctx context.Context, projectID string) ([]string, error) {
+	datasets, err := c.next.ListDatasets(ctx, projectID)
+	c.rec.add("ListDatasets", request{Project: projectID}, &response{Names: datasets}, err)
+	return datasets, err
+}
+
+func (c *recordingClient) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts ReadOptions) (*QueryResult, error) {
+	res, err := c.next.ReadTable(ctx, projectID, datasetID, tableID, opts)
+	c.rec.add("ReadTable", request{Project: projectID, Dataset: datasetID, Table: tableID, Read: &opts}, recordResult(res), err)
+	return res, err
+}
+
+func (c *recordingClient) JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error) {
+	js, err := c.next.JobStatistics(ctx, jobID, location)
+	c.rec.add("JobStatistics", request{JobID: jobID, Location: location}, &response{Job: recordJob(js)}, err)
+	return js, err
+}
+
+func (c *recordingClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	err := c.next.DeleteTable(ctx, projectID, datasetID, tableID)
+	c.rec.add("DeleteTable", request{Project: projectID, Dataset: datasetID, Table: tableID}, &response{}, err)
+	return err
+}
+
+// LoadTable records a checksum of the loaded data rather than the data.
+func (c *recordingClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error) {
+	req, data, err := newLoadRequest(projectID, datasetID, tableID, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.next.LoadTable(ctx, projectID, datasetID, tableID, data, opts)
+	c.rec.add("LoadTable", req, &response{Load: res}, err)
+	return res, err
+}
+
+// StreamQuery records the streamed rows like RunQuery does, keeping them in
+// memory until the cassette is saved.
+func (c *recordingClient) StreamQuery(ctx context.Context, sql string, w RowWriter) (*QueryResult, error) {
+	tee := &teeWriter{next: w}
+	res, err := c.next.StreamQuery(ctx, sql, tee)
+	var rec *response
+	if res != nil {
+		full := *res
+		full.Schema, full.Rows = tee.schema, tee.rows
+		rec = recordResult(&full)
+	}
+	c.rec.add("StreamQuery", queryRequest(ctx, sql), rec, err)
+	return res, err
+}
+
+// teeWriter keeps a copy of the rows it passes on.
+type teeWriter struct {
+	next   RowWriter
+	schema bigquery.Schema
+	rows   []map[string]bigquery.Value
+}
+
+func (t *teeWriter) WriteSchema(schema bigquery.Schema) error {
+	t.schema = schema
+	return t.next.WriteSchema(schema)
+}
+
+func (t *teeWriter) WriteRow(row map[string]bigquery.Value) error {
+	t.rows = append(t.rows, row)
+	return t.next.WriteRow(row)
+}
+
+// ReplayClient serves the calls recorded in a cassette without contacting
+// BigQuery. Calls are matched on method and arguments, with SQL compared
+// after whitespace normalization. Repeated identical calls are answered by
+// their recordings in order, the last one being reused once all have been
+// served. Calls without a recording fail with an error describing the
+// closest recorded calls.
+type ReplayClient struct {
+	path     string
+	cassette cassette
+
+	mu sync.Mutex
+}
+
+// NewReplayClient loads the cassette at path.
+func NewReplayClient(path string) (*ReplayClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ReplayClient{path: path}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&c.cassette); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Vars returns the values stored with the cassette.
+func (c *ReplayClient) Vars() map[string]string {
+	return c.cassette.Vars
+}
+
+// Unused describes the recorded calls that have not been replayed.
+func (c *ReplayClient) Unused() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []string
+	for _, in := range c.cassette.Interactions {
+		if !in.used {
+			out = append(out, in.Method+"("+in.Request.String()+")")
+		}
+	}
+	return out
+}
+
+func (c *ReplayClient) replay(method string, req request) (*response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := req.key()
+	var last *interaction
+	for _, in := range c.cassette.Interactions {
+		if in.Method != method || in.Request.key() != key {
+			continue
+		}
+		last = in
+		if !in.used {
+			break
+		}
+	}
+	if last == nil {
+		return nil, c.mismatch(method, req)
+	}
+	last.used = true
+	if last.Error != nil {
+		return nil, last.Error.err()
+	}
+	if last.Response == nil {
+		return &response{}, nil
+	}
+	return last.Response, nil
+}
+
+// maxCandidates bounds the number of recorded calls listed in mismatch
+// errors.
+const maxCandidates = 3
+
+// mismatch describes the recorded calls of method closest to req.
+func (c *ReplayClient) mismatch(method string, req request) error {
+	want := req.String()
+	type candidate struct {
+		desc string
+		dist int
+	}
+	var cands []candidate
+	for _, in := range c.cassette.Interactions {
+		if in.Method != method {
+			continue
+		}
+		got := in.Request.String()
+		cands = append(cands, candidate{got, distance(want, got)})
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "cassette %s: no recorded %s(%s)", c.path, method, want)
+	if len(cands) == 0 {
+		fmt.Fprintf(&b, "; no %s calls were recorded", method)
+		return errors.New(b.String())
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].dist < cands[j].dist })
+	if len(cands) > maxCandidates {
+		cands = cands[:maxCandidates]
+	}
+	b.WriteString("; closest recorded calls:")
+	for _, cand := range cands {
+		fmt.Fprintf(&b, "\n  %s(%s)\n    differs at: %s", method, cand.desc, firstDifference(want, cand.desc))
+	}
+	return errors.New(b.String())
+}
+
+// firstDifference quotes the text around the first position where a and b
+// differ.
+func firstDifference(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	const around = 20
+	start := max(i-around, 0)
+	return fmt.Sprintf("offset %d: requested …%s… recorded …%s…", i, a[start:min(i+around, len(a))], b[start:min(i+around, len(b))])
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func (c *ReplayClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
+	resp, err := c.replay("GetTableSchema", request{Project: projectID, Dataset: datasetID, Table: tableID})
+	if err != nil {
+		return nil, err
+	}
+	return bigquery.Schema(resp.Schema), nil
+}
+
+func (c *ReplayClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	resp, err := c.replay("RunQuery", queryRequest(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	return resp.result()
+}
+
+func (c *ReplayClient) ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	resp, err := c.replay("ExecuteQuery", queryRequest(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	return resp.result()
+}
+
+func (c *ReplayClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+	resp, err := c.replay("DryRunQuery", queryRequest(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Query.statistics(), nil
+}
+
+func (c *ReplayClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	resp, err := c.replay("ListTables", request{Project: projectID, Dataset: datasetID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Names, nil
+}
+
+func (c *ReplayClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	resp, err := c.replay("GetTableMetadata", request{Project: projectID, Dataset: datasetID, Table: tableID})
+	if err != nil || resp.Table == nil {
+		return nil, err
+	}
+	return resp.Table.metadata(), nil
+}
+
+func (c *ReplayClient) GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	resp, err := c.replay("GetTableVersion", request{Project: projectID, Dataset: datasetID, Table: tableID})
+	if err != nil || resp.Table == nil {
+		return nil, err
+	}
+	return resp.Table.metadata(), nil
+}
+
+func (c *ReplayClient) ListDatasets(ctx context.Context, projectID string) ([]string, error) {
+	resp, err := c.replay("ListDatasets", request{Project: projectID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Names, nil
+}
+
+func (c *ReplayClient) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts ReadOptions) (*QueryResult, error) {
+	resp, err := c.replay("ReadTable", request{Project: projectID, Dataset: datasetID, Table: tableID, Read: &opts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.result()
+}
+
+func (c *ReplayClient) JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error) {
+	resp, err := c.replay("JobStatistics", request{JobID: jobID, Location: location})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Job.statistics(), nil
+}
+
+func (c *ReplayClient) StreamQuery(ctx context.Context, sql string, w RowWriter) (*QueryResult, error) {
+	resp, err := c.replay("StreamQuery", queryRequest(ctx, sql))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resp.result()
+	if err != nil {
+		return nil, err
+	}
+	return WriteResult(res, w)
+}
+
+func (c *ReplayClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error) {
+	req, _, err := newLoadRequest(projectID, datasetID, tableID, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.replay("LoadTable", req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Load, nil
+}
+
+func (c *ReplayClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	_, err := c.replay("DeleteTable", request{Project: projectID, Dataset: datasetID, Table: tableID})
+	return err
+}
@@ -0,0 +1,195 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/googleapi"
+)
+
+func TestRecorderReplayRoundTrip(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "score", Type: bigquery.FloatFieldType},
+		{Name: "price", Type: bigquery.NumericFieldType},
+		{Name: "day", Type: bigquery.DateFieldType},
+		{Name: "at", Type: bigquery.TimestampFieldType},
+		{Name: "raw", Type: bigquery.BytesFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "addr", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{{Name: "city", Type: bigquery.StringFieldType}}},
+	}
+	rows := []map[string]bigquery.Value{{
+		"id":    int64(1),
+		"score": 1.5,
+		"price": big.NewRat(5, 2),
+		"day":   civil.Date{Year: 2024, Month: 1, Day: 2},
+		"at":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"raw":   []byte("hi"),
+		"tags":  []bigquery.Value{"a", "b"},
+		"addr":  map[string]bigquery.Value{"city": "Tokyo"},
+	}}
+	next := &MockClient{
+		QuerySchemaRes: schema,
+		QueryRes:       rows,
+		DryRunRes:      &bigquery.QueryStatistics{TotalBytesProcessed: 42, ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "t"}}},
+		TablesRes:      []string{"t1", "t2"},
+		MetadataRes:    &bigquery.TableMetadata{Schema: schema, NumRows: 1},
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewRecorder(path, map[string]string{"table": "t"})
+	c := rec.Wrap(next)
+	ctx := context.Background()
+	if _, err := c.RunQuery(ctx, "SELECT  *\nFROM t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DryRunQuery(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListTables(ctx, "p", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetTableMetadata(ctx, "p", "d", "t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.StreamQuery(ctx, "SELECT * FROM t", &rowCollector{}); err != nil {
+		t.Fatal(err)
+	}
+	dst := &Destination{Project: "p", Dataset: "d", Table: "copy", Expiration: time.Now().Add(time.Hour)}
+	if _, err := c.RunQuery(WithQueryConfig(ctx, QueryConfig{Destination: dst}), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteTable(ctx, "p", "d", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Vars()["table"] != "t" {
+		t.Errorf("vars = %v", replay.Vars())
+	}
+	res, err := replay.RunQuery(ctx, "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := res.Rows[0]
+	if got["price"].(*big.Rat).Cmp(big.NewRat(5, 2)) != 0 {
+		t.Errorf("price = %v", got["price"])
+	}
+	delete(got, "price")
+	want := rows[0]
+	for k, v := range want {
+		if k != "price" && !reflect.DeepEqual(got[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, got[k], v)
+		}
+	}
+	if unused := replay.Unused(); len(unused) != 6 {
+		t.Errorf("unused = %v", unused)
+	}
+	qs, err := replay.DryRunQuery(ctx, "SELECT 1")
+	if err != nil || qs.TotalBytesProcessed != 42 || qs.ReferencedTables[0].TableID != "t" {
+		t.Errorf("DryRunQuery = %+v, %v", qs, err)
+	}
+	tables, err := replay.ListTables(ctx, "p", "d")
+	if err != nil || !reflect.DeepEqual(tables, []string{"t1", "t2"}) {
+		t.Errorf("ListTables = %v, %v", tables, err)
+	}
+	meta, err := replay.GetTableMetadata(ctx, "p", "d", "t")
+	if err != nil || meta.NumRows != 1 || len(meta.Schema) != len(schema) {
+		t.Errorf("GetTableMetadata = %+v, %v", meta, err)
+	}
+	var streamed rowCollector
+	sres, err := replay.StreamQuery(ctx, "SELECT * FROM t", &streamed)
+	if err != nil || sres.TotalRows != 1 || len(streamed.rows) != 1 || len(streamed.schema) != len(schema) || sres.Rows != nil {
+		t.Errorf("StreamQuery = %+v, %v; streamed %+v", sres, err, streamed)
+	}
+	dst.Expiration = dst.Expiration.Add(time.Minute)
+	if _, err := replay.RunQuery(WithQueryConfig(ctx, QueryConfig{Destination: dst}), "SELECT 1"); err != nil {
+		t.Errorf("RunQuery with destination: %v", err)
+	}
+	if err := replay.DeleteTable(ctx, "p", "d", "copy"); err != nil {
+		t.Errorf("DeleteTable: %v", err)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Errorf("unused = %v", unused)
+	}
+}
+
+type rowCollector struct {
+	schema bigquery.Schema
+	rows   []map[string]bigquery.Value
+}
+
+func (c *rowCollector) WriteSchema(schema bigquery.Schema) error {
+	c.schema = schema
+	return nil
+}
+
+func (c *rowCollector) WriteRow(row map[string]bigquery.Value) error {
+	c.rows = append(c.rows, row)
+	return nil
+}
+
+func TestReplayRecordedError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewRecorder(path, nil)
+	ctx := context.Background()
+	rec.Wrap(&MockClient{Err: &googleapi.Error{Code: 404, Message: "not found"}}).GetTableSchema(ctx, "p", "d", "missing")
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replay.GetTableSchema(ctx, "p", "d", "missing")
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 404 {
+		t.Errorf("err = %v, want a 404 API error", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewRecorder(path, nil)
+	c := rec.Wrap(&MockClient{})
+	ctx := context.Background()
+	c.RunQuery(ctx, "SELECT id FROM `p.d.users` WHERE id = 1")
+	c.RunQuery(ctx, "SELECT name FROM `p.d.orders`")
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replay.RunQuery(ctx, "SELECT id FROM `p.d.users` WHERE id = 2")
+	if err == nil {
+		t.Fatal("expected a mismatch error")
+	}
+	msg := err.Error()
+	for _, want := range []string{"no recorded RunQuery", "closest recorded calls", "WHERE id = 1", "differs at"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+	if strings.Index(msg, "users` WHERE id = 1") > strings.Index(msg, "orders") {
+		t.Errorf("closest call is not listed first: %s", msg)
+	}
+	_, err = replay.ListDatasets(ctx, "p")
+	if err == nil || !strings.Contains(err.Error(), "no ListDatasets calls were recorded") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -3,32 +3,202 @@ package bigquery
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/bigquery"
+	bqapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
 type Client interface {
 	GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error)
-	RunQuery(ctx context.Context, sql string) ([]map[string]bigquery.Value, error)
+	RunQuery(ctx context.Context, sql string) (*QueryResult, error)
 	DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error)
 	ListTables(ctx context.Context, projectID, datasetID string) ([]string, error)
+	GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error)
+	GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error)
+	ListDatasets(ctx context.Context, projectID string) ([]string, error)
+	ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts ReadOptions) (*QueryResult, error)
+	JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error)
+	StreamQuery(ctx context.Context, sql string, w RowWriter) (*QueryResult, error)
+	ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error)
+	LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error)
+	DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error
+}
+
+// RowWriter consumes the rows of a query streamed by StreamQuery. WriteSchema
+// is called once, before the first row.
+type RowWriter interface {
+	WriteSchema(schema bigquery.Schema) error
+	WriteRow(row map[string]bigquery.Value) error
+}
+
+// WriteResult streams the rows of res to w and returns res without its rows,
+// with TotalRows set to the number of rows written. It lets clients holding
+// results in memory implement StreamQuery.
+func WriteResult(res *QueryResult, w RowWriter) (*QueryResult, error) {
+	if err := w.WriteSchema(res.Schema); err != nil {
+		return nil, err
+	}
+	for _, row := range res.Rows {
+		if err := w.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	out := *res
+	out.Rows, out.TotalRows = nil, uint64(len(res.Rows))
+	return &out, nil
+}
+
+// ReadOptions selects the rows and columns returned by ReadTable.
+type ReadOptions struct {
+	// StartIndex is the zero-based index of the first row to read.
+	StartIndex uint64
+	// MaxRows bounds the number of rows read.
+	MaxRows int
+	// Fields restricts the returned columns to the named top-level fields.
+	// All columns are returned when empty.
+	Fields []string
+}
+
+// QueryResult holds the rows returned by a query together with the result
+// schema, which describes column order and types. CacheHit reports whether
+// the result was served from a local result cache. TotalRows is set by
+// ReadTable to the number of rows in the table, which may exceed len(Rows).
+// JobID and Location identify the query job, when one was run. SessionID
+// is the BigQuery session the query ran in, if any. Statements holds the
+// results of the statements of a multi-statement script, in order.
+type QueryResult struct {
+	Schema     bigquery.Schema
+	Rows       []map[string]bigquery.Value
+	CacheHit   bool
+	TotalRows  uint64
+	JobID      string
+	Location   string
+	SessionID  string
+	Statements []*StatementResult
+}
+
+// StatementResult is the result of one statement of a script, run by BigQuery
+// as a child job of the script job. Rows are read for statements returning a
+// result, up to MaxStatementRows; TotalRows is the full row count.
+type StatementResult struct {
+	JobID              string
+	StatementType      string
+	Schema             bigquery.Schema
+	Rows               []map[string]bigquery.Value
+	TotalRows          uint64
+	NumDMLAffectedRows int64
+}
+
+// LoadOptions configures the load job run by LoadTable.
+type LoadOptions struct {
+	// Format is the format of the data: CSV, NEWLINE_DELIMITED_JSON or
+	// PARQUET.
+	Format bigquery.DataFormat `json:"format"`
+	// Schema is the schema of the table. When nil, BigQuery detects the
+	// schema of CSV and JSON data; Parquet files carry their own schema.
+	Schema bigquery.Schema `json:"-"`
+	// SkipLeadingRows is the number of CSV header lines.
+	SkipLeadingRows int64 `json:"skip_leading_rows,omitempty"`
+	// WriteDisposition decides what happens to the rows of an existing
+	// table. The table is created when it does not exist.
+	WriteDisposition bigquery.TableWriteDisposition `json:"write_disposition,omitempty"`
+	// Expiration, when set, is the expiration time of the table.
+	Expiration time.Time `json:"expiration,omitzero"`
+}
+
+// LoadResult describes a completed load job.
+type LoadResult struct {
+	JobID       string `json:"job_id"`
+	Location    string `json:"location,omitempty"`
+	OutputRows  int64  `json:"output_rows"`
+	OutputBytes int64  `json:"output_bytes"`
+}
+
+// MaxStatementRows bounds the rows read for each statement of a script.
+const MaxStatementRows = 1000
+
+// QueryConfig holds per-call settings of query jobs. The location and labels
+// also apply to the jobs run by LoadTable. DefaultDataset, with
+// DefaultProject, resolves unqualified table names; Location overrides the
+// client location; Labels are attached to the job. SessionID runs the query
+// in an existing BigQuery session, while CreateSession starts a new one whose
+// ID is reported in QueryResult.SessionID. Dry runs never create sessions.
+// Labels are sanitized with SanitizeLabels; TagSQL also lists them in a
+// comment prepended to the SQL. Destination makes RunQuery write the result
+// to a table instead of returning rows.
+type QueryConfig struct {
+	DefaultProject string            `json:"default_project,omitempty"`
+	DefaultDataset string            `json:"default_dataset,omitempty"`
+	Location       string            `json:"location,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	SessionID      string            `json:"session_id,omitempty"`
+	CreateSession  bool              `json:"create_session,omitempty"`
+	TagSQL         bool              `json:"tag_sql,omitempty"`
+	Destination    *Destination      `json:"destination,omitempty"`
+}
+
+// Destination is a table query results are written to. The table is created
+// when it does not exist; WriteDisposition decides what happens to the rows
+// of an existing table. Expiration, when set, is the expiration time of the
+// table.
+type Destination struct {
+	Project          string                         `json:"project"`
+	Dataset          string                         `json:"dataset"`
+	Table            string                         `json:"table"`
+	WriteDisposition bigquery.TableWriteDisposition `json:"write_disposition,omitempty"`
+	Expiration       time.Time                      `json:"expiration,omitzero"`
+}
+
+func (c QueryConfig) isZero() bool {
+	return c.DefaultProject == "" && c.DefaultDataset == "" && c.Location == "" && len(c.Labels) == 0 &&
+		c.SessionID == "" && !c.CreateSession && !c.TagSQL && c.Destination == nil
+}
+
+// inSession reports whether queries run in a BigQuery session, where they
+// may depend on session state such as temporary tables.
+func (c QueryConfig) inSession() bool {
+	return c.SessionID != "" || c.CreateSession
+}
+
+type queryConfigKey struct{}
+
+// WithQueryConfig returns a context that makes RunQuery and DryRunQuery use
+// cfg for their jobs.
+func WithQueryConfig(ctx context.Context, cfg QueryConfig) context.Context {
+	return context.WithValue(ctx, queryConfigKey{}, cfg)
+}
+
+// QueryConfigFrom returns the query settings attached to ctx by
+// WithQueryConfig.
+func QueryConfigFrom(ctx context.Context) QueryConfig {
+	cfg, _ := ctx.Value(queryConfigKey{}).(QueryConfig)
+	return cfg
 }
 
 type realClient struct {
 	client *bigquery.Client
+	opts   []option.ClientOption
 }
 
-func NewClient(ctx context.Context, projectID string) (Client, error) {
-	c, err := bigquery.NewClient(ctx, projectID)
+// NewClient creates a client for projectID. opts are passed to the BigQuery
+// client, e.g. to point it at an emulator with option.WithEndpoint.
+func NewClient(ctx context.Context, projectID string, opts ...option.ClientOption) (Client, error) {
+	c, err := bigquery.NewClient(ctx, projectID, opts...)
 	if err != nil {
 		return nil, err
 	}
 	if loc := os.Getenv("BQ_REGION"); loc != "" {
 		c.Location = loc
 	}
-	return &realClient{client: c}, nil
+	return &realClient{client: c, opts: opts}, nil
 }
 
 func (r *realClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
@@ -40,9 +210,16 @@ func (r *realClient) GetTableSchema(ctx context.Context, projectID, datasetID, t
 	return meta.Schema, nil
 }
 
-func (r *realClient) RunQuery(ctx context.Context, sql string) ([]map[string]bigquery.Value, error) {
-	q := r.client.Query(sql)
-	it, err := q.Read(ctx)
+func (r *realClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	q := r.query(ctx, sql)
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dst := QueryConfigFrom(ctx).Destination; dst != nil {
+		return r.writeDestination(ctx, job, dst)
+	}
+	it, err := job.Read(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -59,12 +236,249 @@ func (r *realClient) RunQuery(ctx context.Context, sql string) ([]map[string]big
 		}
 		results = append(results, row)
 	}
-	return results, nil
+	res := &QueryResult{Schema: it.Schema, Rows: results, JobID: job.ID(), Location: job.Location()}
+	if status := job.LastStatus(); status != nil && status.Statistics != nil {
+		if info := status.Statistics.SessionInfo; info != nil {
+			res.SessionID = info.SessionID
+		}
+		if status.Statistics.NumChildJobs > 0 {
+			if res.Statements, err = r.statements(ctx, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if res.SessionID == "" {
+		res.SessionID = QueryConfigFrom(ctx).SessionID
+	}
+	return res, nil
 }
 
-func (r *realClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+// StreamQuery runs sql like RunQuery but hands each row to w as it is read
+// instead of collecting the rows, so that results of any size can be
+// consumed. The returned result has no rows; TotalRows is the number of rows
+// written.
+func (r *realClient) StreamQuery(ctx context.Context, sql string, w RowWriter) (*QueryResult, error) {
+	q := r.query(ctx, sql)
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	it, err := job.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	for {
+		row := make(map[string]bigquery.Value)
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The schema is known once the first page has been fetched.
+		if n == 0 {
+			if err := w.WriteSchema(it.Schema); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.WriteRow(row); err != nil {
+			return nil, err
+		}
+		n++
+	}
+	if n == 0 {
+		if err := w.WriteSchema(it.Schema); err != nil {
+			return nil, err
+		}
+	}
+	res := &QueryResult{Schema: it.Schema, TotalRows: n, JobID: job.ID(), Location: job.Location()}
+	if status := job.LastStatus(); status != nil && status.Statistics != nil && status.Statistics.SessionInfo != nil {
+		res.SessionID = status.Statistics.SessionInfo.SessionID
+	}
+	return res, nil
+}
+
+// ExecuteQuery runs sql and waits for the job to finish without reading its
+// rows. The returned result only identifies the job and its session.
+func (r *realClient) ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	job, err := r.query(ctx, sql).Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.wait(ctx, job)
+}
+
+// wait waits for a query job and returns the result identifying it.
+func (r *realClient) wait(ctx context.Context, job *bigquery.Job) (*QueryResult, error) {
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	res := &QueryResult{JobID: job.ID(), Location: job.Location(), SessionID: QueryConfigFrom(ctx).SessionID}
+	if status.Statistics != nil && status.Statistics.SessionInfo != nil {
+		res.SessionID = status.Statistics.SessionInfo.SessionID
+	}
+	return res, nil
+}
+
+// writeDestination waits for a query job writing to dst and sets the
+// expiration of the table. The rows are left in the table.
+func (r *realClient) writeDestination(ctx context.Context, job *bigquery.Job, dst *Destination) (*QueryResult, error) {
+	res, err := r.wait(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if !dst.Expiration.IsZero() {
+		tbl := r.client.DatasetInProject(dst.Project, dst.Dataset).Table(dst.Table)
+		if _, err := tbl.Update(ctx, bigquery.TableMetadataToUpdate{ExpirationTime: dst.Expiration}, ""); err != nil {
+			return nil, fmt.Errorf("set expiration of %s: %w", dst.Table, err)
+		}
+	}
+	return res, nil
+}
+
+// statements reads the results of the child jobs of a script job, ordered
+// by creation time.
+func (r *realClient) statements(ctx context.Context, parent *bigquery.Job) ([]*StatementResult, error) {
+	it := r.client.Jobs(ctx)
+	it.ProjectID = parent.ProjectID()
+	it.ParentJobID = parent.ID()
+	var children []*bigquery.Job
+	for {
+		job, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, job)
+	}
+	created := func(j *bigquery.Job) time.Time {
+		if s := j.LastStatus(); s != nil && s.Statistics != nil {
+			return s.Statistics.CreationTime
+		}
+		return time.Time{}
+	}
+	sort.SliceStable(children, func(i, j int) bool { return created(children[i]).Before(created(children[j])) })
+	var out []*StatementResult
+	for _, job := range children {
+		st := &StatementResult{JobID: job.ID()}
+		if s := job.LastStatus(); s != nil && s.Statistics != nil {
+			if qs, ok := s.Statistics.Details.(*bigquery.QueryStatistics); ok {
+				st.StatementType = qs.StatementType
+				st.NumDMLAffectedRows = qs.NumDMLAffectedRows
+			}
+		}
+		if st.StatementType == "SELECT" {
+			it, err := job.Read(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for len(st.Rows) < MaxStatementRows {
+				row := make(map[string]bigquery.Value)
+				err := it.Next(&row)
+				if err == iterator.Done {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				st.Rows = append(st.Rows, row)
+			}
+			st.Schema, st.TotalRows = it.Schema, it.TotalRows
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// query creates a query applying the settings attached to ctx.
+func (r *realClient) query(ctx context.Context, sql string) *bigquery.Query {
+	cfg := QueryConfigFrom(ctx)
+	labels := SanitizeLabels(cfg.Labels)
+	if cfg.TagSQL {
+		sql = tagSQL(sql, labels)
+	}
 	q := r.client.Query(sql)
+	if cfg.DefaultDataset != "" {
+		q.DefaultProjectID = cfg.DefaultProject
+		q.DefaultDatasetID = cfg.DefaultDataset
+	}
+	if cfg.Location != "" {
+		q.Location = cfg.Location
+	}
+	if len(labels) > 0 {
+		q.Labels = labels
+	}
+	if cfg.SessionID != "" {
+		q.ConnectionProperties = append(q.ConnectionProperties, &bigquery.ConnectionProperty{Key: "session_id", Value: cfg.SessionID})
+	} else if cfg.CreateSession {
+		q.CreateSession = true
+	}
+	if dst := cfg.Destination; dst != nil {
+		q.Dst = r.client.DatasetInProject(dst.Project, dst.Dataset).Table(dst.Table)
+		q.CreateDisposition = bigquery.CreateIfNeeded
+		q.WriteDisposition = dst.WriteDisposition
+	}
+	return q
+}
+
+// LoadTable uploads data to a table with a load job and waits for the job to
+// complete. The location and labels of the job are taken from the
+// QueryConfig attached to ctx.
+func (r *realClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error) {
+	src := bigquery.NewReaderSource(data)
+	src.SourceFormat = opts.Format
+	src.Schema = opts.Schema
+	src.AutoDetect = opts.Schema == nil && opts.Format != bigquery.Parquet
+	src.SkipLeadingRows = opts.SkipLeadingRows
+	tbl := r.client.DatasetInProject(projectID, datasetID).Table(tableID)
+	l := tbl.LoaderFrom(src)
+	l.CreateDisposition = bigquery.CreateIfNeeded
+	l.WriteDisposition = opts.WriteDisposition
+	cfg := QueryConfigFrom(ctx)
+	if cfg.Location != "" {
+		l.Location = cfg.Location
+	}
+	if labels := SanitizeLabels(cfg.Labels); len(labels) > 0 {
+		l.Labels = labels
+	}
+	job, err := l.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	res := &LoadResult{JobID: job.ID(), Location: job.Location()}
+	if status.Statistics != nil {
+		if ls, ok := status.Statistics.Details.(*bigquery.LoadStatistics); ok {
+			res.OutputRows, res.OutputBytes = ls.OutputRows, ls.OutputBytes
+		}
+	}
+	if !opts.Expiration.IsZero() {
+		if _, err := tbl.Update(ctx, bigquery.TableMetadataToUpdate{ExpirationTime: opts.Expiration}, ""); err != nil {
+			return nil, fmt.Errorf("set expiration of %s: %w", tableID, err)
+		}
+	}
+	return res, nil
+}
+
+func (r *realClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+	q := r.query(ctx, sql)
 	q.DryRun = true
+	q.CreateSession = false
+	q.Dst = nil
 	job, err := q.Run(ctx)
 	if err != nil {
 		return nil, err
@@ -80,6 +494,10 @@ func (r *realClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.Que
 	return qs, nil
 }
 
+func (r *realClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	return r.client.DatasetInProject(projectID, datasetID).Table(tableID).Delete(ctx)
+}
+
 func (r *realClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
 	it := r.client.DatasetInProject(projectID, datasetID).Tables(ctx)
 	var tables []string
@@ -95,3 +513,119 @@ func (r *realClient) ListTables(ctx context.Context, projectID, datasetID string
 	}
 	return tables, nil
 }
+
+func (r *realClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	return r.client.DatasetInProject(projectID, datasetID).Table(tableID).Metadata(ctx)
+}
+
+// GetTableVersion returns metadata holding only the ETag and last modified
+// time of a table. The client library cannot select fields, so the table is
+// read through the REST API with a partial response.
+func (r *realClient) GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	svc, err := bqapi.NewService(ctx, r.opts...)
+	if err != nil {
+		return nil, err
+	}
+	t, err := svc.Tables.Get(projectID, datasetID, tableID).Fields("etag", "lastModifiedTime").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return &bigquery.TableMetadata{ETag: t.Etag, LastModifiedTime: time.UnixMilli(int64(t.LastModifiedTime))}, nil
+}
+
+func (r *realClient) ListDatasets(ctx context.Context, projectID string) ([]string, error) {
+	it := r.client.Datasets(ctx)
+	it.ProjectID = projectID
+	var datasets []string
+	for {
+		ds, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, ds.DatasetID)
+	}
+	return datasets, nil
+}
+
+// ReadTable reads rows directly from table storage through the tabledata API,
+// which does not run a query job and is not billed. tableID may carry a
+// partition decorator such as "events$20240101".
+func (r *realClient) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts ReadOptions) (*QueryResult, error) {
+	it := r.client.DatasetInProject(projectID, datasetID).Table(tableID).Read(ctx)
+	it.StartIndex = opts.StartIndex
+	if opts.MaxRows > 0 {
+		it.PageInfo().MaxSize = opts.MaxRows
+	}
+	var rows []map[string]bigquery.Value
+	for opts.MaxRows <= 0 || len(rows) < opts.MaxRows {
+		row := make(map[string]bigquery.Value)
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	schema, err := selectFields(it.Schema, opts.Fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Fields) > 0 {
+		for i, row := range rows {
+			selected := make(map[string]bigquery.Value, len(schema))
+			for _, f := range schema {
+				selected[f.Name] = row[f.Name]
+			}
+			rows[i] = selected
+		}
+	}
+	return &QueryResult{Schema: schema, Rows: rows, TotalRows: it.TotalRows}, nil
+}
+
+// selectFields returns the top-level fields of schema named in fields, in the
+// requested order. The whole schema is returned when fields is empty.
+func selectFields(schema bigquery.Schema, fields []string) (bigquery.Schema, error) {
+	if len(fields) == 0 {
+		return schema, nil
+	}
+	byName := make(map[string]*bigquery.FieldSchema, len(schema))
+	for _, f := range schema {
+		byName[strings.ToLower(f.Name)] = f
+	}
+	out := make(bigquery.Schema, 0, len(fields))
+	for _, name := range fields {
+		f, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// JobStatistics fetches the statistics of a job, including the query plan
+// and timeline of query jobs. jobID is either a plain job ID in the client
+// project or a fully qualified "project:location.job_id" reference.
+func (r *realClient) JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error) {
+	projectID := r.client.Project()
+	if p, rest, ok := strings.Cut(jobID, ":"); ok {
+		projectID, jobID = p, rest
+		if loc, id, ok := strings.Cut(rest, "."); ok {
+			location, jobID = loc, id
+		}
+	}
+	job, err := r.client.JobFromProject(ctx, projectID, jobID, location)
+	if err != nil {
+		return nil, err
+	}
+	status := job.LastStatus()
+	if status == nil || status.Statistics == nil {
+		return nil, errors.New("no job statistics")
+	}
+	return status.Statistics, nil
+}
@@ -0,0 +1,783 @@
+// Package fake provides FakeClient, an in-memory implementation of
+// bigquery.Client for tests. Tables are loaded from fixture files into an
+// embedded SQLite database and GoogleSQL queries are translated to SQLite, so
+// filters, joins, aggregations and limits behave like they would against
+// BigQuery for the common subset of the language.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/googleapi"
+	_ "modernc.org/sqlite"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Fixture is the content of a fixture file: datasets with their tables,
+// schemas and rows.
+type Fixture struct {
+	// Project defaults to the project of the client.
+	Project  string           `json:"project,omitempty"`
+	Datasets []FixtureDataset `json:"datasets"`
+}
+
+type FixtureDataset struct {
+	ID     string         `json:"id"`
+	Tables []FixtureTable `json:"tables"`
+}
+
+// FixtureTable defines one table. Schema uses the JSON schema format of the
+// bq command line tool. Row values are JSON values; BYTES are base64 encoded,
+// temporal types are strings in their canonical GoogleSQL format and RECORD
+// fields are objects.
+type FixtureTable struct {
+	ID             string            `json:"id"`
+	Description    string            `json:"description,omitempty"`
+	Schema         json.RawMessage   `json:"schema"`
+	PartitionField string            `json:"partition_field,omitempty"`
+	Clustering     []string          `json:"clustering,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Rows           []map[string]any  `json:"rows"`
+}
+
+// FakeClient implements bigquery.Client on top of SQLite. It is safe for
+// concurrent use.
+type FakeClient struct {
+	// MaxBytesBilled makes RunQuery fail like BigQuery does when the
+	// estimated bytes of a query exceed it. Zero disables the limit.
+	MaxBytesBilled int64
+
+	project string
+	db      *sql.DB
+	loaded  time.Time
+
+	mu     sync.Mutex
+	tables map[string]*table // keyed by lower-cased "project.dataset.table"
+	jobs   map[string]*bigquery.JobStatistics
+}
+
+type table struct {
+	project, dataset, id string
+	meta                 *bigquery.TableMetadata
+	// columnBytes holds the logical size of every top-level column, used
+	// for dry-run estimates.
+	columnBytes map[string]int64
+}
+
+func (t *table) key() string {
+	return strings.ToLower(t.project + "." + t.dataset + "." + t.id)
+}
+
+// sqlName is the name of the SQLite table holding the rows of t.
+func (t *table) sqlName() string {
+	return t.project + "." + t.dataset + "." + t.id
+}
+
+var _ bq.Client = (*FakeClient)(nil)
+
+// New returns a FakeClient for project loaded with the fixture files at
+// paths.
+func New(project string, paths ...string) (*FakeClient, error) {
+	var fixtures []Fixture
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var f Fixture
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", p, err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return NewFromFixtures(project, fixtures...)
+}
+
+// NewFromFixtures returns a FakeClient for project loaded with fixtures.
+func NewFromFixtures(project string, fixtures ...Fixture) (*FakeClient, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to ":memory:" opens a separate database.
+	db.SetMaxOpenConns(1)
+	c := &FakeClient{
+		project: project,
+		db:      db,
+		loaded:  time.Now(),
+		tables:  make(map[string]*table),
+		jobs:    make(map[string]*bigquery.JobStatistics),
+	}
+	for _, f := range fixtures {
+		p := f.Project
+		if p == "" {
+			p = project
+		}
+		for _, ds := range f.Datasets {
+			for _, ft := range ds.Tables {
+				if err := c.load(p, ds.ID, ft); err != nil {
+					db.Close()
+					return nil, fmt.Errorf("table %s.%s: %w", ds.ID, ft.ID, err)
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// Close releases the database.
+func (c *FakeClient) Close() error {
+	return c.db.Close()
+}
+
+func (c *FakeClient) load(project, dataset string, ft FixtureTable) error {
+	schema, err := bigquery.SchemaFromJSON(ft.Schema)
+	if err != nil {
+		return err
+	}
+	t := &table{project: project, dataset: dataset, id: ft.ID, columnBytes: make(map[string]int64)}
+	cols := make([]string, len(schema))
+	for i, f := range schema {
+		cols[i] = quoteIdent(f.Name) + " " + declType(f)
+	}
+	if _, err := c.db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(t.sqlName()), strings.Join(cols, ", "))); err != nil {
+		return err
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(schema)), ", ")
+	insert := fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdent(t.sqlName()), marks)
+	var total int64
+	for n, row := range ft.Rows {
+		args := make([]any, len(schema))
+		for i, f := range schema {
+			v, err := storeValue(f, row[f.Name])
+			if err != nil {
+				return fmt.Errorf("row %d: field %s: %w", n, f.Name, err)
+			}
+			args[i] = v
+			size := valueBytes(f, row[f.Name])
+			t.columnBytes[strings.ToLower(f.Name)] += size
+			total += size
+		}
+		if _, err := c.db.Exec(insert, args...); err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+	}
+	t.meta = &bigquery.TableMetadata{
+		Name:             ft.ID,
+		Description:      ft.Description,
+		FullID:           fmt.Sprintf("%s:%s.%s", project, dataset, ft.ID),
+		Type:             bigquery.RegularTable,
+		Schema:           schema,
+		Labels:           ft.Labels,
+		NumRows:          uint64(len(ft.Rows)),
+		NumBytes:         total,
+		CreationTime:     c.loaded,
+		LastModifiedTime: c.loaded,
+		Location:         "US",
+	}
+	if ft.PartitionField != "" {
+		t.meta.TimePartitioning = &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: ft.PartitionField}
+	}
+	if len(ft.Clustering) > 0 {
+		t.meta.Clustering = &bigquery.Clustering{Fields: ft.Clustering}
+	}
+	c.tables[t.key()] = t
+	return nil
+}
+
+func (c *FakeClient) table(projectID, datasetID, tableID string) (*table, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[strings.ToLower(projectID+"."+datasetID+"."+tableID)]
+	if !ok {
+		return nil, &googleapi.Error{Code: 404, Message: fmt.Sprintf("Not found: Table %s:%s.%s", projectID, datasetID, tableID)}
+	}
+	return t, nil
+}
+
+func (c *FakeClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
+	t, err := c.table(projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	return t.meta.Schema, nil
+}
+
+func (c *FakeClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	t, err := c.table(projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	meta := *t.meta
+	return &meta, nil
+}
+
+func (c *FakeClient) GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	t, err := c.table(projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	return &bigquery.TableMetadata{ETag: t.meta.ETag, LastModifiedTime: t.meta.LastModifiedTime}, nil
+}
+
+func (c *FakeClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	found := false
+	for _, t := range c.tables {
+		if strings.EqualFold(t.project, projectID) && strings.EqualFold(t.dataset, datasetID) {
+			ids = append(ids, t.id)
+			found = true
+		}
+	}
+	if !found {
+		return nil, &googleapi.Error{Code: 404, Message: fmt.Sprintf("Not found: Dataset %s:%s", projectID, datasetID)}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (c *FakeClient) ListDatasets(ctx context.Context, projectID string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := map[string]bool{}
+	var ids []string
+	for _, t := range c.tables {
+		if strings.EqualFold(t.project, projectID) && !seen[t.dataset] {
+			seen[t.dataset] = true
+			ids = append(ids, t.dataset)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ReadTable reads rows in insertion order. A "$YYYYMMDD" partition
+// decorator selects the rows of one day of a partitioned table.
+func (c *FakeClient) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts bq.ReadOptions) (*bq.QueryResult, error) {
+	tableID, partition, _ := strings.Cut(tableID, "$")
+	t, err := c.table(projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	where, args := "", []any{}
+	if partition != "" {
+		tp := t.meta.TimePartitioning
+		if tp == nil || tp.Field == "" || len(partition) != 8 {
+			return nil, &googleapi.Error{Code: 400, Message: fmt.Sprintf("Invalid partition decorator %q", partition)}
+		}
+		where = fmt.Sprintf(" WHERE substr(%s, 1, 10) = ?", quoteIdent(tp.Field))
+		args = append(args, partition[:4]+"-"+partition[4:6]+"-"+partition[6:])
+	}
+	var total uint64
+	if err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(t.sqlName())+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	limit := int64(-1)
+	if opts.MaxRows > 0 {
+		limit = int64(opts.MaxRows)
+	}
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY rowid LIMIT %d OFFSET %d", quoteIdent(t.sqlName()), where, limit, opts.StartIndex)
+	res, err := c.query(ctx, query, args, []*table{t})
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Fields) > 0 {
+		schema := make(bigquery.Schema, 0, len(opts.Fields))
+		for _, name := range opts.Fields {
+			f := fieldByName(t.meta.Schema, name)
+			if f == nil {
+				return nil, fmt.Errorf("unknown field %q", name)
+			}
+			schema = append(schema, f)
+		}
+		for i, row := range res.Rows {
+			selected := make(map[string]bigquery.Value, len(schema))
+			for _, f := range schema {
+				selected[f.Name] = row[f.Name]
+			}
+			res.Rows[i] = selected
+		}
+		res.Schema = schema
+	}
+	res.TotalRows = total
+	return res, nil
+}
+
+// RunQuery translates sql to SQLite and runs it. Every query is recorded as
+// a job whose statistics JobStatistics returns.
+func (c *FakeClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	if bq.QueryConfigFrom(ctx).Destination != nil {
+		return nil, &googleapi.Error{Code: 501, Message: "destination tables are not supported by the fake client"}
+	}
+	stats, translated, refs, err := c.dryRun(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBytesBilled > 0 && stats.TotalBytesProcessed > c.MaxBytesBilled {
+		return nil, &googleapi.Error{Code: 400, Message: fmt.Sprintf("Query exceeded limit for bytes billed: %d. %d or higher required.", c.MaxBytesBilled, stats.TotalBytesProcessed)}
+	}
+	start := time.Now()
+	res, err := c.query(ctx, translated, nil, refs)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	res.JobID = fmt.Sprintf("fake_job_%d", len(c.jobs)+1)
+	res.Location = "US"
+	stats.TotalBytesBilled = stats.TotalBytesProcessed
+	c.jobs[res.JobID] = &bigquery.JobStatistics{
+		CreationTime:        start,
+		StartTime:           start,
+		EndTime:             time.Now(),
+		TotalBytesProcessed: stats.TotalBytesProcessed,
+		Details:             stats,
+	}
+	c.mu.Unlock()
+	return res, nil
+}
+
+// StreamQuery runs sql like RunQuery and writes the rows to w.
+func (c *FakeClient) StreamQuery(ctx context.Context, sql string, w bq.RowWriter) (*bq.QueryResult, error) {
+	res, err := c.RunQuery(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	return bq.WriteResult(res, w)
+}
+
+// ExecuteQuery runs sql like RunQuery and discards the rows.
+func (c *FakeClient) ExecuteQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	res, err := c.RunQuery(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	return &bq.QueryResult{JobID: res.JobID, Location: res.Location, SessionID: res.SessionID}, nil
+}
+
+// LoadTable is not supported: the fake only holds the tables of its
+// fixtures.
+func (c *FakeClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts bq.LoadOptions) (*bq.LoadResult, error) {
+	return nil, &googleapi.Error{Code: 501, Message: "load jobs are not supported by the fake client"}
+}
+
+// DeleteTable drops a table loaded from the fixtures.
+func (c *FakeClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	t, err := c.table(projectID, datasetID, tableID)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.db.ExecContext(ctx, "DROP TABLE "+quoteIdent(t.sqlName())); err != nil {
+		return err
+	}
+	delete(c.tables, t.key())
+	return nil
+}
+
+// DryRunQuery validates sql and estimates the bytes it would process the way
+// BigQuery does: the full logical size of every column the query references,
+// regardless of filters and limits.
+func (c *FakeClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+	stats, _, _, err := c.dryRun(ctx, sql)
+	return stats, err
+}
+
+func (c *FakeClient) dryRun(ctx context.Context, sql string) (*bigquery.QueryStatistics, string, []*table, error) {
+	tr, err := c.translate(sql)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	// EXPLAIN compiles the statement without running it.
+	rows, err := c.db.QueryContext(ctx, "EXPLAIN "+tr.sql)
+	if err != nil {
+		return nil, "", nil, invalidQuery(err)
+	}
+	rows.Close()
+	stats := &bigquery.QueryStatistics{StatementType: tr.statementType}
+	for _, t := range tr.tables {
+		stats.ReferencedTables = append(stats.ReferencedTables, &bigquery.Table{ProjectID: t.project, DatasetID: t.dataset, TableID: t.id})
+		for name, size := range t.columnBytes {
+			if tr.referenced(t, name) {
+				stats.TotalBytesProcessed += size
+			}
+		}
+	}
+	return stats, tr.sql, tr.tables, nil
+}
+
+func (c *FakeClient) JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := strings.LastIndex(jobID, "."); i >= 0 {
+		jobID = jobID[i+1:]
+	}
+	stats, ok := c.jobs[jobID]
+	if !ok {
+		return nil, &googleapi.Error{Code: 404, Message: "Not found: Job " + jobID}
+	}
+	return stats, nil
+}
+
+func invalidQuery(err error) error {
+	return &googleapi.Error{Code: 400, Message: "Invalid query: " + err.Error()}
+}
+
+// query runs a SQLite query and converts the rows to BigQuery values. Result
+// columns named after a column of a referenced table take that column's
+// schema; the types of computed columns are inferred from their values.
+func (c *FakeClient) query(ctx context.Context, query string, args []any, refs []*table) (*bq.QueryResult, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, invalidQuery(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	var raw [][]any
+	for rows.Next() {
+		vals := make([]any, len(types))
+		ptrs := make([]any, len(types))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		raw = append(raw, vals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, invalidQuery(err)
+	}
+	schema := make(bigquery.Schema, len(types))
+	for i, ct := range types {
+		schema[i] = resultField(ct.Name(), ct.DatabaseTypeName(), refs, raw, i)
+	}
+	res := &bq.QueryResult{Schema: schema, Rows: make([]map[string]bigquery.Value, 0, len(raw))}
+	for _, vals := range raw {
+		row := make(map[string]bigquery.Value, len(schema))
+		for i, f := range schema {
+			v, err := loadValue(f, vals[i])
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", f.Name, err)
+			}
+			row[f.Name] = v
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, nil
+}
+
+func fieldByName(schema bigquery.Schema, name string) *bigquery.FieldSchema {
+	for _, f := range schema {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// resultField returns the schema of result column i.
+func resultField(name, decl string, refs []*table, raw [][]any, i int) *bigquery.FieldSchema {
+	if decl != "" {
+		for _, t := range refs {
+			if f := fieldByName(t.meta.Schema, name); f != nil && declType(f) == decl {
+				out := *f
+				out.Name = name
+				return &out
+			}
+		}
+		for typ, d := range declTypes {
+			if d == decl {
+				return &bigquery.FieldSchema{Name: name, Type: typ}
+			}
+		}
+	}
+	typ := bigquery.StringFieldType
+scan:
+	for _, vals := range raw {
+		switch vals[i].(type) {
+		case nil:
+			continue
+		case int64:
+			typ = bigquery.IntegerFieldType
+		case float64:
+			typ = bigquery.FloatFieldType
+		case []byte:
+			typ = bigquery.BytesFieldType
+		case bool:
+			typ = bigquery.BooleanFieldType
+		}
+		break scan
+	}
+	return &bigquery.FieldSchema{Name: name, Type: typ}
+}
+
+// declTypes maps BigQuery types to the declared SQLite column types. The
+// declared types keep the column affinity right and identify the BigQuery
+// type of result columns.
+var declTypes = map[bigquery.FieldType]string{
+	bigquery.IntegerFieldType:    "INTEGER",
+	bigquery.FloatFieldType:      "FLOAT",
+	bigquery.NumericFieldType:    "NUMERIC",
+	bigquery.BigNumericFieldType: "BIGNUMERIC",
+	bigquery.BooleanFieldType:    "BOOLEAN",
+	bigquery.StringFieldType:     "TEXT",
+	bigquery.BytesFieldType:      "BLOB",
+	bigquery.DateFieldType:       "DATE",
+	bigquery.DateTimeFieldType:   "DATETIME",
+	bigquery.TimeFieldType:       "TIME",
+	bigquery.TimestampFieldType:  "TIMESTAMP",
+	bigquery.JSONFieldType:       "JSON",
+	bigquery.GeographyFieldType:  "GEOGRAPHY",
+	bigquery.IntervalFieldType:   "INTERVAL",
+	bigquery.RecordFieldType:     "RECORD",
+}
+
+// declType returns the SQLite column type of f. RECORD and repeated fields
+// are stored as JSON text.
+func declType(f *bigquery.FieldSchema) string {
+	if f.Repeated {
+		return "ARRAY"
+	}
+	if d, ok := declTypes[f.Type]; ok {
+		return d
+	}
+	return "TEXT"
+}
+
+// storeValue converts a fixture value of field f to its SQLite value.
+func storeValue(f *bigquery.FieldSchema, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if f.Repeated || f.Type == bigquery.RecordFieldType || f.Type == bigquery.JSONFieldType {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		return strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	case bigquery.FloatFieldType:
+		return strconv.ParseFloat(fmt.Sprint(v), 64)
+	case bigquery.BooleanFieldType:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("want bool, got %v", v)
+		}
+		return b, nil
+	case bigquery.BytesFieldType:
+		return base64.StdEncoding.DecodeString(fmt.Sprint(v))
+	}
+	return fmt.Sprint(v), nil
+}
+
+// loadValue converts a SQLite value of field f to the value the BigQuery
+// client returns for it.
+func loadValue(f *bigquery.FieldSchema, v any) (bigquery.Value, error) {
+	if v == nil {
+		if f.Repeated {
+			return []bigquery.Value{}, nil
+		}
+		return nil, nil
+	}
+	if t, ok := v.(time.Time); ok {
+		// The driver parses columns declared as DATE, DATETIME and
+		// TIMESTAMP.
+		switch f.Type {
+		case bigquery.DateFieldType:
+			return civil.DateOf(t), nil
+		case bigquery.DateTimeFieldType:
+			return civil.DateTimeOf(t), nil
+		case bigquery.TimestampFieldType:
+			return t.UTC(), nil
+		}
+		v = t.Format(time.RFC3339Nano)
+	}
+	if f.Repeated || f.Type == bigquery.RecordFieldType {
+		dec := json.NewDecoder(strings.NewReader(asString(v)))
+		dec.UseNumber()
+		var j any
+		if err := dec.Decode(&j); err != nil {
+			return nil, err
+		}
+		return jsonValue(f, j, f.Repeated)
+	}
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		switch n := v.(type) {
+		case int64:
+			return n, nil
+		case float64:
+			return int64(n), nil
+		}
+		return strconv.ParseInt(asString(v), 10, 64)
+	case bigquery.FloatFieldType:
+		switch n := v.(type) {
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+		return strconv.ParseFloat(asString(v), 64)
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		r, ok := new(big.Rat).SetString(asString(v))
+		if !ok {
+			return nil, fmt.Errorf("invalid numeric %v", v)
+		}
+		return r, nil
+	case bigquery.BooleanFieldType:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case int64:
+			return b != 0, nil
+		}
+		return strconv.ParseBool(asString(v))
+	case bigquery.BytesFieldType:
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+		return []byte(asString(v)), nil
+	case bigquery.DateFieldType:
+		return civil.ParseDate(asString(v))
+	case bigquery.DateTimeFieldType:
+		return civil.ParseDateTime(strings.Replace(asString(v), " ", "T", 1))
+	case bigquery.TimeFieldType:
+		return civil.ParseTime(asString(v))
+	case bigquery.TimestampFieldType:
+		return parseTimestamp(asString(v))
+	}
+	return asString(v), nil
+}
+
+// jsonValue converts a decoded JSON value of a RECORD or repeated field.
+func jsonValue(f *bigquery.FieldSchema, v any, repeated bool) (bigquery.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if repeated {
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("want array, got %v", v)
+		}
+		out := make([]bigquery.Value, len(list))
+		for i, e := range list {
+			ev, err := jsonValue(f, e, false)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = ev
+		}
+		return out, nil
+	}
+	if f.Type != bigquery.RecordFieldType {
+		if s, ok := v.(string); ok {
+			return loadValue(&bigquery.FieldSchema{Type: f.Type}, s)
+		}
+		return loadValue(&bigquery.FieldSchema{Type: f.Type}, fmt.Sprint(v))
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("want object, got %v", v)
+	}
+	out := make(map[string]bigquery.Value, len(f.Schema))
+	for _, sub := range f.Schema {
+		sv, err := jsonValue(sub, obj[sub.Name], sub.Repeated)
+		if err != nil {
+			return nil, err
+		}
+		if sub.Repeated && sv == nil {
+			sv = []bigquery.Value{}
+		}
+		out[sub.Name] = sv
+	}
+	return out, nil
+}
+
+func asString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// valueBytes returns the logical size of a value as BigQuery bills it.
+func valueBytes(f *bigquery.FieldSchema, v any) int64 {
+	if v == nil {
+		return 0
+	}
+	if f.Repeated {
+		list, _ := v.([]any)
+		var n int64
+		for _, e := range list {
+			n += valueBytes(&bigquery.FieldSchema{Type: f.Type, Schema: f.Schema}, e)
+		}
+		return n
+	}
+	switch f.Type {
+	case bigquery.RecordFieldType:
+		obj, _ := v.(map[string]any)
+		var n int64
+		for _, sub := range f.Schema {
+			n += valueBytes(sub, obj[sub.Name])
+		}
+		return n
+	case bigquery.BooleanFieldType:
+		return 1
+	case bigquery.NumericFieldType, bigquery.IntervalFieldType:
+		return 16
+	case bigquery.BigNumericFieldType:
+		return 32
+	case bigquery.StringFieldType:
+		return 2 + int64(len(fmt.Sprint(v)))
+	case bigquery.BytesFieldType:
+		b, err := base64.StdEncoding.DecodeString(fmt.Sprint(v))
+		if err != nil {
+			return 2
+		}
+		return 2 + int64(len(b))
+	case bigquery.JSONFieldType, bigquery.GeographyFieldType:
+		b, _ := json.Marshal(v)
+		return 2 + int64(len(b))
+	}
+	return 8
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
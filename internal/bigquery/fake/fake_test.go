@@ -0,0 +1,181 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/googleapi"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func newTestClient(t *testing.T) *FakeClient {
+	t.Helper()
+	c, err := New("p", "testdata/shop.json")
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestMetadata(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	meta, err := c.GetTableMetadata(ctx, "p", "shop", "orders")
+	if err != nil {
+		t.Fatalf("GetTableMetadata error: %v", err)
+	}
+	if meta.NumRows != 4 || meta.TimePartitioning.Field != "order_date" || meta.Clustering.Fields[0] != "user_id" {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	// 4 rows of INTEGER, INTEGER, FLOAT, TIMESTAMP and DATE plus the status strings.
+	if want := int64(4*5*8 + (2 + 4) + (2 + 4) + (2 + 9) + (2 + 4)); meta.NumBytes != want {
+		t.Fatalf("NumBytes = %d, want %d", meta.NumBytes, want)
+	}
+	tables, _ := c.ListTables(ctx, "p", "shop")
+	datasets, _ := c.ListDatasets(ctx, "p")
+	if len(tables) != 2 || tables[0] != "orders" || len(datasets) != 1 {
+		t.Fatalf("unexpected listings: %v %v", tables, datasets)
+	}
+	_, err = c.GetTableSchema(ctx, "p", "shop", "missing")
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != 404 {
+		t.Fatalf("expected 404, got %v", err)
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	c := newTestClient(t)
+	res, err := c.RunQuery(context.Background(), `
+		# legacy-style comment
+		SELECT u.name, COUNT(*) AS orders, SUM(o.amount) / 2 AS half, COUNTIF(o.status = "done") AS done
+		FROM shop.users u JOIN `+"`p.shop.orders`"+` o ON o.user_id = u.id
+		WHERE o.order_date >= DATE '2024-01-02' AND STARTS_WITH(u.name, 'A') IS NOT TRUE
+		GROUP BY u.name
+		ORDER BY u.name
+		LIMIT 1`)
+	if err != nil {
+		t.Fatalf("RunQuery error: %v", err)
+	}
+	if len(res.Rows) != 1 || res.JobID == "" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	row := res.Rows[0]
+	if row["name"] != "Bob" || row["orders"] != int64(1) || row["half"] != 15.0 || row["done"] != int64(0) {
+		t.Fatalf("unexpected row: %#v", row)
+	}
+	if res.Schema[0].Type != bigquery.StringFieldType || res.Schema[1].Type != bigquery.IntegerFieldType || res.Schema[2].Type != bigquery.FloatFieldType {
+		t.Fatalf("unexpected schema: %+v", res.Schema)
+	}
+	stats, err := c.JobStatistics(context.Background(), res.JobID, "US")
+	if err != nil || stats.Details.(*bigquery.QueryStatistics).StatementType != "SELECT" {
+		t.Fatalf("unexpected job statistics %+v: %v", stats, err)
+	}
+}
+
+func TestRunQueryTypes(t *testing.T) {
+	c := newTestClient(t)
+	res, err := c.RunQuery(context.Background(), "SELECT * FROM shop.users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("RunQuery error: %v", err)
+	}
+	row := res.Rows[0]
+	addr, ok := row["address"].(map[string]bigquery.Value)
+	if row["id"] != int64(1) || row["active"] != true || !ok || addr["city"] != "Tokyo" {
+		t.Fatalf("unexpected row: %#v", row)
+	}
+	if tags := row["tags"].([]bigquery.Value); len(tags) != 1 || tags[0] != "vip" {
+		t.Fatalf("unexpected tags: %#v", row["tags"])
+	}
+	if len(res.Schema) != 6 || res.Schema[4].Schema == nil || !res.Schema[5].Repeated {
+		t.Fatalf("schema not taken from the table: %+v", res.Schema)
+	}
+
+	res, err = c.RunQuery(context.Background(), "SELECT ordered_at, order_date FROM shop.orders WHERE order_id = 10")
+	if err != nil {
+		t.Fatalf("RunQuery error: %v", err)
+	}
+	row = res.Rows[0]
+	if row["ordered_at"] != time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC) || row["order_date"] != (civil.Date{Year: 2024, Month: 1, Day: 1}) {
+		t.Fatalf("unexpected temporal values: %#v", row)
+	}
+}
+
+func TestDryRunQuery(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	stats, err := c.DryRunQuery(ctx, "SELECT order_id FROM shop.orders WHERE amount > 10 LIMIT 1")
+	if err != nil {
+		t.Fatalf("DryRunQuery error: %v", err)
+	}
+	// Filters and limits do not reduce the bytes scanned.
+	if stats.TotalBytesProcessed != 2*4*8 || len(stats.ReferencedTables) != 1 {
+		t.Fatalf("unexpected statistics: %+v", stats)
+	}
+	all, _ := c.DryRunQuery(ctx, "SELECT * FROM shop.orders")
+	meta, _ := c.GetTableMetadata(ctx, "p", "shop", "orders")
+	if all.TotalBytesProcessed != meta.NumBytes {
+		t.Fatalf("SELECT * estimate %d, want %d", all.TotalBytesProcessed, meta.NumBytes)
+	}
+	if _, err := c.DryRunQuery(ctx, "SELECT nope FROM shop.orders"); err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+
+	c.MaxBytesBilled = 10
+	if _, err := c.RunQuery(ctx, "SELECT order_id FROM shop.orders"); err == nil {
+		t.Fatal("expected bytes billed limit error")
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	c := newTestClient(t)
+	res, err := c.ReadTable(context.Background(), "p", "shop", "orders$20240102", bq.ReadOptions{StartIndex: 1, MaxRows: 5, Fields: []string{"ORDER_ID"}})
+	if err != nil {
+		t.Fatalf("ReadTable error: %v", err)
+	}
+	if res.TotalRows != 2 || len(res.Rows) != 1 || res.Rows[0]["order_id"] != int64(12) || len(res.Schema) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestDeleteTable(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if err := c.DeleteTable(ctx, "p", "shop", "orders"); err != nil {
+		t.Fatalf("DeleteTable error: %v", err)
+	}
+	if tables, _ := c.ListTables(ctx, "p", "shop"); len(tables) != 1 {
+		t.Fatalf("tables after delete = %v", tables)
+	}
+	if _, err := c.RunQuery(ctx, "SELECT order_id FROM shop.orders"); err == nil {
+		t.Fatal("expected the dropped table to be gone")
+	}
+	var gerr *googleapi.Error
+	if err := c.DeleteTable(ctx, "p", "shop", "orders"); !errors.As(err, &gerr) || gerr.Code != 404 {
+		t.Fatalf("expected 404, got %v", err)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := newTestClient(t)
+	cases := map[string]string{
+		"SELECT IF(a, 'x\\'y', r'\\d') FROM shop.users":     `SELECT IIF(a, 'x''y', '\d') FROM "p.shop.users" AS "users"`,
+		"SELECT `select` FROM `p.shop.users` AS u":          `SELECT "select" FROM "p.shop.users" AS u`,
+		"SELECT CAST(x AS INT64), CURRENT_TIMESTAMP() -- c": `SELECT CAST(x AS INTEGER), CURRENT_TIMESTAMP -- c`,
+		"SELECT a / b, b\"\\x41\"":                          `SELECT a * 1.0 / b, X'41'`,
+	}
+	for in, want := range cases {
+		tr, err := c.translate(in)
+		if err != nil {
+			t.Fatalf("translate(%q) error: %v", in, err)
+		}
+		if tr.sql != want {
+			t.Errorf("translate(%q) =\n%s\nwant\n%s", in, tr.sql, want)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package fake
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"modernc.org/sqlite"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqltoken"
+)
+
+// translation is a GoogleSQL statement rewritten for SQLite together with
+// what the dry run needs to estimate it.
+type translation struct {
+	sql           string
+	statementType string
+	tables        []*table
+	// idents are the lower-cased names used anywhere in the statement.
+	idents map[string]bool
+	// star is set by SELECT *; except lists the columns it excludes.
+	star   bool
+	except map[string]bool
+}
+
+// referenced reports whether the statement reads column name of t.
+func (tr *translation) referenced(t *table, name string) bool {
+	return tr.star && !tr.except[name] || tr.idents[name]
+}
+
+// functions maps GoogleSQL functions to their SQLite names. Functions
+// without an SQLite counterpart are registered in init.
+var functions = map[string]string{
+	"IF":           "IIF",
+	"SAFE_CAST":    "CAST",
+	"STRPOS":       "INSTR",
+	"CHAR_LENGTH":  "LENGTH",
+	"ARRAY_LENGTH": "JSON_ARRAY_LENGTH",
+}
+
+// castTypes maps GoogleSQL type names in CAST to SQLite types.
+var castTypes = map[string]string{
+	"INT64": "INTEGER", "INTEGER": "INTEGER", "FLOAT64": "REAL", "FLOAT": "REAL",
+	"NUMERIC": "NUMERIC", "BIGNUMERIC": "NUMERIC", "BOOL": "INTEGER", "BOOLEAN": "INTEGER",
+	"STRING": "TEXT", "BYTES": "BLOB", "DATE": "TEXT", "DATETIME": "TEXT", "TIME": "TEXT",
+	"TIMESTAMP": "TEXT", "JSON": "TEXT",
+}
+
+// typedLiterals prefix string literals, e.g. DATE '2024-01-01'. SQLite
+// compares the canonical text forms directly.
+var typedLiterals = map[string]bool{
+	"DATE": true, "DATETIME": true, "TIME": true, "TIMESTAMP": true, "NUMERIC": true, "BIGNUMERIC": true, "JSON": true,
+}
+
+// niladic are functions that SQLite spells without parentheses.
+var niladic = map[string]bool{"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true}
+
+// translate rewrites sql for SQLite: table paths become the names of the
+// SQLite tables, string literals and quoted identifiers are requoted and a
+// small set of functions and operators is mapped. Unsupported constructs
+// surface as SQLite errors when the statement is prepared.
+func (c *FakeClient) translate(sql string) (*translation, error) {
+	toks := sqltoken.Tokenize(sql)
+	tr := &translation{idents: map[string]bool{}, except: map[string]bool{}}
+	var b strings.Builder
+	seen := map[*table]bool{}
+	var prev sqltoken.Token // previous significant token
+	inFrom := false
+	nextSig := func(i int) (sqltoken.Token, int) {
+		for ; i < len(toks); i++ {
+			if toks[i].Kind != sqltoken.Whitespace && toks[i].Kind != sqltoken.Comment {
+				return toks[i], i
+			}
+		}
+		return sqltoken.Token{}, len(toks)
+	}
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.Kind != sqltoken.Whitespace && t.Kind != sqltoken.Comment {
+			if tr.statementType == "" {
+				tr.statementType = t.Upper()
+				if tr.statementType == "WITH" || tr.statementType == "(" {
+					tr.statementType = "SELECT"
+				}
+			}
+		}
+		switch t.Kind {
+		case sqltoken.Comment:
+			if strings.HasPrefix(t.Text, "#") {
+				b.WriteString("--" + t.Text[1:])
+			} else {
+				b.WriteString(t.Text)
+			}
+			continue
+		case sqltoken.Whitespace:
+			b.WriteString(t.Text)
+			continue
+		case sqltoken.String:
+			lit, err := stringLiteral(t.Text)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(lit)
+		case sqltoken.Identifier, sqltoken.QuotedIdentifier:
+			parts, n := readPath(toks[i:])
+			for _, p := range parts {
+				tr.idents[strings.ToLower(p)] = true
+			}
+			if prev.Is("FROM") || prev.Is("JOIN") || prev.Text == "," && inFrom || prev.Is("INTO") || prev.Is("UPDATE") {
+				if tbl, used := c.lookup(parts); tbl != nil {
+					b.WriteString(quoteIdent(tbl.sqlName()))
+					for _, p := range parts[used:] {
+						b.WriteString("." + quoteIdent(p))
+					}
+					next, _ := nextSig(i + n)
+					if !prev.Is("INTO") && !prev.Is("UPDATE") && !next.Is("AS") && next.Kind != sqltoken.Identifier && next.Kind != sqltoken.QuotedIdentifier {
+						b.WriteString(" AS " + quoteIdent(tbl.id))
+					}
+					if !seen[tbl] {
+						seen[tbl] = true
+						tr.tables = append(tr.tables, tbl)
+					}
+					i += n - 1
+					prev = toks[i]
+					continue
+				}
+			}
+			if n == 1 && t.Kind == sqltoken.Identifier {
+				up := t.Upper()
+				next, j := nextSig(i + 1)
+				switch {
+				case next.Kind == sqltoken.String && typedLiterals[up]:
+					// Drop the type of a typed literal.
+					prev = t
+					continue
+				case next.Text == "(" && niladic[up]:
+					if after, k := nextSig(j + 1); after.Text == ")" {
+						b.WriteString(up)
+						i = k
+						prev = after
+						continue
+					}
+				case next.Text == "(" && functions[up] != "":
+					b.WriteString(functions[up])
+					prev = t
+					continue
+				case prev.Is("AS") && next.Text == ")" && castTypes[up] != "":
+					b.WriteString(castTypes[up])
+					prev = t
+					continue
+				}
+			}
+			for k := i; k < i+n; k++ {
+				switch tok := toks[k]; {
+				case tok.Kind == sqltoken.QuotedIdentifier:
+					for m, p := range strings.Split(strings.Trim(tok.Text, "`"), ".") {
+						if m > 0 {
+							b.WriteString(".")
+						}
+						b.WriteString(quoteIdent(p))
+					}
+				case strings.Contains(tok.Text, "-"):
+					b.WriteString(quoteIdent(tok.Text))
+				default:
+					b.WriteString(tok.Text)
+				}
+			}
+			i += n - 1
+			prev = toks[i]
+			continue
+		case sqltoken.Keyword:
+			up := t.Upper()
+			switch {
+			case up == "FROM":
+				inFrom = true
+			case up == "WHERE" || up == "GROUP" || up == "ORDER" || up == "HAVING" || up == "LIMIT" || up == "QUALIFY" ||
+				up == "WINDOW" || up == "SELECT" || up == "UNION" || up == "ON" || up == "USING" || up == "SET":
+				inFrom = false
+			}
+			if next, _ := nextSig(i + 1); next.Text == "(" && functions[up] != "" {
+				b.WriteString(functions[up])
+			} else {
+				b.WriteString(t.Text)
+			}
+			if up == "EXCEPT" && prev.Text == "*" {
+				// SELECT * EXCEPT (columns) is not SQLite; record the
+				// excluded columns for the estimate and let the statement
+				// fail to prepare.
+				for j := i + 1; j < len(toks) && toks[j].Text != ")"; j++ {
+					if toks[j].Kind == sqltoken.Identifier || toks[j].Kind == sqltoken.QuotedIdentifier {
+						tr.except[strings.ToLower(strings.Trim(toks[j].Text, "`"))] = true
+					}
+				}
+			}
+		case sqltoken.Operator:
+			switch {
+			case t.Text == "/":
+				// GoogleSQL division always returns FLOAT64.
+				b.WriteString("* 1.0 /")
+			case t.Text == "*" && (prev.Is("SELECT") || prev.Is("DISTINCT") || prev.Text == "," || prev.Text == "."):
+				if next, _ := nextSig(i + 1); next.Text == "," || next.Is("FROM") || next.Is("EXCEPT") || next.Is("REPLACE") || next.Text == "" {
+					tr.star = true
+				}
+				b.WriteString(t.Text)
+			default:
+				b.WriteString(t.Text)
+			}
+		default:
+			b.WriteString(t.Text)
+		}
+		prev = t
+	}
+	tr.sql = b.String()
+	return tr, nil
+}
+
+// lookup resolves a table path of three parts, or of two parts in the client
+// project, and returns the table and the number of parts it used.
+func (c *FakeClient) lookup(parts []string) (*table, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(parts) >= 3 {
+		if t, ok := c.tables[strings.ToLower(strings.Join(parts[:3], "."))]; ok {
+			return t, 3
+		}
+	}
+	if len(parts) >= 2 {
+		if t, ok := c.tables[strings.ToLower(c.project+"."+parts[0]+"."+parts[1])]; ok {
+			return t, 2
+		}
+	}
+	return nil, 0
+}
+
+// readPath reads a dotted path from the start of toks. Backtick-quoted
+// components may themselves contain dots.
+func readPath(toks []sqltoken.Token) ([]string, int) {
+	var parts []string
+	n := 0
+	for n < len(toks) {
+		t := toks[n]
+		switch t.Kind {
+		case sqltoken.QuotedIdentifier:
+			parts = append(parts, strings.Split(strings.Trim(t.Text, "`"), ".")...)
+		case sqltoken.Identifier:
+			parts = append(parts, t.Text)
+		default:
+			return parts, n
+		}
+		n++
+		if n+1 < len(toks) && toks[n].Text == "." && (toks[n+1].Kind == sqltoken.Identifier || toks[n+1].Kind == sqltoken.QuotedIdentifier) {
+			n++
+			continue
+		}
+		break
+	}
+	return parts, n
+}
+
+// stringLiteral converts a GoogleSQL string or bytes literal to SQLite.
+func stringLiteral(text string) (string, error) {
+	raw, isBytes := false, false
+	i := 0
+	for ; i < len(text) && text[i] != '\'' && text[i] != '"'; i++ {
+		switch text[i] {
+		case 'r', 'R':
+			raw = true
+		case 'b', 'B':
+			isBytes = true
+		}
+	}
+	body := text[i:]
+	q := body[:1]
+	if strings.HasPrefix(body, q+q+q) && len(body) >= 6 {
+		body = body[3 : len(body)-3]
+	} else if len(body) >= 2 {
+		body = body[1 : len(body)-1]
+	} else {
+		return "", errors.New("unterminated string literal")
+	}
+	if !raw {
+		var err error
+		if body, err = unescape(body); err != nil {
+			return "", err
+		}
+	}
+	if isBytes {
+		return "X'" + hex.EncodeToString([]byte(body)) + "'", nil
+	}
+	return "'" + strings.ReplaceAll(body, "'", "''") + "'", nil
+}
+
+// unescape resolves the escape sequences of a GoogleSQL string literal.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x', 'X':
+			if i+3 > len(s) {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		case 'u', 'U':
+			n := 4
+			if c == 'U' {
+				n = 8
+			}
+			if i+1+n > len(s) {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(rune(v))
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("safe_divide", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		x, ok1 := number(args[0])
+		y, ok2 := number(args[1])
+		if !ok1 || !ok2 || y == 0 {
+			return nil, nil
+		}
+		return x / y, nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("starts_with", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return strings.HasPrefix(asString(args[0]), asString(args[1])), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("ends_with", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return strings.HasSuffix(asString(args[0]), asString(args[1])), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("regexp_contains", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		re, err := regexp.Compile(asString(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(asString(args[0])), nil
+	})
+	for name, fn := range map[string]func(acc, v bool) bool{
+		"countif":     nil,
+		"logical_and": func(acc, v bool) bool { return acc && v },
+		"logical_or":  func(acc, v bool) bool { return acc || v },
+	} {
+		fn, name := fn, name
+		sqlite.MustRegisterFunction(name, &sqlite.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+				return &boolAggregate{fn: fn, count: name == "countif"}, nil
+			},
+		})
+	}
+}
+
+// boolAggregate implements COUNTIF, LOGICAL_AND and LOGICAL_OR.
+type boolAggregate struct {
+	fn    func(acc, v bool) bool
+	count bool
+	n     int64
+	acc   any
+}
+
+func (a *boolAggregate) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	v, ok := number(args[0])
+	if !ok {
+		return nil
+	}
+	if a.count {
+		if v != 0 {
+			a.n++
+		}
+		return nil
+	}
+	if a.acc == nil {
+		a.acc = v != 0
+	} else {
+		a.acc = a.fn(a.acc.(bool), v != 0)
+	}
+	return nil
+}
+
+func (a *boolAggregate) WindowInverse(*sqlite.FunctionContext, []driver.Value) error {
+	return errors.New("not supported as a window function")
+}
+
+func (a *boolAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	if a.count {
+		return a.n, nil
+	}
+	return a.acc, nil
+}
+
+func (a *boolAggregate) Final(*sqlite.FunctionContext) {}
+
+// number converts an SQLite argument to a float64.
+func number(v driver.Value) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
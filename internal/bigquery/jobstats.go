@@ -0,0 +1,107 @@
+package bigquery
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	bq "google.golang.org/api/bigquery/v2"
+)
+
+// ParseJobStatistics decodes job statistics recorded in the JSON format of
+// the BigQuery REST API, as printed by `bq show --format=json -j JOB_ID`.
+// Both a full job resource and its "statistics" object are accepted. Query
+// statistics are converted so that they can be inspected offline like those
+// returned by Client.JobStatistics.
+func ParseJobStatistics(data []byte) (*bigquery.JobStatistics, error) {
+	var job bq.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	stats := job.Statistics
+	if stats == nil {
+		stats = new(bq.JobStatistics)
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, err
+		}
+	}
+	if stats.Query == nil {
+		return nil, errors.New("no query statistics in recorded job")
+	}
+	q := stats.Query
+	qs := &bigquery.QueryStatistics{
+		CacheHit:            q.CacheHit,
+		StatementType:       q.StatementType,
+		TotalBytesBilled:    q.TotalBytesBilled,
+		TotalBytesProcessed: q.TotalBytesProcessed,
+		SlotMillis:          q.TotalSlotMs,
+	}
+	for _, t := range q.ReferencedTables {
+		qs.ReferencedTables = append(qs.ReferencedTables, &bigquery.Table{ProjectID: t.ProjectId, DatasetID: t.DatasetId, TableID: t.TableId})
+	}
+	for _, s := range q.QueryPlan {
+		stage := &bigquery.ExplainQueryStage{
+			CompletedParallelInputs:   s.CompletedParallelInputs,
+			ComputeAvg:                msDuration(s.ComputeMsAvg),
+			ComputeMax:                msDuration(s.ComputeMsMax),
+			ComputeRatioAvg:           s.ComputeRatioAvg,
+			ComputeRatioMax:           s.ComputeRatioMax,
+			EndTime:                   msTime(s.EndMs),
+			ID:                        s.Id,
+			InputStages:               s.InputStages,
+			Name:                      s.Name,
+			ParallelInputs:            s.ParallelInputs,
+			ReadAvg:                   msDuration(s.ReadMsAvg),
+			ReadMax:                   msDuration(s.ReadMsMax),
+			ReadRatioAvg:              s.ReadRatioAvg,
+			ReadRatioMax:              s.ReadRatioMax,
+			RecordsRead:               s.RecordsRead,
+			RecordsWritten:            s.RecordsWritten,
+			ShuffleOutputBytes:        s.ShuffleOutputBytes,
+			ShuffleOutputBytesSpilled: s.ShuffleOutputBytesSpilled,
+			StartTime:                 msTime(s.StartMs),
+			Status:                    s.Status,
+			WaitAvg:                   msDuration(s.WaitMsAvg),
+			WaitMax:                   msDuration(s.WaitMsMax),
+			WaitRatioAvg:              s.WaitRatioAvg,
+			WaitRatioMax:              s.WaitRatioMax,
+			WriteAvg:                  msDuration(s.WriteMsAvg),
+			WriteMax:                  msDuration(s.WriteMsMax),
+			WriteRatioAvg:             s.WriteRatioAvg,
+			WriteRatioMax:             s.WriteRatioMax,
+		}
+		for _, step := range s.Steps {
+			stage.Steps = append(stage.Steps, &bigquery.ExplainQueryStep{Kind: step.Kind, Substeps: step.Substeps})
+		}
+		qs.QueryPlan = append(qs.QueryPlan, stage)
+	}
+	for _, t := range q.Timeline {
+		qs.Timeline = append(qs.Timeline, &bigquery.QueryTimelineSample{
+			ActiveUnits:    t.ActiveUnits,
+			CompletedUnits: t.CompletedUnits,
+			Elapsed:        msDuration(t.ElapsedMs),
+			PendingUnits:   t.PendingUnits,
+			SlotMillis:     t.TotalSlotMs,
+		})
+	}
+	return &bigquery.JobStatistics{
+		CreationTime:        msTime(stats.CreationTime),
+		StartTime:           msTime(stats.StartTime),
+		EndTime:             msTime(stats.EndTime),
+		TotalBytesProcessed: stats.TotalBytesProcessed,
+		TotalSlotDuration:   msDuration(stats.TotalSlotMs),
+		Details:             qs,
+	}, nil
+}
+
+func msDuration(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+func msTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
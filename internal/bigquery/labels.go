@@ -0,0 +1,95 @@
+package bigquery
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of BigQuery labels.
+const (
+	maxLabels      = 64
+	maxLabelLength = 63
+)
+
+// SanitizeLabels rewrites labels to satisfy the BigQuery label rules: keys
+// and values are lower-cased, characters other than letters, digits,
+// underscores and dashes are replaced by underscores and both are cut to 63
+// characters. Keys must start with a letter and are prefixed with "l_"
+// otherwise. Labels whose key is empty are dropped, and only the first 64
+// labels in key order are kept.
+func SanitizeLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		k = sanitizeLabel(k)
+		if k == "" {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(k); !unicode.IsLetter(r) {
+			k = truncateLabel("l_" + k)
+		}
+		out[k] = sanitizeLabel(v)
+	}
+	if len(out) > maxLabels {
+		keys := make([]string, 0, len(out))
+		for k := range out {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[maxLabels:] {
+			delete(out, k)
+		}
+	}
+	return out
+}
+
+func sanitizeLabel(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return truncateLabel(b.String())
+}
+
+// truncateLabel cuts s to the maximum label length in characters.
+func truncateLabel(s string) string {
+	if utf8.RuneCountInString(s) <= maxLabelLength {
+		return s
+	}
+	return string([]rune(s)[:maxLabelLength])
+}
+
+// tagSQL prepends a comment listing labels to sql, so that the labels are
+// visible wherever the query text is, e.g. in INFORMATION_SCHEMA.JOBS. A
+// leading #legacySQL or #standardSQL line stays first, as BigQuery requires.
+func tagSQL(sql string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return sql
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + labels[k]
+	}
+	tag := "/* " + strings.Join(pairs, " ") + " */\n"
+	trimmed := strings.TrimLeft(sql, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '#' {
+		first, rest, _ := strings.Cut(trimmed, "\n")
+		if d := strings.ToLower(strings.TrimSpace(first)); d == "#legacysql" || d == "#standardsql" {
+			return first + "\n" + tag + rest
+		}
+	}
+	return tag + sql
+}
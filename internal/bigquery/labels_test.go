@@ -0,0 +1,60 @@
+package bigquery
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeLabels(t *testing.T) {
+	got := SanitizeLabels(map[string]string{
+		"Team":       "Data Eng",
+		"principal":  "alice@example.com",
+		"1st":        "x",
+		"long":       strings.Repeat("v", 70),
+		"ünïcode":    "ÄBC",
+		"!!":         "dropped?",
+		"":           "empty",
+		"with-dash_": "ok-value_1",
+	})
+	want := map[string]string{
+		"team":       "data_eng",
+		"principal":  "alice_example_com",
+		"l_1st":      "x",
+		"long":       strings.Repeat("v", 63),
+		"ünïcode":    "äbc",
+		"l___":       "dropped_",
+		"with-dash_": "ok-value_1",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("SanitizeLabels = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("label %q = %q, want %q", k, got[k], v)
+		}
+	}
+
+	many := make(map[string]string)
+	for i := 0; i < 70; i++ {
+		many["k"+strconv.Itoa(i)] = "v"
+	}
+	if n := len(SanitizeLabels(many)); n != maxLabels {
+		t.Errorf("kept %d labels, want %d", n, maxLabels)
+	}
+}
+
+func TestTagSQL(t *testing.T) {
+	labels := map[string]string{"mcp_tool": "query", "team": "bi"}
+	got := tagSQL("SELECT 1", labels)
+	if want := "/* mcp_tool=query team=bi */\nSELECT 1"; got != want {
+		t.Errorf("tagSQL = %q, want %q", got, want)
+	}
+	got = tagSQL("#legacySQL\nSELECT 1 FROM [p:d.t]", labels)
+	if want := "#legacySQL\n/* mcp_tool=query team=bi */\nSELECT 1 FROM [p:d.t]"; got != want {
+		t.Errorf("tagSQL = %q, want %q", got, want)
+	}
+	if got := tagSQL("SELECT 1", nil); got != "SELECT 1" {
+		t.Errorf("tagSQL without labels = %q", got)
+	}
+}
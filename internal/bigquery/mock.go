@@ -2,24 +2,33 @@ package bigquery
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"cloud.google.com/go/bigquery"
 )
 
 type MockClient struct {
-	SchemaRes []*bigquery.FieldSchema
-	QueryRes  []map[string]bigquery.Value
-	DryRunRes *bigquery.QueryStatistics
-	TablesRes []string
-	Err       error
+	SchemaRes      []*bigquery.FieldSchema
+	QueryRes       []map[string]bigquery.Value
+	QuerySchemaRes bigquery.Schema
+	DryRunRes      *bigquery.QueryStatistics
+	TablesRes      []string
+	MetadataRes    *bigquery.TableMetadata
+	VersionRes     *bigquery.TableMetadata
+	DatasetsRes    []string
+	ReadRes        *QueryResult
+	JobStatsRes    *bigquery.JobStatistics
+	LoadRes        *LoadResult
+	Err            error
 }
 
 func (m *MockClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
 	return m.SchemaRes, m.Err
 }
 
-func (m *MockClient) RunQuery(ctx context.Context, sql string) ([]map[string]bigquery.Value, error) {
-	return m.QueryRes, m.Err
+func (m *MockClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	return &QueryResult{Schema: m.QuerySchemaRes, Rows: m.QueryRes}, m.Err
 }
 
 func (m *MockClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
@@ -29,3 +38,45 @@ func (m *MockClient) DryRunQuery(ctx context.Context, sql string) (*bigquery.Que
 func (m *MockClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
 	return m.TablesRes, m.Err
 }
+
+func (m *MockClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	return m.MetadataRes, m.Err
+}
+
+func (m *MockClient) GetTableVersion(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	return m.VersionRes, m.Err
+}
+
+func (m *MockClient) ListDatasets(ctx context.Context, projectID string) ([]string, error) {
+	return m.DatasetsRes, m.Err
+}
+
+func (m *MockClient) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts ReadOptions) (*QueryResult, error) {
+	if m.Err == nil && m.ReadRes == nil {
+		return nil, errors.New("mock: ReadRes not set")
+	}
+	return m.ReadRes, m.Err
+}
+
+func (m *MockClient) JobStatistics(ctx context.Context, jobID, location string) (*bigquery.JobStatistics, error) {
+	return m.JobStatsRes, m.Err
+}
+
+func (m *MockClient) StreamQuery(ctx context.Context, sql string, w RowWriter) (*QueryResult, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return WriteResult(&QueryResult{Schema: m.QuerySchemaRes, Rows: m.QueryRes}, w)
+}
+
+func (m *MockClient) ExecuteQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	return &QueryResult{Schema: m.QuerySchemaRes}, m.Err
+}
+
+func (m *MockClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts LoadOptions) (*LoadResult, error) {
+	return m.LoadRes, m.Err
+}
+
+func (m *MockClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	return m.Err
+}
@@ -0,0 +1,251 @@
+package bigquery
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// ResultCacheOptions configures a ResultCache.
+type ResultCacheOptions struct {
+	// TTL is how long a result may be served from the cache.
+	TTL time.Duration
+	// MaxEntries bounds the number of cached results. Zero means unlimited.
+	MaxEntries int
+	// MaxBytes bounds the approximate memory used by cached rows, measured
+	// on their JSON encoding. Zero means unlimited.
+	MaxBytes int
+}
+
+type noCacheKey struct{}
+
+// WithoutResultCache returns a context that makes caching clients execute
+// queries instead of serving cached results.
+func WithoutResultCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func resultCacheDisabled(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey{}).(bool)
+	return v
+}
+
+type dryRunKey struct{}
+
+// WithDryRunStats returns a context carrying the dry-run statistics of the
+// query about to run, so that caching clients do not dry-run it again.
+func WithDryRunStats(ctx context.Context, stats *bigquery.QueryStatistics) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, stats)
+}
+
+func dryRunStatsFrom(ctx context.Context) *bigquery.QueryStatistics {
+	stats, _ := ctx.Value(dryRunKey{}).(*bigquery.QueryStatistics)
+	return stats
+}
+
+// nondeterministic matches functions whose results change between runs;
+// queries using them are never cached. The CURRENT_* functions may be
+// called without parentheses.
+var nondeterministic = regexp.MustCompile(`(?i)\bCURRENT_(DATE|TIME|TIMESTAMP|DATETIME)\b|\b(NOW|RAND|GENERATE_UUID|SESSION_USER)\s*\(`)
+
+// ResultCache stores query results keyed by normalized SQL and the last
+// modified times of the referenced tables, shared by all clients wrapped
+// with Wrap.
+type ResultCache struct {
+	opts ResultCacheOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int
+}
+
+type resultEntry struct {
+	key     string
+	result  *QueryResult
+	size    int
+	expires time.Time
+}
+
+// NewResultCache creates an empty result cache.
+func NewResultCache(opts ResultCacheOptions) *ResultCache {
+	return &ResultCache{opts: opts, now: time.Now, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Wrap returns a Client that serves RunQuery from the cache and delegates
+// everything else to next.
+func (c *ResultCache) Wrap(next Client) Client {
+	return &resultCachingClient{Client: next, cache: c}
+}
+
+func (c *ResultCache) get(key string) *QueryResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*resultEntry)
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e.result
+}
+
+func (c *ResultCache) put(key string, res *QueryResult) {
+	data, err := json.Marshal(res.Rows)
+	if err != nil {
+		return
+	}
+	size := len(data)
+	if c.opts.MaxBytes > 0 && size > c.opts.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.entries[key] = c.lru.PushFront(&resultEntry{key: key, result: res, size: size, expires: c.now().Add(c.opts.TTL)})
+	c.bytes += size
+	for (c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) || (c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes) {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *ResultCache) removeElement(el *list.Element) {
+	e := el.Value.(*resultEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+}
+
+type resultCachingClient struct {
+	Client
+	cache *ResultCache
+}
+
+// RunQuery serves SELECT statements from the cache. The cache key covers the
+// normalized SQL and the last modified time of every table referenced by the
+// query, as reported by the dry run attached with WithDryRunStats or
+// otherwise by a new one, so results are invalidated when a table changes.
+// Last modified times are read through the wrapped client and are as fresh
+// as its metadata cache.
+// Queries using nondeterministic functions, running in a BigQuery session or
+// writing to a destination table are never cached.
+func (c *resultCachingClient) RunQuery(ctx context.Context, sql string) (*QueryResult, error) {
+	cfg := QueryConfigFrom(ctx)
+	if resultCacheDisabled(ctx) || cfg.inSession() || cfg.Destination != nil || nondeterministic.MatchString(sql) {
+		return c.Client.RunQuery(ctx, sql)
+	}
+	key, ok := c.key(ctx, sql)
+	if !ok {
+		return c.Client.RunQuery(ctx, sql)
+	}
+	if res := c.cache.get(key); res != nil {
+		hit := *res
+		hit.CacheHit = true
+		return &hit, nil
+	}
+	res, err := c.Client.RunQuery(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.put(key, res)
+	return res, nil
+}
+
+// key returns the cache key of sql, or false when the query must not be
+// cached.
+func (c *resultCachingClient) key(ctx context.Context, sql string) (string, bool) {
+	stats := dryRunStatsFrom(ctx)
+	if stats == nil {
+		var err error
+		if stats, err = c.Client.DryRunQuery(ctx, sql); err != nil {
+			return "", false
+		}
+	}
+	if stats == nil || stats.StatementType != "SELECT" {
+		return "", false
+	}
+	var versions []string
+	for _, t := range stats.ReferencedTables {
+		meta, err := c.Client.GetTableMetadata(ctx, t.ProjectID, t.DatasetID, t.TableID)
+		if err != nil || meta == nil {
+			return "", false
+		}
+		versions = append(versions, t.ProjectID+"."+t.DatasetID+"."+t.TableID+"@"+meta.LastModifiedTime.UTC().Format(time.RFC3339Nano))
+	}
+	sort.Strings(versions)
+	h := sha256.New()
+	h.Write([]byte(normalizeSQL(sql)))
+	for _, v := range versions {
+		h.Write([]byte{0})
+		h.Write([]byte(v))
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// normalizeSQL removes comments, collapses whitespace outside of string
+// literals and quoted identifiers and drops trailing semicolons, so that
+// formatting differences do not defeat caching.
+func normalizeSQL(sql string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '-' && i+1 < len(sql) && sql[i+1] == '-', ch == '#':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			space = true
+		case ch == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			space = true
+		case ch == '\'' || ch == '"' || ch == '`':
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			j := i + 1
+			for j < len(sql) && sql[j] != ch {
+				if sql[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(sql) {
+				j = len(sql) - 1
+			}
+			b.WriteString(sql[i : j+1])
+			i = j
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			space = true
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteByte(ch)
+		}
+	}
+	return strings.TrimRight(b.String(), "; ")
+}
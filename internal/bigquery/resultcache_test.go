@@ -0,0 +1,132 @@
+package bigquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func newResultCacheClient(opts ResultCacheOptions) (*countingClient, *ResultCache, Client) {
+	next := &countingClient{MockClient: &MockClient{
+		QueryRes:    []map[string]bigquery.Value{{"id": "1"}},
+		DryRunRes:   &bigquery.QueryStatistics{StatementType: "SELECT", ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "t"}}},
+		MetadataRes: &bigquery.TableMetadata{LastModifiedTime: time.Unix(100, 0)},
+	}}
+	cache := NewResultCache(opts)
+	return next, cache, cache.Wrap(next)
+}
+
+func TestResultCacheHit(t *testing.T) {
+	next, _, c := newResultCacheClient(ResultCacheOptions{TTL: time.Minute})
+	ctx := context.Background()
+
+	res, err := c.RunQuery(ctx, "SELECT id FROM d.t")
+	if err != nil || res.CacheHit {
+		t.Fatalf("first RunQuery: %+v %v", res, err)
+	}
+	res, err = c.RunQuery(ctx, "SELECT  id\n  FROM d.t -- again\n;")
+	if err != nil || !res.CacheHit || len(res.Rows) != 1 {
+		t.Fatalf("second RunQuery: %+v %v", res, err)
+	}
+	if next.queryCalls != 1 {
+		t.Fatalf("expected 1 query, got %d", next.queryCalls)
+	}
+
+	if _, err := c.RunQuery(WithoutResultCache(ctx), "SELECT id FROM d.t"); err != nil {
+		t.Fatalf("RunQuery: %v", err)
+	}
+	if next.queryCalls != 2 {
+		t.Fatalf("expected no_cache to execute the query, got %d calls", next.queryCalls)
+	}
+}
+
+func TestResultCacheInvalidation(t *testing.T) {
+	next, cache, c := newResultCacheClient(ResultCacheOptions{TTL: time.Minute})
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+	sql := "SELECT id FROM d.t"
+
+	c.RunQuery(ctx, sql)
+	next.MetadataRes = &bigquery.TableMetadata{LastModifiedTime: time.Unix(200, 0)}
+	if res, _ := c.RunQuery(ctx, sql); res.CacheHit {
+		t.Fatal("expected table modification to invalidate the result")
+	}
+	now = now.Add(2 * time.Minute)
+	if res, _ := c.RunQuery(ctx, sql); res.CacheHit {
+		t.Fatal("expected expired result to be re-executed")
+	}
+	if next.queryCalls != 3 {
+		t.Fatalf("expected 3 queries, got %d", next.queryCalls)
+	}
+}
+
+func TestResultCacheSkipsUncacheable(t *testing.T) {
+	next, _, c := newResultCacheClient(ResultCacheOptions{TTL: time.Minute})
+	ctx := context.Background()
+
+	for _, sql := range []string{"SELECT id, CURRENT_TIMESTAMP() FROM d.t", "SELECT id FROM d.t WHERE d = CURRENT_DATE", "SELECT CURRENT_DATE"} {
+		c.RunQuery(ctx, sql)
+	}
+	if next.queryCalls != 3 {
+		t.Fatalf("expected nondeterministic queries to execute, got %d calls", next.queryCalls)
+	}
+	next.DryRunRes = &bigquery.QueryStatistics{StatementType: "INSERT"}
+	for i := 0; i < 2; i++ {
+		c.RunQuery(ctx, "INSERT INTO d.t (id) VALUES ('1')")
+	}
+	next.DryRunRes = nil
+	dst := WithQueryConfig(ctx, QueryConfig{Destination: &Destination{Project: "p", Dataset: "d", Table: "copy"}})
+	for i := 0; i < 2; i++ {
+		c.RunQuery(dst, "SELECT id FROM d.t")
+	}
+	if next.queryCalls != 7 {
+		t.Fatalf("expected every query to execute, got %d calls", next.queryCalls)
+	}
+}
+
+func TestResultCacheReusesDryRun(t *testing.T) {
+	next, _, c := newResultCacheClient(ResultCacheOptions{TTL: time.Minute})
+	next.DryRunRes = nil
+	ctx := WithDryRunStats(context.Background(), &bigquery.QueryStatistics{
+		StatementType:    "SELECT",
+		ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "t"}},
+	})
+	c.RunQuery(ctx, "SELECT id FROM d.t")
+	if res, _ := c.RunQuery(ctx, "SELECT id FROM d.t"); !res.CacheHit {
+		t.Fatal("expected the attached dry run to be used for the cache key")
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	cache := NewResultCache(ResultCacheOptions{TTL: time.Minute, MaxEntries: 2})
+	res := &QueryResult{Rows: []map[string]bigquery.Value{{"id": "1"}}}
+	cache.put("a", res)
+	cache.put("b", res)
+	cache.get("a")
+	cache.put("c", res)
+	if cache.get("b") != nil || cache.get("a") == nil || cache.get("c") == nil {
+		t.Fatal("expected least recently used entry to be evicted")
+	}
+
+	cache = NewResultCache(ResultCacheOptions{TTL: time.Minute, MaxBytes: 20})
+	cache.put("a", res)
+	cache.put("b", res)
+	if cache.get("a") != nil || cache.get("b") == nil {
+		t.Fatal("expected byte limit to evict the oldest entry")
+	}
+	cache.put("big", &QueryResult{Rows: []map[string]bigquery.Value{{"id": "0123456789012345678901234567890"}}})
+	if cache.get("big") != nil {
+		t.Fatal("expected oversized result not to be cached")
+	}
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	got := normalizeSQL("SELECT  a, -- comment\n /* block */ 'x  y'\nFROM `p.d.t`;\n")
+	want := "SELECT a, 'x  y' FROM `p.d.t`"
+	if got != want {
+		t.Fatalf("normalizeSQL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/decimal128"
+)
+
+// NUMERIC values are exported as 128-bit decimals with BigQuery's precision
+// and scale. BIGNUMERIC exceeds 128 bits and is exported as a string, like
+// INTERVAL and RANGE values.
+const (
+	numericPrecision = 38
+	numericScale     = 9
+)
+
+var numericFactor = new(big.Int).Exp(big.NewInt(10), big.NewInt(numericScale), nil)
+
+// arrowSchema maps a BigQuery result schema to an Arrow schema. Repeated
+// fields become lists and RECORD fields structs.
+func arrowSchema(schema bigquery.Schema) *arrow.Schema {
+	fields := make([]arrow.Field, len(schema))
+	for i, f := range schema {
+		fields[i] = arrowField(f)
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func arrowField(f *bigquery.FieldSchema) arrow.Field {
+	var typ arrow.DataType
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		typ = arrow.PrimitiveTypes.Int64
+	case bigquery.FloatFieldType:
+		typ = arrow.PrimitiveTypes.Float64
+	case bigquery.BooleanFieldType:
+		typ = arrow.FixedWidthTypes.Boolean
+	case bigquery.BytesFieldType:
+		typ = arrow.BinaryTypes.Binary
+	case bigquery.TimestampFieldType:
+		typ = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	case bigquery.DateFieldType:
+		typ = arrow.FixedWidthTypes.Date32
+	case bigquery.TimeFieldType:
+		typ = arrow.FixedWidthTypes.Time64us
+	case bigquery.DateTimeFieldType:
+		typ = &arrow.TimestampType{Unit: arrow.Microsecond}
+	case bigquery.NumericFieldType:
+		typ = &arrow.Decimal128Type{Precision: numericPrecision, Scale: numericScale}
+	case bigquery.RecordFieldType:
+		fields := make([]arrow.Field, len(f.Schema))
+		for i, sub := range f.Schema {
+			fields[i] = arrowField(sub)
+		}
+		typ = arrow.StructOf(fields...)
+	default:
+		typ = arrow.BinaryTypes.String
+	}
+	if f.Repeated {
+		// BigQuery arrays cannot be NULL nor contain NULL elements.
+		return arrow.Field{Name: f.Name, Type: arrow.ListOfNonNullable(typ)}
+	}
+	return arrow.Field{Name: f.Name, Type: typ, Nullable: !f.Required}
+}
+
+// appendArrowRow appends the values of row to the field builders of b.
+func appendArrowRow(b *array.RecordBuilder, schema bigquery.Schema, row map[string]bigquery.Value) error {
+	for i, f := range schema {
+		if err := appendArrowValue(b.Field(i), f, row[f.Name]); err != nil {
+			return fmt.Errorf("column %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func appendArrowValue(b array.Builder, f *bigquery.FieldSchema, v bigquery.Value) error {
+	if f.Repeated {
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		items, _ := v.([]bigquery.Value)
+		item := *f
+		item.Repeated = false
+		for _, x := range items {
+			if err := appendArrowValue(lb.ValueBuilder(), &item, x); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		x, ok := v.(int64)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(x)
+	case *array.Float64Builder:
+		x, ok := v.(float64)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(x)
+	case *array.BooleanBuilder:
+		x, ok := v.(bool)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(x)
+	case *array.BinaryBuilder:
+		x, ok := v.([]byte)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(x)
+	case *array.TimestampBuilder:
+		var t time.Time
+		switch x := v.(type) {
+		case time.Time:
+			t = x
+		case civil.DateTime:
+			t = x.In(time.UTC)
+		default:
+			return typeError(f, v)
+		}
+		b.Append(arrow.Timestamp(t.UnixMicro()))
+	case *array.Date32Builder:
+		x, ok := v.(civil.Date)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(arrow.Date32FromTime(x.In(time.UTC)))
+	case *array.Time64Builder:
+		x, ok := v.(civil.Time)
+		if !ok {
+			return typeError(f, v)
+		}
+		micros := (int64(x.Hour)*3600+int64(x.Minute)*60+int64(x.Second))*1e6 + int64(x.Nanosecond)/1e3
+		b.Append(arrow.Time64(micros))
+	case *array.Decimal128Builder:
+		x, ok := v.(*big.Rat)
+		if !ok {
+			return typeError(f, v)
+		}
+		scaled := new(big.Int).Mul(x.Num(), numericFactor)
+		scaled.Quo(scaled, x.Denom())
+		b.Append(decimal128.FromBigInt(scaled))
+	case *array.StructBuilder:
+		x, ok := v.(map[string]bigquery.Value)
+		if !ok {
+			return typeError(f, v)
+		}
+		b.Append(true)
+		for i, sub := range f.Schema {
+			if err := appendArrowValue(b.FieldBuilder(i), sub, x[sub.Name]); err != nil {
+				return fmt.Errorf("%s: %w", sub.Name, err)
+			}
+		}
+	case *array.StringBuilder:
+		b.Append(cellString(v))
+	default:
+		return fmt.Errorf("unsupported Arrow builder %T", b)
+	}
+	return nil
+}
+
+func typeError(f *bigquery.FieldSchema, v bigquery.Value) error {
+	return fmt.Errorf("unexpected %T value for %s field", v, f.Type)
+}
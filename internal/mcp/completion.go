@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// maxCompletionValues is the maximum number of values in a completion
+	// response allowed by the MCP specification.
+	maxCompletionValues = 100
+	// defaultCompletionTTL is how long listings used for completion are cached.
+	defaultCompletionTTL = time.Minute
+)
+
+// WithCompletionTTL sets how long dataset, table and column listings used
+// for argument completion are cached. Zero disables caching.
+func WithCompletionTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.completionTTL = d
+	}
+}
+
+// completer completes project, dataset, table and column arguments of
+// prompts and of the table resource template.
+type completer struct {
+	s *Server
+}
+
+func (c *completer) CompletePromptArgument(ctx context.Context, _ string, arg mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+	project := cctx.Arguments["dataset_project"]
+	if project == "" {
+		project = c.s.clientProject
+	}
+	return c.complete(ctx, arg, project, cctx.Arguments)
+}
+
+func (c *completer) CompleteResourceArgument(ctx context.Context, _ string, arg mcp.CompleteArgument, cctx mcp.CompleteContext) (*mcp.Completion, error) {
+	if arg.Name == "project" {
+		return newCompletion(c.s.completeProjects(), arg.Value), nil
+	}
+	project := cctx.Arguments["project"]
+	if project == "" {
+		project = c.s.clientProject
+	}
+	return c.complete(ctx, arg, project, cctx.Arguments)
+}
+
+func (c *completer) complete(ctx context.Context, arg mcp.CompleteArgument, project string, args map[string]string) (*mcp.Completion, error) {
+	var candidates []string
+	var err error
+	switch arg.Name {
+	case "dataset_project":
+		candidates = c.s.completeProjects()
+	case "dataset":
+		candidates, err = c.s.completeDatasets(ctx, project)
+	case "table":
+		if args["dataset"] == "" {
+			break
+		}
+		candidates, err = c.s.completeTables(ctx, project, args["dataset"])
+	case "column":
+		if args["dataset"] == "" || args["table"] == "" {
+			break
+		}
+		candidates, err = c.s.completeColumns(ctx, project, args["dataset"], args["table"])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newCompletion(candidates, arg.Value), nil
+}
+
+// completeProjects returns the client project and the projects of the
+// configured datasets.
+func (s *Server) completeProjects() []string {
+	seen := map[string]bool{s.clientProject: true}
+	out := []string{s.clientProject}
+	for _, ds := range s.datasets {
+		if p, _ := s.splitDataset(ds); !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// completeDatasets lists the datasets of project, restricted to the
+// configured datasets when set.
+func (s *Server) completeDatasets(ctx context.Context, project string) ([]string, error) {
+	if len(s.datasets) > 0 {
+		var out []string
+		for _, ds := range s.datasets {
+			if p, d := s.splitDataset(ds); p == project {
+				out = append(out, d)
+			}
+		}
+		return out, nil
+	}
+	return s.completions.get("datasets/"+project, s.completionTTL, func() ([]string, error) {
+		c, err := s.bqClientProvider(ctx, s.clientProject)
+		if err != nil {
+			return nil, err
+		}
+		return c.ListDatasets(ctx, project)
+	})
+}
+
+// completeTables lists the tables of a dataset that pass the table filter.
+func (s *Server) completeTables(ctx context.Context, project, dataset string) ([]string, error) {
+	return s.completions.get("tables/"+project+"/"+dataset, s.completionTTL, func() ([]string, error) {
+		c, err := s.bqClientProvider(ctx, s.clientProject)
+		if err != nil {
+			return nil, err
+		}
+		tables, err := c.ListTables(ctx, project, dataset)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, t := range tables {
+			if s.tableFilter == nil || s.tableFilter.MatchString(t) {
+				out = append(out, t)
+			}
+		}
+		return out, nil
+	})
+}
+
+// completeColumns lists the column paths of a table. Nested fields are
+// returned as dotted paths.
+func (s *Server) completeColumns(ctx context.Context, project, dataset, table string) ([]string, error) {
+	if s.tableFilter != nil && !s.tableFilter.MatchString(table) {
+		return nil, nil
+	}
+	return s.completions.get("columns/"+project+"/"+dataset+"/"+table, s.completionTTL, func() ([]string, error) {
+		c, err := s.bqClientProvider(ctx, s.clientProject)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := c.GetTableSchema(ctx, project, dataset, table)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		walkFields(schema, "", func(path string, _ *bigquery.FieldSchema) {
+			out = append(out, path)
+		})
+		return out, nil
+	})
+}
+
+// newCompletion returns the sorted candidates starting with prefix, capped
+// at maxCompletionValues.
+func newCompletion(candidates []string, prefix string) *mcp.Completion {
+	values := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			values = append(values, c)
+		}
+	}
+	sort.Strings(values)
+	comp := &mcp.Completion{Values: values, Total: len(values)}
+	if len(values) > maxCompletionValues {
+		comp.Values = values[:maxCompletionValues]
+		comp.HasMore = true
+	}
+	return comp
+}
+
+// completionCache caches listings used for completion for a fixed TTL.
+type completionCache struct {
+	mu      sync.Mutex
+	entries map[string]completionEntry
+	now     func() time.Time
+}
+
+type completionEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// get returns the cached values for key or calls load and caches its result.
+// Errors are not cached.
+func (c *completionCache) get(key string, ttl time.Duration, load func() ([]string, error)) ([]string, error) {
+	if ttl <= 0 {
+		return load()
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now().Before(e.expires) {
+		return e.values, nil
+	}
+	values, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]completionEntry)
+	}
+	c.entries[key] = completionEntry{values: values, expires: now().Add(ttl)}
+	c.mu.Unlock()
+	return values, nil
+}
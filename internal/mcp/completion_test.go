@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func TestPromptCompletion(t *testing.T) {
+	mock := &bq.MockClient{DatasetsRes: []string{"sales", "marketing", "sandbox"}, TablesRes: []string{"users", "orders", "user_events"}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithTableFilter(regexp.MustCompile("^u")))
+	pc := &completer{s: srv}
+
+	comp, err := pc.CompletePromptArgument(context.Background(), "explore_table", mcp.CompleteArgument{Name: "dataset", Value: "sa"}, mcp.CompleteContext{})
+	if err != nil {
+		t.Fatalf("complete dataset: %v", err)
+	}
+	if len(comp.Values) != 2 || comp.Values[0] != "sales" || comp.Values[1] != "sandbox" {
+		t.Fatalf("unexpected dataset completion: %#v", comp)
+	}
+
+	comp, err = pc.CompletePromptArgument(context.Background(), "explore_table", mcp.CompleteArgument{Name: "table", Value: "u"},
+		mcp.CompleteContext{Arguments: map[string]string{"dataset": "sales"}})
+	if err != nil {
+		t.Fatalf("complete table: %v", err)
+	}
+	if len(comp.Values) != 2 || comp.Values[0] != "user_events" || comp.Values[1] != "users" {
+		t.Fatalf("unexpected table completion: %#v", comp)
+	}
+
+	comp, err = pc.CompletePromptArgument(context.Background(), "explore_table", mcp.CompleteArgument{Name: "table"}, mcp.CompleteContext{})
+	if err != nil || len(comp.Values) != 0 {
+		t.Fatalf("expected no table completion without dataset: %#v %v", comp, err)
+	}
+}
+
+func TestPromptCompletionConfiguredDatasets(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p", WithDatasets([]string{"a", "other.b", "p.c"}))
+	comp, err := (&completer{s: srv}).CompletePromptArgument(context.Background(), "write_query", mcp.CompleteArgument{Name: "dataset"}, mcp.CompleteContext{})
+	if err != nil {
+		t.Fatalf("complete dataset: %v", err)
+	}
+	if len(comp.Values) != 2 || comp.Values[0] != "a" || comp.Values[1] != "c" {
+		t.Fatalf("unexpected completion: %#v", comp)
+	}
+}
+
+func TestNewCompletionCapsValues(t *testing.T) {
+	var candidates []string
+	for i := 0; i < 150; i++ {
+		candidates = append(candidates, "t"+strconv.Itoa(i))
+	}
+	comp := newCompletion(candidates, "t")
+	if len(comp.Values) != maxCompletionValues || !comp.HasMore || comp.Total != 150 {
+		t.Fatalf("unexpected completion: %d values, hasMore=%v total=%d", len(comp.Values), comp.HasMore, comp.Total)
+	}
+}
+
+type countingClient struct {
+	*bq.MockClient
+	listTables int
+}
+
+func (c *countingClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	c.listTables++
+	return c.MockClient.ListTables(ctx, projectID, datasetID)
+}
+
+func TestResourceCompletion(t *testing.T) {
+	mock := &bq.MockClient{
+		DatasetsRes: []string{"d"},
+		TablesRes:   []string{"users"},
+		SchemaRes: []*bigquery.FieldSchema{
+			{Name: "id", Type: bigquery.StringFieldType},
+			{Name: "address", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{{Name: "city", Type: bigquery.StringFieldType}}},
+		},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithDatasets([]string{"other.d"}))
+	c := &completer{s: srv}
+
+	comp, err := c.CompleteResourceArgument(context.Background(), tableURITemplate, mcp.CompleteArgument{Name: "project"}, mcp.CompleteContext{})
+	if err != nil || len(comp.Values) != 2 || comp.Values[0] != "other" || comp.Values[1] != "p" {
+		t.Fatalf("unexpected project completion: %#v %v", comp, err)
+	}
+	comp, err = c.CompleteResourceArgument(context.Background(), tableURITemplate, mcp.CompleteArgument{Name: "dataset"},
+		mcp.CompleteContext{Arguments: map[string]string{"project": "other"}})
+	if err != nil || len(comp.Values) != 1 || comp.Values[0] != "d" {
+		t.Fatalf("unexpected dataset completion: %#v %v", comp, err)
+	}
+	comp, err = c.CompletePromptArgument(context.Background(), "explore_table", mcp.CompleteArgument{Name: "column", Value: "add"},
+		mcp.CompleteContext{Arguments: map[string]string{"dataset": "d", "table": "users"}})
+	if err != nil || len(comp.Values) != 2 || comp.Values[0] != "address" || comp.Values[1] != "address.city" {
+		t.Fatalf("unexpected column completion: %#v %v", comp, err)
+	}
+}
+
+func TestCompletionCacheTTL(t *testing.T) {
+	client := &countingClient{MockClient: &bq.MockClient{TablesRes: []string{"users"}}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p")
+	now := time.Unix(0, 0)
+	srv.completions.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := srv.completeTables(context.Background(), "p", "d"); err != nil {
+			t.Fatalf("completeTables: %v", err)
+		}
+	}
+	if client.listTables != 1 {
+		t.Fatalf("expected cached listing, got %d calls", client.listTables)
+	}
+	now = now.Add(defaultCompletionTTL + time.Second)
+	if _, err := srv.completeTables(context.Background(), "p", "d"); err != nil {
+		t.Fatalf("completeTables: %v", err)
+	}
+	if client.listTables != 2 {
+		t.Fatalf("expected refresh after TTL, got %d calls", client.listTables)
+	}
+}
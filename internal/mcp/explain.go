@@ -0,0 +1,402 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+const (
+	// maxTimelineSamples bounds the number of timeline samples returned.
+	maxTimelineSamples = 20
+	// maxSubsteps bounds the number of substeps listed per plan step.
+	maxSubsteps   = 5
+	maxStepLength = 200
+
+	// skewRatio is the ratio of maximum to average compute time above
+	// which a stage is reported as skewed.
+	skewRatio = 5.0
+	// minSkewCompute ignores skew in stages that finish quickly anyway.
+	minSkewCompute = time.Second
+	// fullScanRecords is the number of records read without a filter above
+	// which a full scan is reported.
+	fullScanRecords = 1000000
+)
+
+// aliasPattern matches the column aliases declared in READ steps, e.g.
+// "$1:user_id".
+var aliasPattern = regexp.MustCompile(`\$(\d+):([A-Za-z_][A-Za-z0-9_]*)`)
+
+type explainArgs struct {
+	JobID          string `json:"job_id,omitempty"`
+	Location       string `json:"location,omitempty"`
+	SQL            string `json:"sql,omitempty"`
+	StatisticsFile string `json:"statistics_file,omitempty"`
+}
+
+type stageSummary struct {
+	ID                        int64    `json:"id"`
+	Name                      string   `json:"name"`
+	Status                    string   `json:"status,omitempty"`
+	Inputs                    []int64  `json:"inputs,omitempty"`
+	ParallelInputs            int64    `json:"parallel_inputs"`
+	RecordsRead               int64    `json:"records_read"`
+	RecordsWritten            int64    `json:"records_written"`
+	ShuffleOutputBytes        int64    `json:"shuffle_output_bytes"`
+	ShuffleOutputBytesSpilled int64    `json:"shuffle_output_bytes_spilled,omitempty"`
+	DurationMs                int64    `json:"duration_ms,omitempty"`
+	WaitAvgMs                 int64    `json:"wait_avg_ms"`
+	ComputeAvgMs              int64    `json:"compute_avg_ms"`
+	ComputeMaxMs              int64    `json:"compute_max_ms"`
+	Skew                      float64  `json:"skew,omitempty"`
+	Steps                     []string `json:"steps,omitempty"`
+}
+
+type timelineSample struct {
+	ElapsedMs   int64 `json:"elapsed_ms"`
+	ActiveUnits int64 `json:"active_units"`
+	Pending     int64 `json:"pending_units"`
+	Completed   int64 `json:"completed_units"`
+	SlotMs      int64 `json:"slot_ms"`
+}
+
+// finding is a heuristic observation about a query plan.
+type finding struct {
+	Rule    string `json:"rule"`
+	Stage   *int64 `json:"stage,omitempty"`
+	Message string `json:"message"`
+}
+
+type explainOutput struct {
+	JobID               string           `json:"job_id,omitempty"`
+	StatementType       string           `json:"statement_type,omitempty"`
+	CacheHit            bool             `json:"cache_hit,omitempty"`
+	TotalBytesProcessed int64            `json:"total_bytes_processed"`
+	TotalBytesBilled    int64            `json:"total_bytes_billed"`
+	SlotMs              int64            `json:"slot_ms"`
+	ElapsedMs           int64            `json:"elapsed_ms,omitempty"`
+	PeakActiveUnits     int64            `json:"peak_active_units,omitempty"`
+	Stages              []stageSummary   `json:"stages"`
+	Timeline            []timelineSample `json:"timeline,omitempty"`
+	Findings            []finding        `json:"findings"`
+}
+
+// explainHandler summarizes the query plan of a job. The statistics come
+// from an existing job, from running sql, or from a recorded job file; the
+// latter works offline.
+func (s *Server) explainHandler(ctx context.Context, _ mcp.CallToolRequest, args explainArgs) (*mcp.CallToolResult, error) {
+	n := 0
+	for _, v := range []string{args.JobID, args.SQL, args.StatisticsFile} {
+		if v != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("exactly one of job_id, sql or statistics_file is required")
+	}
+
+	var stats *bigquery.JobStatistics
+	var c bq.Client
+	jobID := args.JobID
+	if args.StatisticsFile != "" {
+		data, err := os.ReadFile(args.StatisticsFile)
+		if err != nil {
+			return nil, err
+		}
+		if stats, err = bq.ParseJobStatistics(data); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", args.StatisticsFile, err)
+		}
+	} else {
+		var err error
+		if c, err = s.bqClientProvider(ctx, s.clientProject); err != nil {
+			return nil, err
+		}
+		location := args.Location
+		if args.SQL != "" {
+			ctx := s.queryContext(ctx, "explain")
+			if maxBytes := maxQueryBytes(); maxBytes > 0 {
+				dry, err := c.DryRunQuery(ctx, args.SQL)
+				if err != nil {
+					return nil, err
+				}
+				if dry.TotalBytesProcessed > maxBytes {
+					return nil, fmt.Errorf("query would scan %d bytes (limit %d)", dry.TotalBytesProcessed, maxBytes)
+				}
+			}
+			// Only the job is explained; its rows are not read.
+			res, err := c.ExecuteQuery(ctx, args.SQL)
+			if err != nil {
+				return nil, err
+			}
+			if res.JobID == "" {
+				return nil, fmt.Errorf("query did not report a job ID")
+			}
+			jobID, location = res.JobID, res.Location
+		}
+		if stats, err = c.JobStatistics(ctx, jobID, location); err != nil {
+			return nil, err
+		}
+	}
+	qs, ok := stats.Details.(*bigquery.QueryStatistics)
+	if !ok {
+		return nil, fmt.Errorf("job %s is not a query job", jobID)
+	}
+
+	out := summarizePlan(stats, qs)
+	out.JobID = jobID
+	partitions := map[string]string{}
+	if c != nil {
+		partitions = s.partitionColumns(ctx, c, qs.ReferencedTables)
+	}
+	out.Findings = planFindings(qs.QueryPlan, partitions)
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+// summarizePlan condenses job statistics into stage and timeline summaries.
+func summarizePlan(stats *bigquery.JobStatistics, qs *bigquery.QueryStatistics) *explainOutput {
+	out := &explainOutput{
+		StatementType:       qs.StatementType,
+		CacheHit:            qs.CacheHit,
+		TotalBytesProcessed: qs.TotalBytesProcessed,
+		TotalBytesBilled:    qs.TotalBytesBilled,
+		SlotMs:              qs.SlotMillis,
+		Stages:              []stageSummary{},
+		Findings:            []finding{},
+	}
+	if out.SlotMs == 0 {
+		out.SlotMs = stats.TotalSlotDuration.Milliseconds()
+	}
+	if !stats.StartTime.IsZero() && !stats.EndTime.IsZero() {
+		out.ElapsedMs = stats.EndTime.Sub(stats.StartTime).Milliseconds()
+	}
+	for _, st := range qs.QueryPlan {
+		sum := stageSummary{
+			ID:                        st.ID,
+			Name:                      st.Name,
+			Status:                    st.Status,
+			Inputs:                    st.InputStages,
+			ParallelInputs:            st.ParallelInputs,
+			RecordsRead:               st.RecordsRead,
+			RecordsWritten:            st.RecordsWritten,
+			ShuffleOutputBytes:        st.ShuffleOutputBytes,
+			ShuffleOutputBytesSpilled: st.ShuffleOutputBytesSpilled,
+			WaitAvgMs:                 st.WaitAvg.Milliseconds(),
+			ComputeAvgMs:              st.ComputeAvg.Milliseconds(),
+			ComputeMaxMs:              st.ComputeMax.Milliseconds(),
+		}
+		if !st.StartTime.IsZero() && !st.EndTime.IsZero() {
+			sum.DurationMs = st.EndTime.Sub(st.StartTime).Milliseconds()
+		}
+		if st.ComputeAvg > 0 {
+			sum.Skew = math.Round(float64(st.ComputeMax)/float64(st.ComputeAvg)*100) / 100
+		}
+		for _, step := range st.Steps {
+			sum.Steps = append(sum.Steps, stepString(step))
+		}
+		out.Stages = append(out.Stages, sum)
+	}
+	for _, t := range qs.Timeline {
+		out.PeakActiveUnits = max(out.PeakActiveUnits, t.ActiveUnits)
+	}
+	if out.ElapsedMs == 0 && len(qs.Timeline) > 0 {
+		out.ElapsedMs = qs.Timeline[len(qs.Timeline)-1].Elapsed.Milliseconds()
+	}
+	for _, i := range sampleIndexes(len(qs.Timeline), maxTimelineSamples) {
+		t := qs.Timeline[i]
+		out.Timeline = append(out.Timeline, timelineSample{
+			ElapsedMs:   t.Elapsed.Milliseconds(),
+			ActiveUnits: t.ActiveUnits,
+			Pending:     t.PendingUnits,
+			Completed:   t.CompletedUnits,
+			SlotMs:      t.SlotMillis,
+		})
+	}
+	return out
+}
+
+// sampleIndexes picks at most k evenly spaced indexes of n items, always
+// including the last one.
+func sampleIndexes(n, k int) []int {
+	if n <= k {
+		out := make([]int, n)
+		for i := range out {
+			out[i] = i
+		}
+		return out
+	}
+	out := make([]int, k)
+	for i := range out {
+		out[i] = (i + 1) * n / k
+		out[i]--
+	}
+	return out
+}
+
+// stepString renders a plan step as "KIND: substep; substep".
+func stepString(step *bigquery.ExplainQueryStep) string {
+	subs := step.Substeps
+	more := 0
+	if len(subs) > maxSubsteps {
+		subs, more = subs[:maxSubsteps], len(subs)-maxSubsteps
+	}
+	s := step.Kind + ": " + strings.Join(subs, "; ")
+	if more > 0 {
+		s += fmt.Sprintf("; …(%d more)", more)
+	}
+	if len(s) > maxStepLength {
+		cut := maxStepLength
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "…"
+	}
+	return s
+}
+
+// partitionColumns returns the partitioning column of each partitioned
+// referenced table, keyed by "project.dataset.table". Ingestion-time
+// partitioned tables map to _PARTITIONTIME. Tables whose metadata cannot be
+// read are skipped.
+func (s *Server) partitionColumns(ctx context.Context, c bq.Client, tables []*bigquery.Table) map[string]string {
+	out := map[string]string{}
+	for _, t := range tables {
+		meta, err := c.GetTableMetadata(ctx, t.ProjectID, t.DatasetID, t.TableID)
+		if err != nil || meta == nil {
+			continue
+		}
+		key := t.ProjectID + "." + t.DatasetID + "." + t.TableID
+		switch {
+		case meta.TimePartitioning != nil && meta.TimePartitioning.Field != "":
+			out[key] = meta.TimePartitioning.Field
+		case meta.TimePartitioning != nil:
+			out[key] = "_PARTITIONTIME"
+		case meta.RangePartitioning != nil:
+			out[key] = meta.RangePartitioning.Field
+		}
+	}
+	return out
+}
+
+// planFindings applies heuristics to a query plan. partitions maps
+// partitioned tables to their partitioning column; without it, unfiltered
+// reads of large tables are reported as full scans instead.
+func planFindings(plan []*bigquery.ExplainQueryStage, partitions map[string]string) []finding {
+	findings := []finding{}
+	add := func(rule string, st *bigquery.ExplainQueryStage, format string, a ...any) {
+		id := st.ID
+		findings = append(findings, finding{Rule: rule, Stage: &id, Message: fmt.Sprintf(format, a...)})
+	}
+	for _, st := range plan {
+		hasSort, hasLimit := false, false
+		for _, step := range st.Steps {
+			switch step.Kind {
+			case "READ":
+				table, filtered := readFilter(step, partitions)
+				if table == "" {
+					break
+				}
+				if col, ok := partitions[table]; ok && !filtered {
+					add("missing_partition_filter", st, "%s reads partitioned table %s without filtering on %s; add a partition filter to prune partitions", st.Name, table, col)
+				} else if !ok && !hasWhere(step) && st.RecordsRead >= fullScanRecords {
+					add("full_scan", st, "%s reads %d records from %s without a filter", st.Name, st.RecordsRead, table)
+				}
+			case "JOIN":
+				for _, sub := range step.Substeps {
+					if strings.Contains(strings.ToUpper(sub), "CROSS") {
+						add("cross_join", st, "%s performs a CROSS JOIN (%s); add a join condition or filter the inputs first", st.Name, sub)
+						break
+					}
+				}
+			case "SORT":
+				hasSort = true
+			case "LIMIT":
+				hasLimit = true
+			}
+		}
+		if hasSort && !hasLimit && st.RecordsWritten >= fullScanRecords {
+			add("unbounded_sort", st, "%s sorts %d records without a LIMIT; large sorts run on a single worker", st.Name, st.RecordsWritten)
+		}
+		if st.ComputeAvg > 0 && st.ComputeMax >= minSkewCompute && float64(st.ComputeMax) >= skewRatio*float64(st.ComputeAvg) {
+			add("skew", st, "%s is skewed: the slowest worker computed for %s versus %s on average; check for hot keys in joins and GROUP BY", st.Name, st.ComputeMax, st.ComputeAvg)
+		}
+		if st.ShuffleOutputBytesSpilled > 0 {
+			add("spill", st, "%s spilled %d shuffle bytes to disk; reduce the data shuffled by filtering or aggregating earlier", st.Name, st.ShuffleOutputBytesSpilled)
+		}
+	}
+	return findings
+}
+
+// readFilter returns the table read by a READ step and whether its WHERE
+// substep references the table's partitioning column.
+func readFilter(step *bigquery.ExplainQueryStep, partitions map[string]string) (table string, filtered bool) {
+	aliases := map[string]string{}
+	var where []string
+	for _, sub := range step.Substeps {
+		switch {
+		case strings.HasPrefix(sub, "FROM "):
+			table = strings.Trim(strings.TrimSpace(strings.TrimPrefix(sub, "FROM ")), "`")
+			if i := strings.IndexByte(table, ' '); i >= 0 {
+				table = table[:i]
+			}
+		case strings.HasPrefix(sub, "WHERE "):
+			where = append(where, sub)
+		default:
+			for _, m := range aliasPattern.FindAllStringSubmatch(sub, -1) {
+				aliases["$"+m[1]] = m[2]
+			}
+		}
+	}
+	col := partitions[table]
+	if col == "" {
+		return table, false
+	}
+	for _, w := range where {
+		if strings.Contains(w, col) || strings.Contains(w, "_PARTITION") {
+			return table, true
+		}
+		for alias, name := range aliases {
+			if strings.EqualFold(name, col) && containsAlias(w, alias) {
+				return table, true
+			}
+		}
+	}
+	return table, false
+}
+
+// containsAlias reports whether s references alias as a whole token, so
+// that "$1" does not match "$10".
+func containsAlias(s, alias string) bool {
+	for i := strings.Index(s, alias); i >= 0; {
+		end := i + len(alias)
+		if end >= len(s) || s[end] < '0' || s[end] > '9' {
+			return true
+		}
+		next := strings.Index(s[end:], alias)
+		if next < 0 {
+			return false
+		}
+		i = end + next
+	}
+	return false
+}
+
+func hasWhere(step *bigquery.ExplainQueryStep) bool {
+	for _, sub := range step.Substeps {
+		if strings.HasPrefix(sub, "WHERE ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// tableMetadataClient serves metadata per table ID.
+type tableMetadataClient struct {
+	*bq.MockClient
+	tables map[string]*bigquery.TableMetadata
+}
+
+func (c *tableMetadataClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	return c.tables[tableID], nil
+}
+
+func findingRules(fs []finding) map[string]int64 {
+	out := map[string]int64{}
+	for _, f := range fs {
+		out[f.Rule] = *f.Stage
+	}
+	return out
+}
+
+func TestExplainHandlerOffline(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) {
+		t.Fatal("offline explain must not create a client")
+		return nil, nil
+	}, "p")
+
+	res, err := srv.explainHandler(context.Background(), mcp.CallToolRequest{}, explainArgs{StatisticsFile: "testdata/explain_job.json"})
+	if err != nil {
+		t.Fatalf("explainHandler error: %v", err)
+	}
+	out := res.StructuredContent.(*explainOutput)
+	if out.SlotMs != 90000 || out.ElapsedMs != 12000 || out.PeakActiveUnits != 120 || len(out.Timeline) != 3 || len(out.Stages) != 3 {
+		t.Fatalf("unexpected summary: %+v", out)
+	}
+	join := out.Stages[2]
+	if len(join.Inputs) != 2 || join.Skew != 9 || join.ShuffleOutputBytesSpilled != 400000000 || join.Steps[0] != "JOIN: CROSS EACH WITH ALL" {
+		t.Fatalf("unexpected join stage: %+v", join)
+	}
+	rules := findingRules(out.Findings)
+	want := map[string]int64{"full_scan": 0, "cross_join": 2, "unbounded_sort": 2, "skew": 2, "spill": 2}
+	if len(rules) != len(want) {
+		t.Fatalf("unexpected findings: %+v", out.Findings)
+	}
+	for rule, stage := range want {
+		if got, ok := rules[rule]; !ok || got != stage {
+			t.Fatalf("expected %s finding on stage %d, got %+v", rule, stage, out.Findings)
+		}
+	}
+}
+
+func TestExplainHandlerPartitionFilter(t *testing.T) {
+	data, err := os.ReadFile("testdata/explain_job.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := bq.ParseJobStatistics(data)
+	if err != nil {
+		t.Fatalf("ParseJobStatistics: %v", err)
+	}
+	mock := &tableMetadataClient{MockClient: &bq.MockClient{JobStatsRes: stats}, tables: map[string]*bigquery.TableMetadata{
+		"events": {TimePartitioning: &bigquery.TimePartitioning{Field: "ts"}},
+		"users":  {RangePartitioning: &bigquery.RangePartitioning{Field: "id"}},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	res, err := srv.explainHandler(context.Background(), mcp.CallToolRequest{}, explainArgs{JobID: "job_123"})
+	if err != nil {
+		t.Fatalf("explainHandler error: %v", err)
+	}
+	out := res.StructuredContent.(*explainOutput)
+	rules := findingRules(out.Findings)
+	if stage, ok := rules["missing_partition_filter"]; !ok || stage != 0 || out.JobID != "job_123" {
+		t.Fatalf("expected missing partition filter on stage 0: %+v", out.Findings)
+	}
+	if _, ok := rules["full_scan"]; ok {
+		t.Fatalf("partitioned table should not also be reported as a full scan: %+v", out.Findings)
+	}
+
+	if len(rules) != 5 {
+		t.Fatalf("unexpected findings: %+v", out.Findings)
+	}
+	for _, f := range out.Findings {
+		// The read of users filters on its partitioning column.
+		if *f.Stage == 1 {
+			t.Fatalf("filtered read reported: %+v", f)
+		}
+	}
+}
+
+func TestExplainHandlerArgs(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p")
+	for _, args := range []explainArgs{{}, {JobID: "j", SQL: "SELECT 1"}} {
+		if _, err := srv.explainHandler(context.Background(), mcp.CallToolRequest{}, args); err == nil {
+			t.Fatalf("expected %+v to be rejected", args)
+		}
+	}
+	if _, err := srv.explainHandler(context.Background(), mcp.CallToolRequest{}, explainArgs{SQL: "SELECT 1"}); err == nil {
+		t.Fatal("expected a query without job ID to be rejected")
+	}
+}
+
+// executeClient runs queries without rows.
+type executeClient struct {
+	*bq.MockClient
+	t *testing.T
+}
+
+func (c *executeClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	c.t.Fatal("explain must not read the rows of the query")
+	return nil, nil
+}
+
+func (c *executeClient) ExecuteQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	return &bq.QueryResult{JobID: "job_1", Location: "US"}, nil
+}
+
+func TestExplainHandlerSQL(t *testing.T) {
+	data, err := os.ReadFile("testdata/explain_job.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := bq.ParseJobStatistics(data)
+	if err != nil {
+		t.Fatalf("ParseJobStatistics: %v", err)
+	}
+	mock := &executeClient{MockClient: &bq.MockClient{JobStatsRes: stats}, t: t}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+	res, err := srv.explainHandler(context.Background(), mcp.CallToolRequest{}, explainArgs{SQL: "SELECT 1"})
+	if err != nil {
+		t.Fatalf("explainHandler error: %v", err)
+	}
+	if out := res.StructuredContent.(*explainOutput); out.JobID != "job_1" {
+		t.Fatalf("unexpected job: %+v", out)
+	}
+}
+
+func TestSampleIndexes(t *testing.T) {
+	got := sampleIndexes(100, 4)
+	if len(got) != 4 || got[0] != 24 || got[3] != 99 {
+		t.Fatalf("sampleIndexes = %v", got)
+	}
+}
+
+func TestContainsAlias(t *testing.T) {
+	if !containsAlias("WHERE equal($10, 1)", "$10") || containsAlias("WHERE equal($10, 1)", "$1") || !containsAlias("WHERE and($10, $1)", "$1") {
+		t.Fatal("containsAlias must match whole aliases only")
+	}
+}
+
+func TestStepStringCutsRunes(t *testing.T) {
+	// 'あ' takes three bytes, so the limit falls inside a rune.
+	s := stepString(&bigquery.ExplainQueryStep{Kind: "READ", Substeps: []string{"x" + strings.Repeat("あ", maxStepLength)}})
+	if !utf8.ValidString(s) || !strings.HasSuffix(s, "…") || len(s) > maxStepLength+len("…") {
+		t.Fatalf("stepString = %q", s)
+	}
+}
@@ -0,0 +1,436 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/apache/arrow/go/v15/parquet"
+	"github.com/apache/arrow/go/v15/parquet/compress"
+	"github.com/apache/arrow/go/v15/parquet/pqarrow"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Export file formats.
+const (
+	exportCSV     = "csv"
+	exportJSONL   = "jsonl"
+	exportParquet = "parquet"
+	exportArrow   = "arrow"
+)
+
+// exportExtensions maps file extensions to export formats.
+var exportExtensions = map[string]string{
+	".csv":     exportCSV,
+	".jsonl":   exportJSONL,
+	".ndjson":  exportJSONL,
+	".parquet": exportParquet,
+	".arrow":   exportArrow,
+	".arrows":  exportArrow,
+	".ipc":     exportArrow,
+	".feather": exportArrow,
+}
+
+// exportBatchRows is the number of rows buffered per Arrow record batch,
+// which is also the Parquet row group size.
+const exportBatchRows = 64 * 1024
+
+// ExportConfig configures the export tool, which writes query results to
+// files under Dir. The tool is only offered when Dir is set. MaxBytes limits
+// the size of each file; zero disables the limit.
+type ExportConfig struct {
+	Dir      string
+	MaxBytes int64
+}
+
+// WithExport enables the export tool.
+func WithExport(cfg ExportConfig) Option {
+	return func(s *Server) {
+		s.export = cfg
+	}
+}
+
+type exportArgs struct {
+	SQL       string `json:"sql"`
+	Path      string `json:"path,omitempty"`
+	Format    string `json:"format,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type exportOutput struct {
+	Path      string `json:"path"`
+	Format    string `json:"format"`
+	TotalRows uint64 `json:"total_rows"`
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+	JobID     string `json:"job_id,omitempty"`
+}
+
+// registerExport installs the export tool when an output directory is
+// configured.
+func (s *Server) registerExport() {
+	if s.export.Dir == "" {
+		return
+	}
+	s.mcpServer.AddTool(mcp.NewTool(
+		"export",
+		mcp.WithDescription("Run BigQuery SQL and stream the full result to a local file instead of returning rows; returns the file path, row count and SHA-256 checksum"),
+		mcp.WithString("sql", mcp.Required()),
+		mcp.WithString("path", mcp.Description("File path relative to the export directory; defaults to a generated name")),
+		mcp.WithString("format", mcp.Enum(exportCSV, exportJSONL, exportParquet, exportArrow),
+			mcp.Description("File format (Arrow is the IPC file format); defaults to the format matching the path extension, or csv")),
+		mcp.WithBoolean("overwrite", mcp.Description("Replace an existing file")),
+		mcp.WithNumber("max_bytes", mcp.Description("Abort the export once the file would exceed this size; may only lower the server limit")),
+		mcp.WithRawOutputSchema(exportOutputSchema),
+	), mcp.NewTypedToolHandler(s.exportHandler))
+}
+
+func (s *Server) exportHandler(ctx context.Context, req mcp.CallToolRequest, args exportArgs) (*mcp.CallToolResult, error) {
+	tool := toolName(req, "export")
+	format, name, err := exportTarget(args.Path, args.Format, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(s.export.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	if !args.Overwrite {
+		if _, err := root.Stat(name); err == nil {
+			return nil, fmt.Errorf("%s already exists; pass overwrite to replace it", name)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	limit := s.export.MaxBytes
+	if args.MaxBytes > 0 && (limit <= 0 || args.MaxBytes < limit) {
+		limit = args.MaxBytes
+	}
+
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	s.logQuery(tool, args.SQL)
+	ctx = s.queryContext(ctx, tool)
+	if maxBytes := maxQueryBytes(); maxBytes > 0 {
+		stats, err := c.DryRunQuery(ctx, args.SQL)
+		if err != nil {
+			return nil, err
+		}
+		if stats.TotalBytesProcessed > maxBytes {
+			return nil, fmt.Errorf("query would scan %d bytes (limit %d)", stats.TotalBytesProcessed, maxBytes)
+		}
+	}
+
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	// Write to a temporary file renamed into place once complete, so that
+	// a failed export leaves no partial file behind.
+	f, tmp, err := createTemp(root, name)
+	if err != nil {
+		return nil, err
+	}
+	sink := newExportSink(f, limit)
+	w := newExportWriter(format, sink)
+	defer w.Release()
+	res, err := c.StreamQuery(ctx, args.SQL, w)
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = sink.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = root.Rename(tmp, name)
+	}
+	if err != nil {
+		root.Remove(tmp)
+		if sink.exceeded {
+			return nil, fmt.Errorf("export exceeds the size limit of %d bytes; narrow the query or raise max_bytes", limit)
+		}
+		return nil, err
+	}
+
+	out := exportOutput{
+		Path:      filepath.Join(s.export.Dir, name),
+		Format:    format,
+		TotalRows: res.TotalRows,
+		Bytes:     sink.n,
+		SHA256:    hex.EncodeToString(sink.hash.Sum(nil)),
+		JobID:     res.JobID,
+	}
+	if abs, err := filepath.Abs(out.Path); err == nil {
+		out.Path = abs
+	}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+// createTemp creates a new file next to name in root, with a random suffix
+// so that concurrent exports to the same path do not share it. os.Root has
+// no CreateTemp.
+func createTemp(root *os.Root, name string) (*os.File, string, error) {
+	for range 16 {
+		tmp := fmt.Sprintf("%s.%s.partial", name, rand.Text()[:8])
+		f, err := root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, tmp, err
+	}
+	return nil, "", fmt.Errorf("cannot create a temporary file for %s", name)
+}
+
+// exportTarget determines the format and the file name of an export. The
+// format defaults to the one matching the extension of path, and path to a
+// name generated from now.
+func exportTarget(path, format string, now time.Time) (string, string, error) {
+	if format == "" && path != "" {
+		format = exportExtensions[strings.ToLower(filepath.Ext(path))]
+	}
+	switch format {
+	case "":
+		format = exportCSV
+	case exportCSV, exportJSONL, exportParquet, exportArrow:
+	default:
+		return "", "", fmt.Errorf("unknown export format %q", format)
+	}
+	if path == "" {
+		path = "export-" + now.UTC().Format("20060102T150405.000000000Z") + "." + format
+	}
+	path = filepath.Clean(filepath.FromSlash(path))
+	if !filepath.IsLocal(path) {
+		return "", "", fmt.Errorf("path %q must be relative and stay within the export directory", path)
+	}
+	return format, path, nil
+}
+
+// exportSink buffers, counts and hashes the bytes of an export file and
+// enforces its size limit.
+type exportSink struct {
+	buf      *bufio.Writer
+	hash     hash.Hash
+	n, limit int64
+	exceeded bool
+}
+
+func newExportSink(w io.Writer, limit int64) *exportSink {
+	return &exportSink{buf: bufio.NewWriter(w), hash: sha256.New(), limit: limit}
+}
+
+func (s *exportSink) Write(p []byte) (int, error) {
+	if s.limit > 0 && s.n+int64(len(p)) > s.limit {
+		s.exceeded = true
+		return 0, errors.New("export size limit exceeded")
+	}
+	n, err := s.buf.Write(p)
+	s.hash.Write(p[:n])
+	s.n += int64(n)
+	return n, err
+}
+
+// Seek reports the current offset, which is all the Arrow IPC writer needs.
+func (s *exportSink) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekCurrent {
+		return 0, errors.New("export files are written sequentially")
+	}
+	return s.n, nil
+}
+
+func (s *exportSink) Flush() error {
+	return s.buf.Flush()
+}
+
+// exportWriter is a RowWriter that encodes rows into an export file. Close
+// completes the file once the rows have been written; Release frees the
+// buffers of the writer, whether or not the file was completed.
+type exportWriter interface {
+	bq.RowWriter
+	Close() error
+	Release()
+}
+
+func newExportWriter(format string, sink io.Writer) exportWriter {
+	switch format {
+	case exportJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(sink)}
+	case exportParquet:
+		return &arrowWriter{sink: sink, parquet: true}
+	case exportArrow:
+		return &arrowWriter{sink: sink}
+	default:
+		return &csvWriter{w: csv.NewWriter(sink)}
+	}
+}
+
+// csvWriter writes a header line followed by one line per row. Values are
+// rendered like in CSV query results.
+type csvWriter struct {
+	w      *csv.Writer
+	schema bigquery.Schema
+	record []string
+}
+
+func (w *csvWriter) WriteSchema(schema bigquery.Schema) error {
+	w.schema = schema
+	w.record = make([]string, len(schema))
+	for i, f := range schema {
+		w.record[i] = f.Name
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) WriteRow(row map[string]bigquery.Value) error {
+	for i, f := range w.schema {
+		w.record[i] = cellString(row[f.Name])
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Release() {}
+
+// jsonlWriter writes one JSON object per row. NUMERIC values are written as
+// decimal strings to keep their precision.
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) WriteSchema(bigquery.Schema) error {
+	return nil
+}
+
+func (w *jsonlWriter) WriteRow(row map[string]bigquery.Value) error {
+	return w.enc.Encode(jsonValue(row))
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+func (w *jsonlWriter) Release() {}
+
+// jsonValue replaces the values of v whose JSON encoding is not their
+// canonical form.
+func jsonValue(v bigquery.Value) bigquery.Value {
+	switch x := v.(type) {
+	case *big.Rat:
+		return cellString(x)
+	case []bigquery.Value:
+		out := make([]bigquery.Value, len(x))
+		for i, e := range x {
+			out[i] = jsonValue(e)
+		}
+		return out
+	case map[string]bigquery.Value:
+		out := make(map[string]bigquery.Value, len(x))
+		for k, e := range x {
+			out[k] = jsonValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// arrowWriter buffers rows into Arrow record batches written to an Arrow
+// IPC file or, with parquet set, to a Parquet file with one row group per
+// batch.
+type arrowWriter struct {
+	sink    io.Writer
+	parquet bool
+
+	schema  bigquery.Schema
+	builder *array.RecordBuilder
+	rows    int
+	write   func(arrow.Record) error
+	close   func() error
+}
+
+func (w *arrowWriter) WriteSchema(schema bigquery.Schema) error {
+	w.schema = schema
+	as := arrowSchema(schema)
+	w.builder = array.NewRecordBuilder(memory.DefaultAllocator, as)
+	if w.parquet {
+		props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy), parquet.WithMaxRowGroupLength(exportBatchRows))
+		fw, err := pqarrow.NewFileWriter(as, w.sink, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+		if err != nil {
+			return err
+		}
+		w.write, w.close = fw.Write, fw.Close
+		return nil
+	}
+	fw, err := ipc.NewFileWriter(w.sink.(io.WriteSeeker), ipc.WithSchema(as))
+	if err != nil {
+		return err
+	}
+	w.write, w.close = fw.Write, fw.Close
+	return nil
+}
+
+func (w *arrowWriter) WriteRow(row map[string]bigquery.Value) error {
+	if err := appendArrowRow(w.builder, w.schema, row); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows == exportBatchRows {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *arrowWriter) flush() error {
+	rec := w.builder.NewRecord()
+	defer rec.Release()
+	w.rows = 0
+	return w.write(rec)
+}
+
+func (w *arrowWriter) Close() error {
+	if w.rows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	return w.close()
+}
+
+func (w *arrowWriter) Release() {
+	if w.builder != nil {
+		w.builder.Release()
+		w.builder = nil
+	}
+}
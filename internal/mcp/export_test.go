@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/apache/arrow/go/v15/parquet/file"
+	"github.com/apache/arrow/go/v15/parquet/pqarrow"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// exportSchema and exportRows cover every column kind written by the export
+// formats.
+var exportSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+	{Name: "name", Type: bigquery.StringFieldType},
+	{Name: "amount", Type: bigquery.NumericFieldType},
+	{Name: "day", Type: bigquery.DateFieldType},
+	{Name: "at", Type: bigquery.TimestampFieldType},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "addr", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "city", Type: bigquery.StringFieldType},
+	}},
+}
+
+var exportRows = []map[string]bigquery.Value{
+	{"id": int64(1), "name": "alice", "amount": big.NewRat(25, 2), "day": civil.Date{Year: 2024, Month: 1, Day: 2},
+		"at": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "tags": []bigquery.Value{"a", "b"}, "addr": map[string]bigquery.Value{"city": "Tokyo"}},
+	{"id": int64(2), "name": nil, "amount": nil, "day": nil, "at": nil, "tags": []bigquery.Value{}, "addr": nil},
+}
+
+func TestExportTextFormats(t *testing.T) {
+	dir := t.TempDir()
+	mock := &bq.MockClient{QuerySchemaRes: exportSchema, QueryRes: exportRows}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p",
+		WithExport(ExportConfig{Dir: dir}))
+
+	res, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "out/users.csv"})
+	if err != nil {
+		t.Fatalf("exportHandler error: %v", err)
+	}
+	out := res.StructuredContent.(exportOutput)
+	if out.Format != exportCSV || out.Path != filepath.Join(dir, "out", "users.csv") || out.TotalRows != 2 {
+		t.Errorf("export = %+v", out)
+	}
+	data, _ := os.ReadFile(out.Path)
+	want := "id,name,amount,day,at,tags,addr\n" +
+		`1,alice,12.5,2024-01-02,2024-01-02T03:04:05Z,"[""a"",""b""]","{""city"":""Tokyo""}"` + "\n" +
+		"2,,,,,[],\n"
+	if string(data) != want {
+		t.Errorf("csv =\n%s\nwant\n%s", data, want)
+	}
+	sum := sha256.Sum256(data)
+	if out.SHA256 != hex.EncodeToString(sum[:]) || out.Bytes != int64(len(data)) {
+		t.Errorf("checksum %s (%d bytes) does not match the file", out.SHA256, out.Bytes)
+	}
+
+	res, err = srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "users.ndjson"})
+	if err != nil {
+		t.Fatalf("exportHandler error: %v", err)
+	}
+	out = res.StructuredContent.(exportOutput)
+	data, _ = os.ReadFile(out.Path)
+	if out.Format != exportJSONL || !strings.HasPrefix(string(data), `{"addr":{"city":"Tokyo"},"amount":"12.5",`) {
+		t.Errorf("jsonl export %s =\n%s", out.Format, data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("export directory holds %d entries, want no leftover temporary files", len(entries))
+	}
+}
+
+func TestExportColumnarFormats(t *testing.T) {
+	dir := t.TempDir()
+	mock := &bq.MockClient{QuerySchemaRes: exportSchema, QueryRes: exportRows}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p",
+		WithExport(ExportConfig{Dir: dir}))
+
+	res, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "users.parquet"})
+	if err != nil {
+		t.Fatalf("exportHandler error: %v", err)
+	}
+	f, err := file.OpenParquetFile(res.StructuredContent.(exportOutput).Path, false)
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	defer f.Close()
+	r, err := pqarrow.NewFileReader(f, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("parquet reader: %v", err)
+	}
+	tbl, err := r.ReadTable(context.Background())
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	defer tbl.Release()
+	if tbl.NumRows() != 2 || tbl.NumCols() != 7 {
+		t.Fatalf("parquet table has %d rows and %d columns", tbl.NumRows(), tbl.NumCols())
+	}
+	if got := tbl.Column(2).Data().Chunk(0).(*array.Decimal128).ValueStr(0); got != "12.5" {
+		t.Errorf("amount = %s", got)
+	}
+
+	res, err = srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "users.bin", Format: exportArrow})
+	if err != nil {
+		t.Fatalf("exportHandler error: %v", err)
+	}
+	data, _ := os.ReadFile(res.StructuredContent.(exportOutput).Path)
+	ar, err := ipc.NewFileReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("open arrow file: %v", err)
+	}
+	defer ar.Close()
+	rec, err := ar.Record(0)
+	if err != nil {
+		t.Fatalf("read record: %v", err)
+	}
+	if rec.NumRows() != 2 || rec.Schema().Field(0).Name != "id" {
+		t.Errorf("arrow record = %v", rec)
+	}
+	if got := rec.Column(6).(*array.Struct).Field(0).(*array.String).Value(0); got != "Tokyo" {
+		t.Errorf("addr.city = %q", got)
+	}
+	if !rec.Column(4).IsNull(1) {
+		t.Errorf("at[1] is not null")
+	}
+}
+
+func TestExportLimits(t *testing.T) {
+	dir := t.TempDir()
+	mock := &bq.MockClient{QuerySchemaRes: exportSchema, QueryRes: exportRows}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p",
+		WithExport(ExportConfig{Dir: dir, MaxBytes: 1 << 20}))
+
+	_, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "big.csv", MaxBytes: 50})
+	if err == nil || !strings.Contains(err.Error(), "size limit of 50 bytes") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("failed export left %d files behind", len(entries))
+	}
+
+	for _, path := range []string{"../escape.csv", "/tmp/abs.csv", "a/../../b.csv"} {
+		if _, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: path}); err == nil {
+			t.Errorf("path %s accepted", path)
+		}
+	}
+
+	if _, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "once.csv"}); err != nil {
+		t.Fatalf("exportHandler error: %v", err)
+	}
+	if _, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "once.csv"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected existing file error, got %v", err)
+	}
+	if _, err := srv.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "once.csv", Overwrite: true}); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+
+	// A failed query leaves no temporary file behind.
+	failing := NewServer(func(ctx context.Context, project string) (bq.Client, error) {
+		return &bq.MockClient{Err: errors.New("boom")}, nil
+	}, "p", WithExport(ExportConfig{Dir: dir}))
+	if _, err := failing.exportHandler(context.Background(), mcp.CallToolRequest{}, exportArgs{SQL: "SELECT 1", Path: "failed.parquet"}); err == nil {
+		t.Fatal("expected query error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("export directory holds %d entries, want only once.csv", len(entries))
+	}
+}
+
+func TestCreateTempUnique(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	f1, tmp1, err := createTemp(root, "out.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	f2, tmp2, err := createTemp(root, "out.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if tmp1 == tmp2 || !strings.HasPrefix(tmp1, "out.csv.") {
+		t.Errorf("temporary files %q and %q", tmp1, tmp2)
+	}
+}
+
+func TestExportTarget(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, tc := range []struct {
+		path, format   string
+		wantFormat     string
+		wantPath       string
+		wantErrContain string
+	}{
+		{path: "a.parquet", wantFormat: exportParquet, wantPath: "a.parquet"},
+		{path: "a.feather", wantFormat: exportArrow, wantPath: "a.feather"},
+		{path: "a.txt", wantFormat: exportCSV, wantPath: "a.txt"},
+		{path: "a.csv", format: exportJSONL, wantFormat: exportJSONL, wantPath: "a.csv"},
+		{format: exportArrow, wantFormat: exportArrow, wantPath: "export-20240506T070809.000000000Z.arrow"},
+		{format: "xlsx", wantErrContain: "unknown export format"},
+		{path: "../a.csv", wantErrContain: "within the export directory"},
+	} {
+		format, path, err := exportTarget(tc.path, tc.format, now)
+		if tc.wantErrContain != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErrContain) {
+				t.Errorf("exportTarget(%q, %q) error = %v", tc.path, tc.format, err)
+			}
+			continue
+		}
+		if err != nil || format != tc.wantFormat || path != tc.wantPath {
+			t.Errorf("exportTarget(%q, %q) = %s, %s, %v", tc.path, tc.format, format, path, err)
+		}
+	}
+}
+
+func TestExportDisabledByDefault(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p")
+	if srv.MCPServer().GetTool("export") != nil {
+		t.Error("export tool registered without an export directory")
+	}
+}
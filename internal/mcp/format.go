@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Format selects how query results are encoded in tool responses.
+type Format string
+
+const (
+	// FormatJSON encodes rows as a JSON array of objects.
+	FormatJSON Format = "json"
+	// FormatJSONL encodes one JSON object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV encodes rows as CSV with a header line.
+	FormatCSV Format = "csv"
+	// FormatMarkdown encodes rows as a Markdown table.
+	FormatMarkdown Format = "markdown"
+	// FormatColumnar encodes rows as {columns, types, rows} with positional values.
+	FormatColumnar Format = "columnar"
+)
+
+var formats = []Format{FormatJSON, FormatJSONL, FormatCSV, FormatMarkdown, FormatColumnar}
+
+// ParseFormat validates a format name. An empty name selects FormatJSON.
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return FormatJSON, nil
+	}
+	for _, f := range formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+func formatNames() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+	return names
+}
+
+type column struct {
+	Name string
+	Type string
+}
+
+// resultColumns returns the columns of a result in schema order. When no
+// schema is available the sorted union of row keys is used instead.
+func resultColumns(schema bigquery.Schema, rows []map[string]bigquery.Value) []column {
+	if len(schema) > 0 {
+		cols := make([]column, len(schema))
+		for i, f := range schema {
+			typ := string(f.Type)
+			if f.Repeated {
+				typ = "ARRAY<" + typ + ">"
+			}
+			cols[i] = column{Name: f.Name, Type: typ}
+		}
+		return cols
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	cols := make([]column, len(names))
+	for i, n := range names {
+		cols[i] = column{Name: n}
+	}
+	return cols
+}
+
+type columnarResult struct {
+	Columns []string           `json:"columns"`
+	Types   []string           `json:"types"`
+	Rows    [][]bigquery.Value `json:"rows"`
+}
+
+// encodeRows renders rows in the requested format using the result schema
+// to determine column order.
+func encodeRows(format Format, schema bigquery.Schema, rows []map[string]bigquery.Value) (string, error) {
+	switch format {
+	case FormatJSON, "":
+		data, err := json.Marshal(rows)
+		return string(data), err
+	case FormatJSONL:
+		var buf bytes.Buffer
+		for _, row := range rows {
+			data, err := json.Marshal(row)
+			if err != nil {
+				return "", err
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		return buf.String(), nil
+	case FormatCSV:
+		cols := resultColumns(schema, rows)
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		record := make([]string, len(cols))
+		for i, c := range cols {
+			record[i] = c.Name
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+		for _, row := range rows {
+			for i, c := range cols {
+				record[i] = cellString(row[c.Name])
+			}
+			if err := w.Write(record); err != nil {
+				return "", err
+			}
+		}
+		w.Flush()
+		return buf.String(), w.Error()
+	case FormatMarkdown:
+		cols := resultColumns(schema, rows)
+		var b strings.Builder
+		b.WriteString("|")
+		for _, c := range cols {
+			b.WriteString(" " + markdownEscape(c.Name) + " |")
+		}
+		b.WriteString("\n|")
+		for range cols {
+			b.WriteString(" --- |")
+		}
+		b.WriteString("\n")
+		for _, row := range rows {
+			b.WriteString("|")
+			for _, c := range cols {
+				b.WriteString(" " + markdownEscape(cellString(row[c.Name])) + " |")
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+	case FormatColumnar:
+		cols := resultColumns(schema, rows)
+		out := columnarResult{
+			Columns: make([]string, len(cols)),
+			Types:   make([]string, len(cols)),
+			Rows:    make([][]bigquery.Value, len(rows)),
+		}
+		for i, c := range cols {
+			out.Columns[i] = c.Name
+			out.Types[i] = c.Type
+		}
+		for i, row := range rows {
+			vals := make([]bigquery.Value, len(cols))
+			for j, c := range cols {
+				vals[j] = row[c.Name]
+			}
+			out.Rows[i] = vals
+		}
+		data, err := json.Marshal(out)
+		return string(data), err
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// cellString renders a single value for the text based formats. Nested
+// values are rendered as JSON.
+func cellString(v bigquery.Value) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case *big.Rat:
+		if x.IsInt() {
+			return x.Num().String()
+		}
+		return strings.TrimRight(x.FloatString(38), "0")
+	case fmt.Stringer:
+		return x.String()
+	case []bigquery.Value, map[string]bigquery.Value:
+		data, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Sprint(x)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+var formatTestSchema = bigquery.Schema{
+	{Name: "name", Type: bigquery.StringFieldType},
+	{Name: "id", Type: bigquery.IntegerFieldType},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+}
+
+var formatTestRows = []map[string]bigquery.Value{
+	{"id": int64(1), "name": "a|b", "tags": []bigquery.Value{"x", "y"}},
+	{"id": int64(2), "name": "c,d", "tags": nil},
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatJSON {
+		t.Fatalf("expected json default, got %q %v", f, err)
+	}
+	if f, err := ParseFormat("csv"); err != nil || f != FormatCSV {
+		t.Fatalf("expected csv, got %q %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestEncodeRowsJSONL(t *testing.T) {
+	out, err := encodeRows(FormatJSONL, formatTestSchema, formatTestRows)
+	if err != nil {
+		t.Fatalf("encodeRows error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), out)
+	}
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatalf("invalid json line: %v", err)
+	}
+	if row["name"] != "a|b" {
+		t.Fatalf("unexpected row: %#v", row)
+	}
+}
+
+func TestEncodeRowsCSV(t *testing.T) {
+	out, err := encodeRows(FormatCSV, formatTestSchema, formatTestRows)
+	if err != nil {
+		t.Fatalf("encodeRows error: %v", err)
+	}
+	want := "name,id,tags\na|b,1,\"[\"\"x\"\",\"\"y\"\"]\"\n\"c,d\",2,\n"
+	if out != want {
+		t.Fatalf("unexpected csv:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestEncodeRowsMarkdown(t *testing.T) {
+	out, err := encodeRows(FormatMarkdown, formatTestSchema, formatTestRows)
+	if err != nil {
+		t.Fatalf("encodeRows error: %v", err)
+	}
+	want := "| name | id | tags |\n| --- | --- | --- |\n| a\\|b | 1 | [\"x\",\"y\"] |\n| c,d | 2 |  |\n"
+	if out != want {
+		t.Fatalf("unexpected markdown:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestEncodeRowsColumnar(t *testing.T) {
+	out, err := encodeRows(FormatColumnar, formatTestSchema, formatTestRows)
+	if err != nil {
+		t.Fatalf("encodeRows error: %v", err)
+	}
+	var res columnarResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if strings.Join(res.Columns, ",") != "name,id,tags" {
+		t.Fatalf("unexpected columns: %v", res.Columns)
+	}
+	if strings.Join(res.Types, ",") != "STRING,INTEGER,ARRAY<STRING>" {
+		t.Fatalf("unexpected types: %v", res.Types)
+	}
+	if len(res.Rows) != 2 || res.Rows[1][0] != "c,d" {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	}
+}
+
+func TestEncodeRowsWithoutSchema(t *testing.T) {
+	rows := []map[string]bigquery.Value{{"b": "2", "a": "1"}}
+	out, err := encodeRows(FormatCSV, nil, rows)
+	if err != nil {
+		t.Fatalf("encodeRows error: %v", err)
+	}
+	if out != "a,b\n1,2\n" {
+		t.Fatalf("unexpected csv: %q", out)
+	}
+}
+
+func TestCellStringNumeric(t *testing.T) {
+	if got := cellString(big.NewRat(5, 4)); got != "1.25" {
+		t.Fatalf("unexpected numeric: %q", got)
+	}
+	if got := cellString(big.NewRat(10, 1)); got != "10" {
+		t.Fatalf("unexpected integer numeric: %q", got)
+	}
+}
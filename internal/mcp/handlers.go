@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -22,6 +23,27 @@ type Server struct {
 	bqClientProvider func(ctx context.Context, project string) (bigquery.Client, error)
 	clientProject    string
 	tableFilter      *regexp.Regexp
+	defaultFormat    Format
+	resultBytes      int
+	datasets         []string
+	pollInterval     time.Duration
+	subscriptions    subscriptionRegistry
+	promptsDir       string
+	completionTTL    time.Duration
+	completions      completionCache
+	lint             LintConfig
+	queryLog         bool
+	queryLogFormat   bool
+	sessions         sessionStore
+	bqSessions       bool
+	labels           LabelConfig
+	export           ExportConfig
+	writes           bool
+	scratch          ScratchConfig
+	scratchTables    scratchRegistry
+	load             LoadConfig
+	redaction        RedactionConfig
+	redactionKey     []byte
 }
 
 type Option func(*Server)
@@ -32,6 +54,38 @@ func WithTableFilter(re *regexp.Regexp) Option {
 	}
 }
 
+// WithDefaultFormat sets the result format used when a query does not
+// request one explicitly.
+func WithDefaultFormat(f Format) Option {
+	return func(s *Server) {
+		s.defaultFormat = f
+	}
+}
+
+// WithResultBudget sets the approximate maximum size in bytes of the rows
+// returned by a query. Zero disables the size limit.
+func WithResultBudget(maxBytes int) Option {
+	return func(s *Server) {
+		s.resultBytes = maxBytes
+	}
+}
+
+// WithDatasets restricts the datasets published as resources. Entries are
+// either "dataset" in the client project or "project.dataset".
+func WithDatasets(datasets []string) Option {
+	return func(s *Server) {
+		s.datasets = datasets
+	}
+}
+
+// WithPollInterval sets how often the resource list is refreshed and
+// subscribed table schemas are checked for changes. Zero disables polling.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = d
+	}
+}
+
 // MCPServer exposes the underlying MCP server.
 func (s *Server) MCPServer() *server.MCPServer {
 	return s.mcpServer
@@ -41,10 +95,23 @@ type schemaArgs struct {
 	DatasetProject string `json:"dataset_project,omitempty"`
 	Dataset        string `json:"dataset"`
 	Table          string `json:"table"`
+	Refresh        bool   `json:"refresh,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+}
+
+// resultArgs controls how query results are paged, truncated and encoded.
+type resultArgs struct {
+	Format    string `json:"format,omitempty"`
+	StartRow  int    `json:"start_row,omitempty"`
+	MaxRows   int    `json:"max_rows,omitempty"`
+	MaxBytes  int    `json:"max_bytes,omitempty"`
+	MaxTokens int    `json:"max_tokens,omitempty"`
 }
 
 type queryArgs struct {
-	SQL string `json:"sql"`
+	SQL     string `json:"sql"`
+	NoCache bool   `json:"no_cache,omitempty"`
+	resultArgs
 }
 
 type dryRunArgs struct {
@@ -52,7 +119,9 @@ type dryRunArgs struct {
 }
 
 type queryFileArgs struct {
-	Path string `json:"path"`
+	Path    string `json:"path"`
+	NoCache bool   `json:"no_cache,omitempty"`
+	resultArgs
 }
 
 type dryRunFileArgs struct {
@@ -62,137 +131,384 @@ type dryRunFileArgs struct {
 type tablesArgs struct {
 	DatasetProject string `json:"dataset_project,omitempty"`
 	Dataset        string `json:"dataset"`
+	Refresh        bool   `json:"refresh,omitempty"`
 }
 
 func NewServer(provider func(ctx context.Context, project string) (bigquery.Client, error), clientProject string, opts ...Option) *Server {
+	s := &Server{bqClientProvider: provider, clientProject: clientProject, defaultFormat: FormatJSON, resultBytes: defaultResultBytes, pollInterval: defaultPollInterval, completionTTL: defaultCompletionTTL}
+	for _, opt := range opts {
+		opt(s)
+	}
+	hooks := &server.Hooks{}
 	mcpSrv := server.NewMCPServer(
 		"bigquery-mcp-server",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(true, true),
+		server.WithPromptCapabilities(false),
+		server.WithCompletions(),
+		server.WithPromptCompletionProvider(&completer{s: s}),
+		server.WithResourceCompletionProvider(&completer{s: s}),
+		server.WithHooks(hooks),
 	)
-	s := &Server{mcpServer: mcpSrv, bqClientProvider: provider, clientProject: clientProject}
-	for _, opt := range opts {
-		opt(s)
-	}
+	s.mcpServer = mcpSrv
+	s.registerResources(hooks)
+	s.registerPrompts()
+	s.registerSessions(hooks)
+	s.registerExport()
+	s.registerLoad()
+	s.registerScratch(hooks)
 
 	mcpSrv.AddTool(mcp.NewTool(
 		"schema",
 		mcp.WithDescription("Get BigQuery table schema"),
 		mcp.WithString("dataset_project"),
-		mcp.WithString("dataset", mcp.Required()),
+		mcp.WithString("dataset", mcp.Description("Dataset; defaults to the session dataset set with set_context")),
 		mcp.WithString("table", mcp.Required()),
+		mcp.WithBoolean("refresh", mcp.Description("Bypass the metadata cache")),
+		mcp.WithString("mode", mcp.Enum(schemaModeNested, schemaModeFlatten, schemaModeDDL),
+			mcp.Description("nested: BigQuery field schemas (default); flatten: one entry per dotted field path; ddl: a CREATE TABLE statement")),
+		mcp.WithRawOutputSchema(schemaOutputSchema),
 	), mcp.NewTypedToolHandler(s.schemaHandler))
 
 	mcpSrv.AddTool(mcp.NewTool(
 		"query",
-		mcp.WithDescription("Execute BigQuery SQL (returns up to 100 rows)"),
-		mcp.WithString("sql", mcp.Required()),
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Execute BigQuery SQL (returns up to 100 rows by default, within a response-size budget)"),
+			mcp.WithString("sql", mcp.Required()),
+			mcp.WithBoolean("no_cache", mcp.Description("Execute the query even if a cached result is available")),
+			mcp.WithRawOutputSchema(queryOutputSchema),
+		}, resultToolOptions()...)...,
 	), mcp.NewTypedToolHandler(s.queryHandler))
 
 	mcpSrv.AddTool(mcp.NewTool(
 		"queryfile",
-		mcp.WithDescription("Execute BigQuery SQL from file (returns up to 100 rows)"),
-		mcp.WithString("path", mcp.Required()),
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Execute BigQuery SQL from file (returns up to 100 rows by default, within a response-size budget)"),
+			mcp.WithString("path", mcp.Required()),
+			mcp.WithBoolean("no_cache", mcp.Description("Execute the query even if a cached result is available")),
+			mcp.WithRawOutputSchema(queryOutputSchema),
+		}, resultToolOptions()...)...,
 	), mcp.NewTypedToolHandler(s.queryFileHandler))
 
+	mcpSrv.AddTool(mcp.NewTool(
+		"preview",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Preview table rows without running a query (free; returns up to 100 rows by default, within a response-size budget)"),
+			mcp.WithString("dataset_project"),
+			mcp.WithString("dataset", mcp.Description("Dataset; defaults to the session dataset set with set_context")),
+			mcp.WithString("table", mcp.Required()),
+			mcp.WithArray("fields", mcp.WithStringItems(), mcp.Description("Top-level columns to return; defaults to all columns")),
+			mcp.WithString("partition", mcp.Description("Partition to read, e.g. 20240101 for a daily partitioned table")),
+			mcp.WithRawOutputSchema(queryOutputSchema),
+		}, resultToolOptions()...)...,
+	), mcp.NewTypedToolHandler(s.previewHandler))
+
+	mcpSrv.AddTool(mcp.NewTool(
+		"profile",
+		mcp.WithDescription("Profile table columns: null counts, approximate distinct counts, min/max, top values and string lengths, computed by one dry-run-checked query"),
+		mcp.WithString("dataset_project"),
+		mcp.WithString("dataset", mcp.Description("Dataset; defaults to the session dataset set with set_context")),
+		mcp.WithString("table", mcp.Required()),
+		mcp.WithArray("columns", mcp.WithStringItems(), mcp.Description("Top-level columns to profile; defaults to all columns")),
+		mcp.WithString("filter", mcp.Description("SQL condition restricting the profiled rows, e.g. a partition filter; a single expression without ';' or comments")),
+		mcp.WithNumber("sample_percent", mcp.Description("Profile a TABLESAMPLE of this percentage of the table")),
+		mcp.WithNumber("top_k", mcp.Description("Number of most frequent values per column (default 5)")),
+		mcp.WithRawOutputSchema(profileOutputSchema),
+	), mcp.NewTypedToolHandler(s.profileHandler))
+
+	mcpSrv.AddTool(mcp.NewTool(
+		"search_columns",
+		mcp.WithDescription("Find columns and nested fields by name pattern, type or description across datasets (returns up to 100 matches)"),
+		mcp.WithString("dataset_project"),
+		mcp.WithArray("datasets", mcp.WithStringItems(), mcp.Description("Datasets to search (\"dataset\" or \"project.dataset\"); defaults to the configured or all datasets")),
+		mcp.WithString("region", mcp.Description("Search all datasets of the project in this region, e.g. us or eu, with a single query")),
+		mcp.WithString("name_pattern", mcp.Description("Case-insensitive regular expression matched against the field path, e.g. customer_id")),
+		mcp.WithString("type", mcp.Description("Type prefix, e.g. STRING, INT64 or ARRAY")),
+		mcp.WithString("description", mcp.Description("Case-insensitive substring of the column description")),
+		mcp.WithString("source", mcp.Enum(searchSourceInformationSchema, searchSourceSchemas), mcp.Description("Query INFORMATION_SCHEMA (default) or walk cached table schemas")),
+		mcp.WithRawOutputSchema(searchColumnsOutputSchema),
+	), mcp.NewTypedToolHandler(s.searchColumnsHandler))
+
+	mcpSrv.AddTool(mcp.NewTool(
+		"explain",
+		mcp.WithDescription("Summarize the query plan of a job: stages, shuffle, slot time, skew and spills, with heuristic findings"),
+		mcp.WithString("job_id", mcp.Description("Job to explain, e.g. the job_id from query metadata or project:location.job_id")),
+		mcp.WithString("location", mcp.Description("Location of the job, when job_id is not fully qualified")),
+		mcp.WithString("sql", mcp.Description("Run this SQL and explain its job")),
+		mcp.WithString("statistics_file", mcp.Description("Explain a recorded job (bq show --format=json -j JOB_ID) offline")),
+		mcp.WithRawOutputSchema(explainOutputSchema),
+	), mcp.NewTypedToolHandler(s.explainHandler))
+
 	mcpSrv.AddTool(mcp.NewTool(
 		"dryrun",
 		mcp.WithDescription("Dry run BigQuery SQL"),
 		mcp.WithString("sql", mcp.Required()),
+		mcp.WithRawOutputSchema(dryRunOutputSchema),
 	), mcp.NewTypedToolHandler(s.dryRunHandler))
 
 	mcpSrv.AddTool(mcp.NewTool(
 		"dryrunfile",
 		mcp.WithDescription("Dry run BigQuery SQL from file"),
 		mcp.WithString("path", mcp.Required()),
+		mcp.WithRawOutputSchema(dryRunOutputSchema),
 	), mcp.NewTypedToolHandler(s.dryRunFileHandler))
 
+	mcpSrv.AddTool(mcp.NewTool(
+		"format_sql",
+		mcp.WithDescription("Format GoogleSQL for review: one clause per line, nested subqueries and script blocks indented, keywords upper-cased, comments kept"),
+		mcp.WithString("sql", mcp.Required()),
+		mcp.WithRawOutputSchema(formatSQLOutputSchema),
+	), mcp.NewTypedToolHandler(s.formatSQLHandler))
+
 	mcpSrv.AddTool(mcp.NewTool(
 		"tables",
 		mcp.WithDescription("List BigQuery tables in a dataset (returns up to 100 entries)"),
 		mcp.WithString("dataset_project"),
-		mcp.WithString("dataset", mcp.Required()),
+		mcp.WithString("dataset", mcp.Description("Dataset; defaults to the session dataset set with set_context")),
+		mcp.WithBoolean("refresh", mcp.Description("Bypass the metadata cache")),
+		mcp.WithRawOutputSchema(tablesOutputSchema),
 	), mcp.NewTypedToolHandler(s.tablesHandler))
 
-	s.httpServer = server.NewStreamableHTTPServer(mcpSrv)
+	s.httpServer = server.NewStreamableHTTPServer(mcpSrv, server.WithHTTPContextFunc(s.httpContext))
 	return s
 }
 
+// resultToolOptions declares the arguments shared by tools returning rows.
+func resultToolOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("format", mcp.Enum(formatNames()...), mcp.Description("Result format; defaults to the server setting")),
+		mcp.WithNumber("start_row", mcp.Description("Index of the first row to return, used to fetch further pages")),
+		mcp.WithNumber("max_rows", mcp.Description("Maximum number of rows to return (default 100)")),
+		mcp.WithNumber("max_bytes", mcp.Description("Approximate response-size budget in bytes")),
+		mcp.WithNumber("max_tokens", mcp.Description("Approximate response-size budget in tokens")),
+	}
+}
+
+// budget returns the effective response-size budget in bytes for args.
+// Arguments may only tighten the server-wide budget.
+func (s *Server) budget(args resultArgs) int {
+	b := s.resultBytes
+	for _, v := range []int{args.MaxBytes, args.MaxTokens * bytesPerToken} {
+		if v > 0 && (b <= 0 || v < b) {
+			b = v
+		}
+	}
+	return b
+}
+
+// page returns the output format, first row and row limit requested by the
+// result arguments of a tool call. The row limit defaults to defaultRowLimit
+// and is capped at maxRowLimit.
+func (s *Server) page(args resultArgs) (format Format, start, maxRows int, err error) {
+	format = s.defaultFormat
+	if args.Format != "" {
+		if format, err = ParseFormat(args.Format); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	maxRows = args.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultRowLimit
+	}
+	return format, max(args.StartRow, 0), min(maxRows, maxRowLimit), nil
+}
+
+// toolName returns the name of the tool called by req, or def for calls made
+// without a request.
+func toolName(req mcp.CallToolRequest, def string) string {
+	if req.Params.Name != "" {
+		return req.Params.Name
+	}
+	return def
+}
+
+// maxQueryBytes returns the scan limit set by MAX_BQ_QUERY_BYTES, or zero
+// when no limit is configured.
+func maxQueryBytes() int64 {
+	maxBytes, err := strconv.ParseInt(os.Getenv("MAX_BQ_QUERY_BYTES"), 10, 64)
+	if err != nil || maxBytes < 0 {
+		return 0
+	}
+	return maxBytes
+}
+
 func (s *Server) Start(addr string) error {
 	return s.httpServer.Start(addr)
 }
 
+// Shutdown stops the HTTP server, then drops the scratch tables of all
+// sessions.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	for _, id := range s.scratchTables.sessions() {
+		s.dropScratchTables(ctx, s.scratchTables.take(id))
+	}
+	return err
+}
+
 func (s *Server) schemaHandler(ctx context.Context, _ mcp.CallToolRequest, args schemaArgs) (*mcp.CallToolResult, error) {
 	c, err := s.bqClientProvider(ctx, s.clientProject)
 	if err != nil {
 		return nil, err
 	}
-	dp := args.DatasetProject
-	if dp == "" {
-		dp = s.clientProject
+	dp, dataset, err := s.resolveDataset(ctx, args.DatasetProject, args.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	if args.Refresh {
+		ctx = bigquery.WithRefresh(ctx)
 	}
-	schema, err := c.GetTableSchema(ctx, dp, args.Dataset, args.Table)
+	switch args.Mode {
+	case "", schemaModeNested, schemaModeFlatten:
+	case schemaModeDDL:
+		meta, err := c.GetTableMetadata(ctx, dp, dataset, args.Table)
+		if err != nil {
+			return nil, err
+		}
+		ddl := tableDDL(dp+"."+dataset+"."+args.Table, meta)
+		return mcp.NewToolResultStructured(ddlOutput{DDL: ddl}, ddl), nil
+	default:
+		return nil, fmt.Errorf("unknown schema mode %q", args.Mode)
+	}
+	schema, err := c.GetTableSchema(ctx, dp, dataset, args.Table)
 	if err != nil {
 		return nil, err
 	}
+	if args.Mode == schemaModeFlatten {
+		out := flatSchemaOutput{Columns: flattenSchema(schema)}
+		data, _ := json.Marshal(out.Columns)
+		return mcp.NewToolResultStructured(out, string(data)), nil
+	}
 	data, _ := json.Marshal(schema)
-	return mcp.NewToolResultText(string(data)), nil
+	return mcp.NewToolResultStructured(newSchemaOutput(schema), string(data)), nil
 }
 
-func (s *Server) queryHandler(ctx context.Context, _ mcp.CallToolRequest, args queryArgs) (*mcp.CallToolResult, error) {
+func (s *Server) queryHandler(ctx context.Context, req mcp.CallToolRequest, args queryArgs) (*mcp.CallToolResult, error) {
+	tool := toolName(req, "query")
+	format, start, maxRows, err := s.page(args.resultArgs)
+	if err != nil {
+		return nil, err
+	}
 	c, err := s.bqClientProvider(ctx, s.clientProject)
 	if err != nil {
 		return nil, err
 	}
-	if maxStr := os.Getenv("MAX_BQ_QUERY_BYTES"); maxStr != "" {
-		if maxBytes, err := strconv.ParseInt(maxStr, 10, 64); err == nil && maxBytes > 0 {
-			stats, err := c.DryRunQuery(ctx, args.SQL)
-			if err != nil {
-				return nil, err
-			}
-			if stats.TotalBytesProcessed > maxBytes {
-				return nil, fmt.Errorf("query would scan %d bytes (limit %d)", stats.TotalBytesProcessed, maxBytes)
+	s.logQuery(tool, args.SQL)
+	var warnings []finding
+	if s.lint.Enabled {
+		if warnings, err = s.lintSQL(ctx, c, args.SQL); err != nil {
+			return nil, err
+		}
+	}
+	ctx = s.queryContext(ctx, tool)
+	var tagged map[string]bool
+	if maxBytes := maxQueryBytes(); maxBytes > 0 || len(s.redaction.PolicyTags) > 0 {
+		stats, err := c.DryRunQuery(ctx, args.SQL)
+		if err != nil {
+			return nil, err
+		}
+		if maxBytes > 0 && stats.TotalBytesProcessed > maxBytes {
+			return nil, fmt.Errorf("query would scan %d bytes (limit %d)", stats.TotalBytesProcessed, maxBytes)
+		}
+		tagged, err = s.policyTaggedColumns(ctx, c, stats.ReferencedTables)
+		if err != nil {
+			return nil, err
+		}
+		ctx = bigquery.WithDryRunStats(ctx, stats)
+	}
+	if args.NoCache {
+		ctx = bigquery.WithoutResultCache(ctx)
+	}
+	cfg := bigquery.QueryConfigFrom(ctx)
+	// Calls outside of an MCP session have nothing to keep a BigQuery
+	// session for, nor an end at which to abort it.
+	if s.bqSessions && cfg.SessionID == "" && sessionID(ctx) != "" {
+		cfg.CreateSession = true
+		ctx = bigquery.WithQueryConfig(ctx, cfg)
+	}
+	res, err := c.RunQuery(ctx, args.SQL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CreateSession && res.SessionID != "" {
+		kept, live := s.sessions.update(sessionID(ctx), func(c *sessionContext) {
+			// Keep a session recorded by a concurrent query.
+			if c.BigQuerySession == "" {
+				c.BigQuerySession, c.sessionLocation = res.SessionID, res.Location
 			}
+		})
+		// Abort the session when another query won the race, or when the
+		// MCP session ended while the query ran and nothing would abort it
+		// later.
+		if !live || kept.BigQuerySession != res.SessionID {
+			go s.abortSession(sessionContext{BigQuerySession: res.SessionID, sessionLocation: res.Location})
 		}
 	}
-	rows, err := c.RunQuery(ctx, args.SQL)
+	start = min(start, len(res.Rows))
+	// Redact the requested page before truncation, which could cut values
+	// short of matching a value detector.
+	red := s.newRedactor(tagged)
+	schema, page := red.result(res.Schema, res.Rows[start:min(start+maxRows, len(res.Rows))])
+	statements := make([]*bigquery.StatementResult, len(res.Statements))
+	for i, st := range res.Statements {
+		redacted := *st
+		redacted.TotalRows = max(st.TotalRows, uint64(len(st.Rows)))
+		redacted.Schema, redacted.Rows = red.result(st.Schema, st.Rows[:min(maxRows, len(st.Rows))])
+		statements[i] = &redacted
+	}
+	rows, meta := truncateRows(page, 0, maxRows, s.budget(args.resultArgs))
+	meta = pageMetadata(meta, start, len(res.Rows))
+	meta.CacheHit = res.CacheHit
+	meta.JobID = res.JobID
+	meta.SessionID = res.SessionID
+	meta.Warnings = warnings
+	meta.RedactedColumns = red.columnsRedacted()
+	text, err := encodeRows(format, schema, rows)
 	if err != nil {
 		return nil, err
 	}
-	if len(rows) > defaultRowLimit {
-		rows = rows[:defaultRowLimit]
+	metaData, _ := json.Marshal(meta)
+	out := newQueryOutput(schema, rows, meta)
+	out.Statements = newStatementOutputs(statements, maxRows, s.budget(args.resultArgs))
+	result := mcp.NewToolResultStructured(out, text)
+	result.Content = append(result.Content, mcp.NewTextContent(string(metaData)))
+	if len(out.Statements) > 0 {
+		data, _ := json.Marshal(out.Statements)
+		result.Content = append(result.Content, mcp.NewTextContent(string(data)))
 	}
-	data, _ := json.Marshal(rows)
-	return mcp.NewToolResultText(string(data)), nil
+	return result, nil
 }
 
-func (s *Server) queryFileHandler(ctx context.Context, _ mcp.CallToolRequest, args queryFileArgs) (*mcp.CallToolResult, error) {
+func (s *Server) queryFileHandler(ctx context.Context, req mcp.CallToolRequest, args queryFileArgs) (*mcp.CallToolResult, error) {
 	b, err := os.ReadFile(args.Path)
 	if err != nil {
 		return nil, err
 	}
-	return s.queryHandler(ctx, mcp.CallToolRequest{}, queryArgs{SQL: string(b)})
+	return s.queryHandler(ctx, req, queryArgs{SQL: string(b), NoCache: args.NoCache, resultArgs: args.resultArgs})
 }
 
-func (s *Server) dryRunHandler(ctx context.Context, _ mcp.CallToolRequest, args dryRunArgs) (*mcp.CallToolResult, error) {
+func (s *Server) dryRunHandler(ctx context.Context, req mcp.CallToolRequest, args dryRunArgs) (*mcp.CallToolResult, error) {
+	tool := toolName(req, "dryrun")
 	c, err := s.bqClientProvider(ctx, s.clientProject)
 	if err != nil {
 		return nil, err
 	}
-	stats, err := c.DryRunQuery(ctx, args.SQL)
+	s.logQuery(tool, args.SQL)
+	stats, err := c.DryRunQuery(s.queryContext(ctx, tool), args.SQL)
 	if err != nil {
 		return nil, err
 	}
 	data, _ := json.Marshal(stats)
-	return mcp.NewToolResultText(string(data)), nil
+	return mcp.NewToolResultStructured(stats, string(data)), nil
 }
 
-func (s *Server) dryRunFileHandler(ctx context.Context, _ mcp.CallToolRequest, args dryRunFileArgs) (*mcp.CallToolResult, error) {
+func (s *Server) dryRunFileHandler(ctx context.Context, req mcp.CallToolRequest, args dryRunFileArgs) (*mcp.CallToolResult, error) {
 	b, err := os.ReadFile(args.Path)
 	if err != nil {
 		return nil, err
 	}
-	return s.dryRunHandler(ctx, mcp.CallToolRequest{}, dryRunArgs{SQL: string(b)})
+	return s.dryRunHandler(ctx, req, dryRunArgs{SQL: string(b)})
 }
 
 func (s *Server) tablesHandler(ctx context.Context, _ mcp.CallToolRequest, args tablesArgs) (*mcp.CallToolResult, error) {
@@ -200,16 +516,20 @@ func (s *Server) tablesHandler(ctx context.Context, _ mcp.CallToolRequest, args
 	if err != nil {
 		return nil, err
 	}
-	dp := args.DatasetProject
-	if dp == "" {
-		dp = s.clientProject
+	dp, dataset, err := s.resolveDataset(ctx, args.DatasetProject, args.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	if args.Refresh {
+		ctx = bigquery.WithRefresh(ctx)
 	}
-	tables, err := c.ListTables(ctx, dp, args.Dataset)
+	tables, err := c.ListTables(ctx, dp, dataset)
 	if err != nil {
 		return nil, err
 	}
 	if s.tableFilter != nil {
-		filtered := tables[:0]
+		// Allocate a new slice: the listing may be shared with a cache.
+		filtered := make([]string, 0, len(tables))
 		for _, t := range tables {
 			if s.tableFilter.MatchString(t) {
 				filtered = append(filtered, t)
@@ -221,5 +541,5 @@ func (s *Server) tablesHandler(ctx context.Context, _ mcp.CallToolRequest, args
 		tables = tables[:defaultRowLimit]
 	}
 	data, _ := json.Marshal(tables)
-	return mcp.NewToolResultText(string(data)), nil
+	return mcp.NewToolResultStructured(newTablesOutput(tables), string(data)), nil
 }
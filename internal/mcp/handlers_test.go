@@ -6,12 +6,15 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/mark3labs/mcp-go/mcp"
 
 	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery/fake"
 )
 
 func TestSchemaHandler(t *testing.T) {
@@ -231,3 +234,223 @@ func TestTablesHandlerRegexFilter(t *testing.T) {
 		t.Fatalf("unexpected tables: %#v", tables)
 	}
 }
+
+func TestQueryHandlerFormat(t *testing.T) {
+	mock := &bq.MockClient{
+		QueryRes:       []map[string]bigquery.Value{{"id": "1", "name": "a"}},
+		QuerySchemaRes: bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}, {Name: "id", Type: bigquery.StringFieldType}},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithDefaultFormat(FormatMarkdown))
+
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1", resultArgs: resultArgs{Format: "csv"}})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	tc, _ := mcp.AsTextContent(res.Content[0])
+	if tc.Text != "name,id\na,1\n" {
+		t.Fatalf("unexpected csv: %q", tc.Text)
+	}
+
+	res, err = srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1"})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	tc, _ = mcp.AsTextContent(res.Content[0])
+	if !strings.HasPrefix(tc.Text, "| name | id |") {
+		t.Fatalf("expected markdown default, got %q", tc.Text)
+	}
+
+	if _, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1", resultArgs: resultArgs{Format: "xml"}}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestQueryHandlerMetadata(t *testing.T) {
+	var manyRows []map[string]bigquery.Value
+	for i := 0; i < 150; i++ {
+		manyRows = append(manyRows, map[string]bigquery.Value{"id": strconv.Itoa(i)})
+	}
+	mock := &bq.MockClient{QueryRes: manyRows}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT *", resultArgs: resultArgs{StartRow: 100, MaxRows: 20}})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	if len(res.Content) != 2 {
+		t.Fatalf("expected rows and metadata content, got %d", len(res.Content))
+	}
+	tc, _ := mcp.AsTextContent(res.Content[0])
+	var rows []map[string]bigquery.Value
+	if err := json.Unmarshal([]byte(tc.Text), &rows); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(rows) != 20 || rows[0]["id"] != "100" {
+		t.Fatalf("unexpected rows: %d %#v", len(rows), rows[0])
+	}
+	mc, _ := mcp.AsTextContent(res.Content[1])
+	var meta resultMetadata
+	if err := json.Unmarshal([]byte(mc.Text), &meta); err != nil {
+		t.Fatalf("invalid metadata json: %v", err)
+	}
+	if meta.TotalRows != 150 || meta.RowsReturned != 20 || meta.NextStartRow != 120 || !meta.Truncated {
+		t.Fatalf("unexpected metadata: %#v", meta)
+	}
+}
+
+func TestQueryHandlerTokenBudget(t *testing.T) {
+	var manyRows []map[string]bigquery.Value
+	for i := 0; i < 50; i++ {
+		manyRows = append(manyRows, map[string]bigquery.Value{"id": strconv.Itoa(i)})
+	}
+	mock := &bq.MockClient{QueryRes: manyRows}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT *", resultArgs: resultArgs{MaxTokens: 10}})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	tc, _ := mcp.AsTextContent(res.Content[0])
+	var rows []map[string]bigquery.Value
+	if err := json.Unmarshal([]byte(tc.Text), &rows); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows within 40 bytes, got %d", len(rows))
+	}
+}
+
+func TestStructuredContent(t *testing.T) {
+	mock := &bq.MockClient{
+		SchemaRes:      []*bigquery.FieldSchema{{Name: "id", Type: bigquery.StringFieldType}},
+		QueryRes:       []map[string]bigquery.Value{{"id": "1"}},
+		QuerySchemaRes: bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}},
+		TablesRes:      []string{"t1"},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	for _, name := range []string{"schema", "query", "queryfile", "dryrun", "dryrunfile", "tables"} {
+		if tool := srv.MCPServer().GetTool(name); tool == nil || tool.Tool.RawOutputSchema == nil {
+			t.Fatalf("tool %s has no output schema", name)
+		}
+	}
+
+	res, err := srv.schemaHandler(context.Background(), mcp.CallToolRequest{}, schemaArgs{Dataset: "d", Table: "t"})
+	if err != nil {
+		t.Fatalf("schemaHandler error: %v", err)
+	}
+	if so, ok := res.StructuredContent.(schemaOutput); !ok || len(so.Fields) != 1 {
+		t.Fatalf("unexpected schema structured content: %#v", res.StructuredContent)
+	}
+
+	res, err = srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1", resultArgs: resultArgs{Format: "csv"}})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	qo, ok := res.StructuredContent.(queryOutput)
+	if !ok || len(qo.Rows) != 1 || qo.Rows[0]["id"] != "1" || qo.Metadata.RowsReturned != 1 {
+		t.Fatalf("unexpected query structured content: %#v", res.StructuredContent)
+	}
+	if props, ok := qo.RowSchema["properties"].(map[string]any); !ok || props["id"] == nil {
+		t.Fatalf("unexpected row schema: %#v", qo.RowSchema)
+	}
+
+	res, err = srv.tablesHandler(context.Background(), mcp.CallToolRequest{}, tablesArgs{Dataset: "d"})
+	if err != nil {
+		t.Fatalf("tablesHandler error: %v", err)
+	}
+	if to, ok := res.StructuredContent.(tablesOutput); !ok || len(to.Tables) != 1 {
+		t.Fatalf("unexpected tables structured content: %#v", res.StructuredContent)
+	}
+}
+
+func TestTablesHandlerRefresh(t *testing.T) {
+	mock := &bq.MockClient{TablesRes: []string{"users", "orders"}}
+	cache, err := bq.NewMetadataCache(bq.CacheOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewMetadataCache: %v", err)
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return cache.Wrap(mock), nil }, "p", WithTableFilter(regexp.MustCompile("^u")))
+
+	call := func(refresh bool) []string {
+		res, err := srv.tablesHandler(context.Background(), mcp.CallToolRequest{}, tablesArgs{Dataset: "d", Refresh: refresh})
+		if err != nil {
+			t.Fatalf("tablesHandler error: %v", err)
+		}
+		tc, _ := mcp.AsTextContent(res.Content[0])
+		var tables []string
+		if err := json.Unmarshal([]byte(tc.Text), &tables); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		return tables
+	}
+	if tables := call(false); len(tables) != 1 {
+		t.Fatalf("unexpected tables: %v", tables)
+	}
+	mock.TablesRes = []string{"users", "orders", "user_events"}
+	if tables := call(false); len(tables) != 1 || tables[0] != "users" {
+		t.Fatalf("expected cached tables, got %v", tables)
+	}
+	if tables := call(true); len(tables) != 2 {
+		t.Fatalf("expected refreshed tables, got %v", tables)
+	}
+}
+
+func TestQueryHandlerCacheHit(t *testing.T) {
+	mock := &bq.MockClient{
+		QueryRes:  []map[string]bigquery.Value{{"id": "1"}},
+		DryRunRes: &bigquery.QueryStatistics{StatementType: "SELECT"},
+	}
+	cache := bq.NewResultCache(bq.ResultCacheOptions{TTL: time.Minute})
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return cache.Wrap(mock), nil }, "p")
+
+	metaOf := func(args queryArgs) resultMetadata {
+		t.Helper()
+		res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, args)
+		if err != nil {
+			t.Fatalf("queryHandler error: %v", err)
+		}
+		mc, _ := mcp.AsTextContent(res.Content[1])
+		var meta resultMetadata
+		if err := json.Unmarshal([]byte(mc.Text), &meta); err != nil {
+			t.Fatalf("invalid metadata json: %v", err)
+		}
+		return meta
+	}
+	if metaOf(queryArgs{SQL: "SELECT 1"}).CacheHit {
+		t.Fatal("first query should not be a cache hit")
+	}
+	if !metaOf(queryArgs{SQL: "SELECT 1"}).CacheHit {
+		t.Fatal("expected cache hit")
+	}
+	if metaOf(queryArgs{SQL: "SELECT 1", NoCache: true}).CacheHit {
+		t.Fatal("no_cache should bypass the cache")
+	}
+}
+
+func TestQueryHandlerFakeClient(t *testing.T) {
+	c, err := fake.New("p", "../bigquery/fake/testdata/shop.json")
+	if err != nil {
+		t.Fatalf("fake.New error: %v", err)
+	}
+	defer c.Close()
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return c, nil }, "p")
+
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{
+		SQL:        "SELECT order_id, amount FROM shop.orders WHERE status = 'done' ORDER BY order_id",
+		resultArgs: resultArgs{MaxRows: 2},
+	})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	out := res.StructuredContent.(queryOutput)
+	if len(out.Rows) != 2 || out.Rows[1]["order_id"] != int64(11) || out.Metadata.TotalRows != 3 || out.Metadata.NextStartRow != 2 {
+		t.Fatalf("unexpected output: %+v", out)
+	}
+
+	// The dry run estimate covers the two referenced columns of all 4 rows.
+	t.Setenv("MAX_BQ_QUERY_BYTES", "63")
+	if _, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT order_id, amount FROM shop.orders LIMIT 1"}); err == nil || !strings.Contains(err.Error(), "would scan 64 bytes") {
+		t.Fatalf("expected byte limit error, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Dynamic labels attached to query jobs.
+const (
+	labelTool      = "mcp_tool"
+	labelSession   = "mcp_session"
+	labelPrincipal = "mcp_principal"
+	labelClient    = "mcp_client"
+)
+
+// LabelConfig configures the labels attached to the query jobs of the
+// server, used to attribute BigQuery costs. Static labels are attached to
+// every job. Dynamic adds labels naming the tool, the MCP session, the
+// authenticated principal and the client. The principal is read from the
+// HTTP header named by PrincipalHeader, such as
+// X-Goog-Authenticated-User-Email set by Identity-Aware Proxy. TagSQL also
+// lists the labels in a comment prepended to the SQL of each job.
+type LabelConfig struct {
+	Static          map[string]string
+	Dynamic         bool
+	PrincipalHeader string
+	TagSQL          bool
+}
+
+// WithJobLabels configures the labels of query jobs.
+func WithJobLabels(cfg LabelConfig) Option {
+	return func(s *Server) {
+		s.labels = cfg
+	}
+}
+
+// ParseLabels parses a comma separated list of key=value labels.
+func ParseLabels(list string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(list, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", kv)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+type principalKey struct{}
+
+// httpContext stores the principal of an HTTP request in its context.
+func (s *Server) httpContext(ctx context.Context, r *http.Request) context.Context {
+	if s.labels.PrincipalHeader == "" {
+		return ctx
+	}
+	p := r.Header.Get(s.labels.PrincipalHeader)
+	// Identity-Aware Proxy prefixes identities with their issuer.
+	p = strings.TrimPrefix(p, "accounts.google.com:")
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// jobLabels returns the labels of the jobs run by tool: the static labels,
+// overridden by the labels of the session context and then by the dynamic
+// labels, which cannot be spoofed by set_context.
+func (s *Server) jobLabels(ctx context.Context, tool string, session map[string]string) map[string]string {
+	labels := bigquery.SanitizeLabels(s.labels.Static)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	maps.Copy(labels, bigquery.SanitizeLabels(session))
+	if s.labels.Dynamic {
+		set := func(k, v string) {
+			if v != "" {
+				labels[k] = v
+			}
+		}
+		set(labelTool, tool)
+		if cs := server.ClientSessionFromContext(ctx); cs != nil {
+			set(labelSession, cs.SessionID())
+			if info, ok := cs.(server.SessionWithClientInfo); ok {
+				set(labelClient, info.GetClientInfo().Name)
+			}
+		}
+		p, _ := ctx.Value(principalKey{}).(string)
+		set(labelPrincipal, p)
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,84 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// clientInfoSession is a session that reports the client of the initialize
+// request.
+type clientInfoSession struct {
+	testSession
+	info mcp.Implementation
+}
+
+func (s *clientInfoSession) GetClientInfo() mcp.Implementation     { return s.info }
+func (s *clientInfoSession) SetClientInfo(info mcp.Implementation) { s.info = info }
+func (s *clientInfoSession) GetClientCapabilities() mcp.ClientCapabilities {
+	return mcp.ClientCapabilities{}
+}
+func (s *clientInfoSession) SetClientCapabilities(_ mcp.ClientCapabilities) {}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels("team=bi, env = prod,")
+	if err != nil || len(labels) != 2 || labels["team"] != "bi" || labels["env"] != "prod" {
+		t.Fatalf("ParseLabels = %v, %v", labels, err)
+	}
+	if _, err := ParseLabels("team"); err == nil {
+		t.Fatal("expected error for label without value")
+	}
+}
+
+func TestJobLabels(t *testing.T) {
+	client := &contextClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithJobLabels(LabelConfig{
+			Static:          map[string]string{"team": "bi", "env": "prod"},
+			Dynamic:         true,
+			PrincipalHeader: "X-Goog-Authenticated-User-Email",
+			TagSQL:          true,
+		}))
+	session := &clientInfoSession{testSession: testSession{id: "S1", notify: make(chan mcp.JSONRPCNotification, 1)}, info: mcp.Implementation{Name: "Claude Desktop"}}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	r.Header.Set("X-Goog-Authenticated-User-Email", "accounts.google.com:alice@example.com")
+	ctx := srv.httpContext(srv.MCPServer().WithContext(context.Background(), session), r)
+
+	// Session labels override static ones but not the dynamic labels.
+	srv.setContextHandler(ctx, mcp.CallToolRequest{}, setContextArgs{Labels: map[string]string{"env": "dev", "MCP_Tool": "spoofed"}})
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "queryfile"
+	if _, err := srv.queryHandler(ctx, req, queryArgs{SQL: "SELECT 1"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	want := map[string]string{
+		"team":          "bi",
+		"env":           "dev",
+		"mcp_tool":      "queryfile",
+		"mcp_session":   "S1",
+		"mcp_principal": "alice@example.com",
+		"mcp_client":    "Claude Desktop",
+	}
+	got := client.cfg.Labels
+	if len(got) != len(want) {
+		t.Fatalf("labels = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("label %s = %q, want %q", k, got[k], v)
+		}
+	}
+	if !client.cfg.TagSQL {
+		t.Error("TagSQL not set")
+	}
+}
+
+var _ server.SessionWithClientInfo = (*clientInfoSession)(nil)
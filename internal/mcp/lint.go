@@ -0,0 +1,295 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqltoken"
+)
+
+// Lint rules checked before a query runs.
+const (
+	ruleSelectStar             = "select_star"
+	ruleMissingPartitionFilter = "missing_partition_filter"
+	ruleCrossJoin              = "cross_join"
+	ruleOrderByWithoutLimit    = "order_by_without_limit"
+	ruleLegacySQL              = "legacy_sql"
+
+	// defaultWideTableColumns is the column count above which SELECT * is
+	// reported.
+	defaultWideTableColumns = 30
+)
+
+var lintRules = []string{ruleSelectStar, ruleMissingPartitionFilter, ruleCrossJoin, ruleOrderByWithoutLimit, ruleLegacySQL}
+
+// LintConfig configures the lint pass that runs before queries are
+// executed. Findings of rules listed in Reject fail the query; all other
+// findings are returned as warnings.
+type LintConfig struct {
+	Enabled          bool
+	Reject           []string
+	WideTableColumns int
+}
+
+// WithLint enables the lint pass of the query tools.
+func WithLint(cfg LintConfig) Option {
+	return func(s *Server) {
+		if cfg.WideTableColumns <= 0 {
+			cfg.WideTableColumns = defaultWideTableColumns
+		}
+		s.lint = cfg
+	}
+}
+
+// ParseLintRules parses a comma separated list of lint rule names.
+func ParseLintRules(list string) ([]string, error) {
+	var rules []string
+	for _, r := range strings.Split(list, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		known := false
+		for _, k := range lintRules {
+			known = known || k == r
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown lint rule %q (valid: %s)", r, strings.Join(lintRules, ", "))
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// lintSQL checks sql and returns its warnings, or an error when a rule
+// configured for rejection fires. Table metadata is used to detect wide and
+// partitioned tables; tables whose metadata cannot be read are skipped, as
+// the dry run reports missing tables anyway.
+func (s *Server) lintSQL(ctx context.Context, c bigquery.Client, sql string) ([]finding, error) {
+	a := analyzeSQL(sql)
+	var findings []finding
+	add := func(rule, format string, args ...any) {
+		findings = append(findings, finding{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	if a.legacy {
+		add(ruleLegacySQL, "the query uses legacy SQL syntax; use GoogleSQL with backtick-quoted `project.dataset.table` names")
+	}
+	for _, t := range a.crossJoins {
+		add(ruleCrossJoin, "CROSS JOIN %s produces every combination of rows; use a join condition or filter both sides first", t)
+	}
+	if a.orderWithoutLimit {
+		add(ruleOrderByWithoutLimit, "ORDER BY without LIMIT sorts the whole result on a single worker; add a LIMIT or drop the ORDER BY")
+	}
+	for _, t := range a.tables {
+		project, dataset, table, ok := s.splitTable(t)
+		if !ok {
+			continue
+		}
+		meta, err := c.GetTableMetadata(ctx, project, dataset, table)
+		if err != nil || meta == nil {
+			continue
+		}
+		if a.selectStar && len(meta.Schema) > s.lint.WideTableColumns {
+			add(ruleSelectStar, "SELECT * reads all %d columns of %s; select only the columns you need or use SELECT * EXCEPT", len(meta.Schema), t)
+		}
+		col := ""
+		switch {
+		case meta.TimePartitioning != nil && meta.TimePartitioning.Field != "":
+			col = meta.TimePartitioning.Field
+		case meta.TimePartitioning != nil:
+			col = "_PARTITIONTIME"
+		case meta.RangePartitioning != nil:
+			col = meta.RangePartitioning.Field
+		}
+		if col != "" && !a.filters(col) {
+			add(ruleMissingPartitionFilter, "%s is partitioned by %s but the query does not filter on it; add a WHERE condition on %s to avoid scanning every partition", t, col, col)
+		}
+	}
+	for _, f := range findings {
+		for _, r := range s.lint.Reject {
+			if f.Rule == r {
+				return nil, fmt.Errorf("query rejected by lint rule %s: %s", f.Rule, f.Message)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// splitTable resolves a table path of two or three parts against the client
+// project.
+func (s *Server) splitTable(path string) (project, dataset, table string, ok bool) {
+	parts := strings.Split(path, ".")
+	switch len(parts) {
+	case 2:
+		return s.clientProject, parts[0], parts[1], true
+	case 3:
+		return parts[0], parts[1], parts[2], true
+	}
+	return "", "", "", false
+}
+
+// sqlAnalysis holds what the linter learned from the tokens of a query.
+type sqlAnalysis struct {
+	tables            []string
+	selectStar        bool
+	crossJoins        []string
+	orderWithoutLimit bool
+	legacy            bool
+	// whereNames are the upper-cased names referenced after WHERE.
+	whereNames map[string]bool
+}
+
+// filters reports whether a WHERE clause references col. Ingestion-time
+// partitioned tables may be filtered on either pseudo column.
+func (a *sqlAnalysis) filters(col string) bool {
+	if col == "_PARTITIONTIME" && a.whereNames["_PARTITIONDATE"] {
+		return true
+	}
+	return a.whereNames[strings.ToUpper(col)]
+}
+
+// analyzeSQL scans the tokens of sql. It is a heuristic without a full
+// parser: table references are the paths following FROM and JOIN, minus
+// names defined as CTEs.
+func analyzeSQL(sql string) *sqlAnalysis {
+	all := sqltoken.Tokenize(sql)
+	a := &sqlAnalysis{whereNames: map[string]bool{}}
+	for _, t := range all {
+		if t.Kind == sqltoken.Comment {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimLeft(t.Text, "#-")), "legacysql") {
+				a.legacy = true
+			}
+			break
+		}
+		if t.Kind != sqltoken.Whitespace {
+			break
+		}
+	}
+	toks := sqltoken.Significant(all)
+	ctes := map[string]bool{}
+	aliases := map[string]bool{}
+	seen := map[string]bool{}
+	var parens []string // function or keyword preceding each open parenthesis
+	inWhere := false
+	orderAt := -1 // depth-0 ORDER BY awaiting a LIMIT
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		next := func(k int) sqltoken.Token {
+			if i+k < len(toks) {
+				return toks[i+k]
+			}
+			return sqltoken.Token{}
+		}
+		switch {
+		case t.Text == "(":
+			prev := ""
+			if i > 0 {
+				prev = toks[i-1].Upper()
+			}
+			parens = append(parens, prev)
+		case t.Text == ")":
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+		case t.Text == ";":
+			if orderAt >= 0 {
+				a.orderWithoutLimit = true
+			}
+			orderAt, inWhere, parens = -1, false, nil
+		case t.Is("WHERE"):
+			inWhere = true
+		case t.Is("GROUP") || t.Is("HAVING") || t.Is("QUALIFY") || t.Is("WINDOW") || t.Is("UNION"):
+			inWhere = false
+		case t.Is("ORDER") && next(1).Is("BY") && len(parens) == 0:
+			orderAt = i
+		case t.Is("LIMIT") && len(parens) == 0:
+			orderAt = -1
+		case t.Is("SELECT"):
+			j := i + 1
+			for j < len(toks) && (toks[j].Is("DISTINCT") || toks[j].Is("ALL") || toks[j].Is("AS") || toks[j].Is("STRUCT") || toks[j].Upper() == "VALUE") {
+				j++
+			}
+			// SELECT * or SELECT alias.*, unless columns are excluded.
+			for j+1 < len(toks) && toks[j+1].Text == "." && toks[j].Kind != sqltoken.Operator {
+				j += 2
+			}
+			if j < len(toks) && toks[j].Text == "*" && !(j+1 < len(toks) && toks[j+1].Is("EXCEPT") && j+2 < len(toks) && toks[j+2].Text == "(") {
+				a.selectStar = true
+			}
+		case (t.Kind == sqltoken.Identifier || t.Kind == sqltoken.QuotedIdentifier) && next(1).Is("AS") && next(2).Text == "(":
+			ctes[strings.ToUpper(unquote(t.Text))] = true
+		case t.Is("FROM") || t.Is("JOIN"):
+			if len(parens) > 0 && parens[len(parens)-1] == "EXTRACT" {
+				break
+			}
+			cross := t.Is("JOIN") && i > 0 && toks[i-1].Is("CROSS")
+			if next(1).Text == "[" {
+				a.legacy = true
+				break
+			}
+			path, n := readPath(toks[i+1:])
+			if path == "" {
+				if cross && !next(1).Is("UNNEST") && next(1).Text != "(" {
+					a.crossJoins = append(a.crossJoins, next(1).Text)
+				} else if cross && next(1).Text == "(" {
+					a.crossJoins = append(a.crossJoins, "(subquery)")
+				}
+				break
+			}
+			first := strings.ToUpper(strings.Split(path, ".")[0])
+			if cross && !aliases[first] {
+				a.crossJoins = append(a.crossJoins, path)
+			}
+			if !ctes[strings.ToUpper(path)] && !aliases[first] && strings.Contains(path, ".") && !seen[path] {
+				seen[path] = true
+				a.tables = append(a.tables, path)
+			}
+			// Record the alias of the table, used to recognize correlated
+			// array joins such as CROSS JOIN t.items.
+			j := i + 1 + n
+			if j < len(toks) && toks[j].Is("AS") {
+				j++
+			}
+			if j < len(toks) && (toks[j].Kind == sqltoken.Identifier || toks[j].Kind == sqltoken.QuotedIdentifier) {
+				aliases[strings.ToUpper(unquote(toks[j].Text))] = true
+			}
+			i += n
+		case inWhere && (t.Kind == sqltoken.Identifier || t.Kind == sqltoken.QuotedIdentifier):
+			for _, part := range strings.Split(unquote(t.Text), ".") {
+				a.whereNames[strings.ToUpper(part)] = true
+			}
+		}
+	}
+	if orderAt >= 0 {
+		a.orderWithoutLimit = true
+	}
+	return a
+}
+
+// readPath reads a dotted table path from the start of toks and returns it
+// without backticks together with the number of tokens consumed. It returns
+// "" when toks does not start with a name.
+func readPath(toks []sqltoken.Token) (string, int) {
+	var parts []string
+	n := 0
+	for n < len(toks) {
+		t := toks[n]
+		if t.Kind != sqltoken.Identifier && t.Kind != sqltoken.QuotedIdentifier {
+			break
+		}
+		parts = append(parts, unquote(t.Text))
+		n++
+		if n+1 < len(toks) && toks[n].Text == "." {
+			n++
+			continue
+		}
+		break
+	}
+	return strings.Join(parts, "."), n
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, "`")
+}
@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func wideSchema(n int) bigquery.Schema {
+	schema := make(bigquery.Schema, n)
+	for i := range schema {
+		schema[i] = &bigquery.FieldSchema{Name: fmt.Sprintf("c%d", i), Type: bigquery.StringFieldType}
+	}
+	return schema
+}
+
+func lintRulesOf(fs []finding) []string {
+	var rules []string
+	for _, f := range fs {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func TestLintSQL(t *testing.T) {
+	mock := &tableMetadataClient{MockClient: &bq.MockClient{}, tables: map[string]*bigquery.TableMetadata{
+		"events": {Schema: wideSchema(40), TimePartitioning: &bigquery.TimePartitioning{Field: "ts"}},
+		"logs":   {Schema: wideSchema(3), TimePartitioning: &bigquery.TimePartitioning{}},
+		"users":  {Schema: wideSchema(3)},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithLint(LintConfig{Enabled: true}))
+
+	cases := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT id FROM ds.users ORDER BY id LIMIT 10", nil},
+		{"SELECT * FROM ds.users", nil},
+		{"SELECT * FROM `p.ds.events` WHERE ts > '2024-01-01'", []string{ruleSelectStar}},
+		{"SELECT * EXCEPT (a) FROM ds.events WHERE DATE(e.ts) = CURRENT_DATE()", nil},
+		{"SELECT id FROM ds.events", []string{ruleMissingPartitionFilter}},
+		{"SELECT id FROM ds.logs WHERE _PARTITIONDATE = '2024-01-01'", nil},
+		{"SELECT id FROM ds.logs WHERE id = 1", []string{ruleMissingPartitionFilter}},
+		{"SELECT a.id FROM ds.users a CROSS JOIN ds.users b", []string{ruleCrossJoin}},
+		{"SELECT a.id FROM ds.users AS a CROSS JOIN a.items CROSS JOIN UNNEST([1, 2])", nil},
+		{"SELECT id FROM ds.users ORDER BY id", []string{ruleOrderByWithoutLimit}},
+		{"SELECT ROW_NUMBER() OVER (ORDER BY id) FROM (SELECT id FROM ds.users ORDER BY id)", nil},
+		{"WITH u AS (SELECT id FROM ds.users) SELECT EXTRACT(DAY FROM u.ts) FROM u", nil},
+		{"#legacySQL\nSELECT id FROM ds.users", []string{ruleLegacySQL}},
+		{"SELECT id FROM [p:ds.users]", []string{ruleLegacySQL}},
+	}
+	for _, tc := range cases {
+		got, err := srv.lintSQL(context.Background(), mock, tc.sql)
+		if err != nil {
+			t.Fatalf("lintSQL(%q) error: %v", tc.sql, err)
+		}
+		if strings.Join(lintRulesOf(got), ",") != strings.Join(tc.want, ",") {
+			t.Errorf("lintSQL(%q) = %v, want %v", tc.sql, lintRulesOf(got), tc.want)
+		}
+	}
+}
+
+func TestQueryHandlerLint(t *testing.T) {
+	mock := &tableMetadataClient{MockClient: &bq.MockClient{QueryRes: []map[string]bigquery.Value{{"id": "1"}}}, tables: map[string]*bigquery.TableMetadata{
+		"users": {Schema: wideSchema(3)},
+	}}
+	provider := func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }
+	sql := "SELECT id FROM ds.users ORDER BY id"
+
+	srv := NewServer(provider, "p", WithLint(LintConfig{Enabled: true}))
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: sql})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	meta := res.StructuredContent.(queryOutput).Metadata
+	if len(meta.Warnings) != 1 || meta.Warnings[0].Rule != ruleOrderByWithoutLimit {
+		t.Fatalf("unexpected warnings: %+v", meta.Warnings)
+	}
+
+	srv = NewServer(provider, "p", WithLint(LintConfig{Enabled: true, Reject: []string{ruleOrderByWithoutLimit}}))
+	_, err = srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: sql})
+	if err == nil || !strings.Contains(err.Error(), "rejected by lint rule order_by_without_limit") {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+}
+
+func TestParseLintRules(t *testing.T) {
+	rules, err := ParseLintRules(" cross_join, legacy_sql ")
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("unexpected rules %v: %v", rules, err)
+	}
+	if _, err := ParseLintRules("nope"); err == nil {
+		t.Fatal("expected error for unknown rule")
+	}
+}
@@ -0,0 +1,466 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/apache/arrow/go/v15/parquet/file"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Load file formats.
+const (
+	loadCSV     = "csv"
+	loadJSONL   = "jsonl"
+	loadParquet = "parquet"
+)
+
+// loadExtensions maps file extensions to load formats.
+var loadExtensions = map[string]string{
+	".csv":     loadCSV,
+	".jsonl":   loadJSONL,
+	".ndjson":  loadJSONL,
+	".json":    loadJSONL,
+	".parquet": loadParquet,
+}
+
+var loadFormats = map[string]bigquery.DataFormat{
+	loadCSV:     bigquery.CSV,
+	loadJSONL:   bigquery.JSON,
+	loadParquet: bigquery.Parquet,
+}
+
+// Write dispositions of the load tool.
+const (
+	writeEmpty    = "empty"
+	writeAppend   = "append"
+	writeTruncate = "truncate"
+)
+
+var writeDispositions = map[string]bigquery.TableWriteDisposition{
+	writeEmpty:    bigquery.WriteEmpty,
+	writeAppend:   bigquery.WriteAppend,
+	writeTruncate: bigquery.WriteTruncate,
+}
+
+// tableNamePattern restricts the names of the tables created by the server.
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// maxTableNameLength is the length limit of BigQuery table names.
+const maxTableNameLength = 1024
+
+func validTableName(name string) bool {
+	return len(name) <= maxTableNameLength && tableNamePattern.MatchString(name)
+}
+
+// LoadConfig configures the load tool, which loads files read from Dir into
+// tables of the scratch dataset. The tool is only offered in write mode with
+// Dir and the scratch dataset set. MaxBytes and MaxRows cap the size of each
+// file; zero disables a cap.
+type LoadConfig struct {
+	Dir      string
+	MaxBytes int64
+	MaxRows  int64
+}
+
+// WithLoad configures the load tool.
+func WithLoad(cfg LoadConfig) Option {
+	return func(s *Server) {
+		s.load = cfg
+	}
+}
+
+type loadArgs struct {
+	Path             string          `json:"path"`
+	Table            string          `json:"table"`
+	Format           string          `json:"format,omitempty"`
+	Schema           json.RawMessage `json:"schema,omitempty"`
+	WriteDisposition string          `json:"write_disposition,omitempty"`
+	ExpirationHours  float64         `json:"expiration_hours,omitempty"`
+}
+
+type loadOutput struct {
+	Table     string       `json:"table"`
+	Format    string       `json:"format"`
+	TotalRows int64        `json:"total_rows"`
+	Bytes     int64        `json:"bytes"`
+	Columns   []flatColumn `json:"columns,omitempty"`
+	Expires   string       `json:"expires,omitempty"`
+	JobID     string       `json:"job_id,omitempty"`
+}
+
+// registerLoad installs the load tool when it is enabled.
+func (s *Server) registerLoad() {
+	if !s.writes || s.load.Dir == "" || s.scratch.Dataset == "" {
+		return
+	}
+	s.mcpServer.AddTool(mcp.NewTool(
+		"load",
+		mcp.WithDescription("Load a local CSV, JSONL or Parquet file into a table of the scratch dataset with a load job, e.g. to join reference data in queries"),
+		mcp.WithString("path", mcp.Required(), mcp.Description("File path relative to the load directory")),
+		mcp.WithString("table", mcp.Required(), mcp.Description("Table in the scratch dataset, created when missing; the table ID returned carries a per-session prefix")),
+		mcp.WithString("format", mcp.Enum(loadCSV, loadJSONL, loadParquet), mcp.Description("File format; defaults to the format matching the path extension")),
+		mcp.WithArray("schema", mcp.Description("Table schema in the bq JSON format, e.g. [{\"name\": \"id\", \"type\": \"INTEGER\"}]; inferred from the values of CSV files, detected by BigQuery for JSONL and read from Parquet files when omitted"),
+			mcp.Items(map[string]any{"type": "object"})),
+		mcp.WithString("write_disposition", mcp.Enum(writeEmpty, writeAppend, writeTruncate), mcp.Description("empty: fail if the table has rows (default); append: add the rows; truncate: replace the rows")),
+		mcp.WithNumber("expiration_hours", mcp.Description("Hours until the table expires; defaults to the scratch dataset setting")),
+		mcp.WithRawOutputSchema(loadOutputSchema),
+	), mcp.NewTypedToolHandler(s.loadHandler))
+}
+
+func (s *Server) loadHandler(ctx context.Context, req mcp.CallToolRequest, args loadArgs) (*mcp.CallToolResult, error) {
+	if !s.writes {
+		return nil, errors.New("write mode is disabled")
+	}
+	if sessionID(ctx) == "" {
+		return nil, errors.New("load requires an MCP session")
+	}
+	tool := toolName(req, "load")
+	if !validTableName(args.Table) {
+		return nil, fmt.Errorf("invalid table name %q: use letters, digits and underscores", args.Table)
+	}
+	format := args.Format
+	if format == "" {
+		format = loadExtensions[strings.ToLower(filepath.Ext(args.Path))]
+		if format == "" {
+			return nil, fmt.Errorf("cannot tell the format of %s; pass format", args.Path)
+		}
+	}
+	dataFormat, ok := loadFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown load format %q", format)
+	}
+	disposition := writeEmpty
+	if args.WriteDisposition != "" {
+		disposition = args.WriteDisposition
+	}
+	wd, ok := writeDispositions[disposition]
+	if !ok {
+		return nil, fmt.Errorf("unknown write disposition %q", args.WriteDisposition)
+	}
+	schema, err := parseSchemaArg(args.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Clean(filepath.FromSlash(args.Path))
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("path %q must be relative and stay within the load directory", args.Path)
+	}
+	root, err := os.OpenRoot(s.load.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !st.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", args.Path)
+	}
+	if s.load.MaxBytes > 0 && st.Size() > s.load.MaxBytes {
+		return nil, fmt.Errorf("%s has %d bytes, more than the limit of %d", args.Path, st.Size(), s.load.MaxBytes)
+	}
+
+	// Check the row cap, and infer the schema of CSV files, before
+	// uploading anything.
+	var inferred bigquery.Schema
+	switch format {
+	case loadCSV:
+		inferred, err = scanCSV(f, s.load.MaxRows)
+	case loadJSONL:
+		err = scanJSONL(f, s.load.MaxRows)
+	case loadParquet:
+		err = scanParquet(f, st.Size(), s.load.MaxRows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", args.Path, err)
+	}
+	if schema == nil {
+		schema = inferred
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	opts := bq.LoadOptions{Format: dataFormat, Schema: schema, WriteDisposition: wd, Expiration: s.tableExpiration(time.Now(), args.ExpirationHours)}
+	if format == loadCSV {
+		opts.SkipLeadingRows = 1
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	ctx = bq.WithQueryConfig(ctx, bq.QueryConfig{Labels: s.jobLabels(ctx, tool, s.sessions.get(sessionID(ctx)).Labels)})
+	project, dataset := s.scratchDataset()
+	table := scratchTable(ctx, args.Table)
+	res, err := c.LoadTable(ctx, project, dataset, table, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !s.scratchTables.add(sessionID(ctx), table) {
+		s.dropOrphanedTable(ctx, c, table)
+		return nil, errors.New("the MCP session ended while the file was loaded; the table was dropped")
+	}
+	out := loadOutput{
+		Table:     project + "." + dataset + "." + table,
+		Format:    format,
+		TotalRows: res.OutputRows,
+		Bytes:     st.Size(),
+		JobID:     res.JobID,
+	}
+	if schema != nil {
+		out.Columns = flattenSchema(schema)
+	}
+	if !opts.Expiration.IsZero() {
+		out.Expires = opts.Expiration.UTC().Format(time.RFC3339)
+	}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+// parseSchemaArg parses a schema in the bq JSON format. Clients that cannot
+// send arrays may pass the schema as a JSON string.
+func parseSchemaArg(raw json.RawMessage) (bigquery.Schema, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		raw = []byte(s)
+	}
+	schema, err := bigquery.SchemaFromJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return schema, nil
+}
+
+// checkRows reports an error once n exceeds the row cap max.
+func checkRows(n, max int64) error {
+	if max > 0 && n > max {
+		return fmt.Errorf("more than the limit of %d rows", max)
+	}
+	return nil
+}
+
+// scanCSV checks the row cap of a CSV file with a header line and infers
+// its schema: column names come from the header, and each column gets the
+// narrowest of INTEGER, FLOAT, BOOLEAN, DATE, TIMESTAMP and STRING that fits
+// all its non-empty values.
+func scanCSV(r io.Reader, maxRows int64) (bigquery.Schema, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := columnNames(header)
+	kinds := make([]csvKind, len(names))
+	for i := range kinds {
+		kinds[i] = csvAny
+	}
+	var n int64
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		n++
+		if err := checkRows(n, maxRows); err != nil {
+			return nil, err
+		}
+		for i, v := range record {
+			if v != "" {
+				kinds[i] &= valueKinds(v)
+			}
+		}
+	}
+	schema := make(bigquery.Schema, len(names))
+	for i, name := range names {
+		schema[i] = &bigquery.FieldSchema{Name: name, Type: kinds[i].fieldType()}
+	}
+	return schema, nil
+}
+
+// csvKind is a set of the types a CSV value can be loaded as.
+type csvKind uint8
+
+const (
+	csvInteger csvKind = 1 << iota
+	csvFloat
+	csvBoolean
+	csvDate
+	csvTimestamp
+
+	csvAny = csvInteger | csvFloat | csvBoolean | csvDate | csvTimestamp
+)
+
+// timestampLayouts are the timestamp formats recognized in CSV files.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+func valueKinds(v string) csvKind {
+	var k csvKind
+	// Values that do not survive a round trip through a number, such as
+	// 007, +1 or integers beyond INT64, are identifiers and stay strings.
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && strconv.FormatInt(n, 10) == v {
+		k |= csvInteger | csvFloat
+	} else if _, err := strconv.ParseFloat(v, 64); err == nil && !strings.HasPrefix(v, "+") && !leadingZero(v) && !digits(strings.TrimPrefix(v, "-")) {
+		k |= csvFloat
+	}
+	if strings.EqualFold(v, "true") || strings.EqualFold(v, "false") {
+		k |= csvBoolean
+	}
+	if _, err := civil.ParseDate(v); err == nil {
+		k |= csvDate
+	}
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			k |= csvTimestamp
+			break
+		}
+	}
+	return k
+}
+
+// leadingZero reports whether the integer part of a number has a leading
+// zero, as in 007 or 01.5.
+func leadingZero(v string) bool {
+	v = strings.TrimPrefix(v, "-")
+	return len(v) > 1 && v[0] == '0' && v[1] >= '0' && v[1] <= '9'
+}
+
+// digits reports whether v consists of decimal digits only.
+func digits(v string) bool {
+	return v != "" && strings.Trim(v, "0123456789") == ""
+}
+
+// fieldType returns the narrowest type in k. Columns without values are
+// strings.
+func (k csvKind) fieldType() bigquery.FieldType {
+	switch {
+	case k == csvAny:
+		return bigquery.StringFieldType
+	case k&csvInteger != 0:
+		return bigquery.IntegerFieldType
+	case k&csvFloat != 0:
+		return bigquery.FloatFieldType
+	case k&csvBoolean != 0:
+		return bigquery.BooleanFieldType
+	case k&csvDate != 0:
+		return bigquery.DateFieldType
+	case k&csvTimestamp != 0:
+		return bigquery.TimestampFieldType
+	}
+	return bigquery.StringFieldType
+}
+
+// columnNames turns CSV header fields into valid, distinct column names:
+// characters other than letters, digits and underscores become underscores
+// and names starting with a digit are prefixed with one.
+func columnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, h := range header {
+		var b strings.Builder
+		for _, r := range strings.TrimSpace(h) {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		name := b.String()
+		if name == "" || unicode.IsDigit(rune(name[0])) {
+			name = "_" + name
+		}
+		if len(name) > 300 {
+			name = name[:300]
+		}
+		base := name
+		for j := 2; seen[strings.ToLower(name)]; j++ {
+			name = base + "_" + strconv.Itoa(j)
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// scanJSONL checks that every non-blank line of a JSONL file is a JSON
+// object and that the row cap is respected.
+func scanJSONL(r io.Reader, maxRows int64) error {
+	br := bufio.NewReader(r)
+	var n, line int64
+	for {
+		b, err := br.ReadBytes('\n')
+		if len(b) > 0 {
+			line++
+		}
+		if t := bytes.TrimSpace(b); len(t) > 0 {
+			if t[0] != '{' || !json.Valid(t) {
+				return fmt.Errorf("line %d is not a JSON object", line)
+			}
+			n++
+			if err := checkRows(n, maxRows); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scanParquet checks the row cap against the row count in the footer of a
+// Parquet file of size bytes.
+func scanParquet(r io.ReaderAt, size, maxRows int64) error {
+	// The section reader keeps the Parquet reader from closing r.
+	pf, err := file.NewParquetReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+	return checkRows(pf.NumRows(), maxRows)
+}
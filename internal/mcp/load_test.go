@@ -0,0 +1,260 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// loadClient records the load jobs it is asked to run.
+type loadClient struct {
+	*bq.MockClient
+	project, dataset, table string
+	data                    string
+	opts                    bq.LoadOptions
+	labels                  map[string]string
+}
+
+func (c *loadClient) LoadTable(ctx context.Context, projectID, datasetID, tableID string, data io.Reader, opts bq.LoadOptions) (*bq.LoadResult, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	c.project, c.dataset, c.table, c.data, c.opts = projectID, datasetID, tableID, string(b), opts
+	c.labels = bq.QueryConfigFrom(ctx).Labels
+	return &bq.LoadResult{JobID: "load_1", OutputRows: 2}, nil
+}
+
+func TestLoadCSV(t *testing.T) {
+	dir := t.TempDir()
+	csv := "id,Account ID,score,active,day,at,note\n" +
+		"1,a-1,1.5,true,2024-01-02,2024-01-02T03:04:05Z,\n" +
+		"2,b-2,2,FALSE,2024-01-03,2024-01-03 00:00:00,x\n"
+	if err := os.WriteFile(filepath.Join(dir, "accounts.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := &loadClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch", Expiration: 24 * time.Hour}),
+		WithLoad(LoadConfig{Dir: dir}), WithJobLabels(LabelConfig{Dynamic: true}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+
+	before := time.Now()
+	res, err := srv.loadHandler(ctx, mcp.CallToolRequest{}, loadArgs{Path: "accounts.csv", Table: "accounts"})
+	if err != nil {
+		t.Fatalf("loadHandler error: %v", err)
+	}
+	out := res.StructuredContent.(loadOutput)
+	table := scratchPrefix("s1") + "accounts"
+	if out.Table != "p.scratch."+table || out.TotalRows != 2 || out.Bytes != int64(len(csv)) || out.JobID != "load_1" {
+		t.Errorf("load = %+v", out)
+	}
+	if client.project != "p" || client.dataset != "scratch" || client.table != table || client.data != csv {
+		t.Errorf("loaded %s.%s.%s: %q", client.project, client.dataset, client.table, client.data)
+	}
+	if client.opts.Format != bigquery.CSV || client.opts.SkipLeadingRows != 1 || client.opts.WriteDisposition != bigquery.WriteEmpty {
+		t.Errorf("load options = %+v", client.opts)
+	}
+	if exp := client.opts.Expiration; exp.Before(before.Add(24*time.Hour)) || exp.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("expiration = %v, want in 24 hours", exp)
+	}
+	var types []string
+	for _, f := range client.opts.Schema {
+		types = append(types, f.Name+" "+string(f.Type))
+	}
+	want := "id INTEGER,Account_ID STRING,score FLOAT,active BOOLEAN,day DATE,at TIMESTAMP,note STRING"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("inferred schema = %s, want %s", got, want)
+	}
+	if len(out.Columns) != 7 {
+		t.Errorf("columns = %+v", out.Columns)
+	}
+	if client.labels[labelTool] != "load" {
+		t.Errorf("job labels = %v", client.labels)
+	}
+}
+
+func TestScanCSVKeepsIdentifiers(t *testing.T) {
+	csv := "zip,code,big,ratio,n\n" +
+		"007,1,12345678901234567890,0.5,-3\n" +
+		"123,+2,1,01.5,4\n"
+	schema, err := scanCSV(strings.NewReader(csv), 0)
+	if err != nil {
+		t.Fatalf("scanCSV error: %v", err)
+	}
+	var types []string
+	for _, f := range schema {
+		types = append(types, string(f.Type))
+	}
+	want := "STRING,STRING,STRING,STRING,INTEGER"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("inferred types = %s, want %s", got, want)
+	}
+}
+
+func TestLoadExplicitSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ids.txt"), []byte("{\"id\": \"1\"}\n\n{\"id\": \"2\"}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := &loadClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch", Expiration: 24 * time.Hour}),
+		WithLoad(LoadConfig{Dir: dir}), WithJobLabels(LabelConfig{Dynamic: true}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+
+	schema := json.RawMessage(`"[{\"name\": \"id\", \"type\": \"STRING\", \"mode\": \"REQUIRED\"}]"`)
+	_, err := srv.loadHandler(ctx, mcp.CallToolRequest{}, loadArgs{
+		Path: "ids.txt", Table: "ids", Format: loadJSONL, Schema: schema, WriteDisposition: writeTruncate, ExpirationHours: 1,
+	})
+	if err != nil {
+		t.Fatalf("loadHandler error: %v", err)
+	}
+	if client.opts.Format != bigquery.JSON || client.opts.WriteDisposition != bigquery.WriteTruncate || client.opts.SkipLeadingRows != 0 {
+		t.Errorf("load options = %+v", client.opts)
+	}
+	if len(client.opts.Schema) != 1 || !client.opts.Schema[0].Required {
+		t.Errorf("schema = %+v", client.opts.Schema)
+	}
+	if exp := time.Until(client.opts.Expiration); exp > time.Hour || exp < 59*time.Minute {
+		t.Errorf("expiration in %v, want an hour", exp)
+	}
+
+	// JSONL without a schema is left to BigQuery's detection.
+	if err := os.WriteFile(filepath.Join(dir, "ids.jsonl"), []byte("{\"id\": 1}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.loadHandler(ctx, mcp.CallToolRequest{}, loadArgs{Path: "ids.jsonl", Table: "ids"}); err != nil {
+		t.Fatalf("loadHandler error: %v", err)
+	}
+	if client.opts.Schema != nil {
+		t.Errorf("schema = %+v, want detection", client.opts.Schema)
+	}
+}
+
+func TestLoadParquetRowCap(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "users.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := newExportSink(f, 0)
+	w := newExportWriter(exportParquet, sink)
+	defer w.Release()
+	if _, err := bq.WriteResult(&bq.QueryResult{Schema: exportSchema, Rows: exportRows}, w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sink.Flush()
+	f.Close()
+
+	client := &loadClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch", Expiration: 24 * time.Hour}),
+		WithLoad(LoadConfig{Dir: dir, MaxRows: 1}), WithJobLabels(LabelConfig{Dynamic: true}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	_, err = srv.loadHandler(ctx, mcp.CallToolRequest{}, loadArgs{Path: "users.parquet", Table: "users"})
+	if err == nil || !strings.Contains(err.Error(), "limit of 1 rows") {
+		t.Fatalf("expected row cap error, got %v", err)
+	}
+	srv = NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch", Expiration: 24 * time.Hour}),
+		WithLoad(LoadConfig{Dir: dir, MaxRows: 2}), WithJobLabels(LabelConfig{Dynamic: true}))
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	if _, err := srv.loadHandler(ctx, mcp.CallToolRequest{}, loadArgs{Path: "users.parquet", Table: "users"}); err != nil {
+		t.Fatalf("loadHandler error: %v", err)
+	}
+	if client.opts.Format != bigquery.Parquet || client.opts.Schema != nil {
+		t.Errorf("load options = %+v", client.opts)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rows.csv"), []byte("a\n1\n2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.jsonl"), []byte("{\"a\": 1}\n[1]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := &loadClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch", Expiration: 24 * time.Hour}),
+		WithLoad(LoadConfig{Dir: dir, MaxBytes: 100, MaxRows: 2}), WithJobLabels(LabelConfig{Dynamic: true}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	if err := os.WriteFile(filepath.Join(dir, "big.csv"), []byte("a\n"+strings.Repeat("1\n", 60)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		args loadArgs
+		want string
+	}{
+		{loadArgs{Path: "rows.csv", Table: "t"}, "limit of 2 rows"},
+		{loadArgs{Path: "big.csv", Table: "t"}, "more than the limit of 100"},
+		{loadArgs{Path: "bad.jsonl", Table: "t"}, "line 2 is not a JSON object"},
+		{loadArgs{Path: "../rows.csv", Table: "t"}, "within the load directory"},
+		{loadArgs{Path: "rows.csv", Table: "other.t"}, "invalid table name"},
+		{loadArgs{Path: "rows.txt", Table: "t"}, "pass format"},
+		{loadArgs{Path: "rows.csv", Table: "t", WriteDisposition: "merge"}, "unknown write disposition"},
+		{loadArgs{Path: "rows.csv", Table: "t", Schema: json.RawMessage(`[{"name": 1}]`)}, "invalid schema"},
+	} {
+		if _, err := srv.loadHandler(ctx, mcp.CallToolRequest{}, tc.args); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("load %+v: error = %v, want %q", tc.args, err, tc.want)
+		}
+	}
+	if client.table != "" {
+		t.Errorf("rejected file was loaded into %s", client.table)
+	}
+}
+
+func TestLoadRequiresWriteMode(t *testing.T) {
+	client := &loadClient{MockClient: &bq.MockClient{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithScratchDataset(ScratchConfig{Dataset: "scratch"}), WithLoad(LoadConfig{Dir: t.TempDir()}))
+	if srv.MCPServer().GetTool("load") != nil {
+		t.Error("load tool registered without write mode")
+	}
+	if _, err := srv.loadHandler(context.Background(), mcp.CallToolRequest{}, loadArgs{Path: "a.csv", Table: "t"}); err == nil {
+		t.Error("load ran without write mode")
+	}
+	srv = NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "scratch"}), WithLoad(LoadConfig{Dir: t.TempDir()}))
+	if srv.MCPServer().GetTool("load") == nil {
+		t.Error("load tool not registered in write mode")
+	}
+	_, err := srv.loadHandler(context.Background(), mcp.CallToolRequest{}, loadArgs{Path: "a.csv", Table: "t"})
+	if err == nil || !strings.Contains(err.Error(), "requires an MCP session") {
+		t.Errorf("expected session error, got %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package mcp
+
+import (
+	"encoding/json"
+
+	"cloud.google.com/go/bigquery"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Output schemas advertised on tool definitions. Structured content is
+// always a JSON object as required by the MCP specification; the text
+// content of each result remains available as a fallback.
+var (
+	schemaOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "fields": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "Name": {"type": "string"},
+          "Type": {"type": "string"},
+          "Description": {"type": "string"},
+          "Repeated": {"type": "boolean"},
+          "Required": {"type": "boolean"},
+          "Schema": {"type": ["array", "null"], "description": "Nested fields of RECORD columns"}
+        },
+        "required": ["Name", "Type"]
+      }
+    },
+    "columns": {
+      "type": "array",
+      "description": "Flattened fields, returned in flatten mode",
+      "items": {
+        "type": "object",
+        "properties": {
+          "path": {"type": "string", "description": "Dotted field path, e.g. address.city"},
+          "type": {"type": "string"},
+          "mode": {"type": "string", "enum": ["NULLABLE", "REQUIRED", "REPEATED"]},
+          "description": {"type": "string"},
+          "policy_tags": {"type": "array", "items": {"type": "string"}},
+          "default_value_expression": {"type": "string"}
+        },
+        "required": ["path", "type", "mode"]
+      }
+    },
+    "ddl": {"type": "string", "description": "CREATE statement, returned in ddl mode"}
+  },
+  "anyOf": [{"required": ["fields"]}, {"required": ["columns"]}, {"required": ["ddl"]}]
+}`)
+
+	tablesOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "tables": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["tables"]
+}`)
+
+	dryRunOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "TotalBytesProcessed": {"type": "integer"},
+    "TotalBytesProcessedAccuracy": {"type": "string"},
+    "TotalBytesBilled": {"type": "integer"},
+    "CacheHit": {"type": "boolean"},
+    "StatementType": {"type": "string"},
+    "Schema": {"type": ["array", "null"]},
+    "ReferencedTables": {"type": ["array", "null"]}
+  },
+  "required": ["TotalBytesProcessed"]
+}`)
+
+	queryOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "rows": {"type": "array", "items": {"type": "object"}},
+    "row_schema": {"type": "object", "description": "JSON Schema describing each row, derived from the query result schema"},
+    "metadata": {
+      "type": "object",
+      "properties": {
+        "total_rows": {"type": "integer"},
+        "start_row": {"type": "integer"},
+        "rows_returned": {"type": "integer"},
+        "truncated": {"type": "boolean"},
+        "truncated_fields": {"type": "array", "items": {"type": "string"}},
+        "next_start_row": {"type": "integer"},
+        "hint": {"type": "string"},
+        "cache_hit": {"type": "boolean"},
+        "job_id": {"type": "string"},
+        "warnings": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "rule": {"type": "string"},
+              "message": {"type": "string"}
+            },
+            "required": ["rule", "message"]
+          }
+        },
+        "session_id": {"type": "string"},
+        "redacted_columns": {"type": "array", "items": {"type": "string"}, "description": "Columns whose values were masked, hashed or dropped by the redaction policy"}
+      }
+    },
+    "statements": {
+      "type": "array",
+      "description": "Results of the statements of a multi-statement script, in order",
+      "items": {
+        "type": "object",
+        "properties": {
+          "index": {"type": "integer"},
+          "job_id": {"type": "string"},
+          "statement_type": {"type": "string"},
+          "num_dml_affected_rows": {"type": "integer"},
+          "rows": {"type": "array", "items": {"type": "object"}},
+          "total_rows": {"type": "integer"},
+          "truncated": {"type": "boolean"}
+        },
+        "required": ["index", "job_id"]
+      }
+    }
+  },
+  "required": ["rows", "row_schema", "metadata"]
+}`)
+
+	profileOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "table": {"type": "string"},
+    "row_count": {"type": "integer"},
+    "sample_percent": {"type": "number"},
+    "estimated_bytes_processed": {"type": "integer"},
+    "columns": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "type": {"type": "string"},
+          "repeated": {"type": "boolean"},
+          "nulls": {"type": "integer", "description": "Null values, or empty arrays for repeated columns"},
+          "null_fraction": {"type": "number"},
+          "approx_distinct": {"type": "integer"},
+          "min": {},
+          "max": {},
+          "top_values": {
+            "type": "array",
+            "items": {"type": "object", "properties": {"value": {}, "count": {"type": "integer"}}}
+          },
+          "min_length": {"type": "integer"},
+          "max_length": {"type": "integer"},
+          "avg_length": {"type": "number"}
+        },
+        "required": ["name", "type", "nulls", "null_fraction"]
+      }
+    },
+    "redacted_columns": {"type": "array", "items": {"type": "string"}, "description": "Columns whose min, max and top values were masked, hashed or dropped by the redaction policy"},
+    "sql": {"type": "string"}
+  },
+  "required": ["table", "row_count", "columns", "sql"]
+}`)
+
+	searchColumnsOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "matches": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "table": {"type": "string", "description": "Fully qualified table: project.dataset.table"},
+          "field_path": {"type": "string", "description": "Dotted path of the column or nested field"},
+          "type": {"type": "string"},
+          "description": {"type": "string"}
+        },
+        "required": ["table", "field_path", "type"]
+      }
+    },
+    "truncated": {"type": "boolean"},
+    "source": {"type": "string"}
+  },
+  "required": ["matches", "truncated", "source"]
+}`)
+
+	formatSQLOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "sql": {"type": "string"}
+  },
+  "required": ["sql"]
+}`)
+
+	exportOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Absolute path of the written file"},
+    "format": {"type": "string", "enum": ["csv", "jsonl", "parquet", "arrow"]},
+    "total_rows": {"type": "integer"},
+    "bytes": {"type": "integer"},
+    "sha256": {"type": "string", "description": "Hex encoded SHA-256 checksum of the file"},
+    "job_id": {"type": "string"}
+  },
+  "required": ["path", "format", "total_rows", "bytes", "sha256"]
+}`)
+
+	loadOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "table": {"type": "string", "description": "project.dataset.table the file was loaded into"},
+    "format": {"type": "string", "enum": ["csv", "jsonl", "parquet"]},
+    "total_rows": {"type": "integer", "description": "Rows written by the load job"},
+    "bytes": {"type": "integer", "description": "Size of the loaded file"},
+    "columns": {
+      "type": "array",
+      "description": "Schema given or inferred for the load, if any",
+      "items": {
+        "type": "object",
+        "properties": {
+          "path": {"type": "string"},
+          "type": {"type": "string"},
+          "mode": {"type": "string"}
+        },
+        "required": ["path", "type", "mode"]
+      }
+    },
+    "expires": {"type": "string", "description": "Expiration time of the table (RFC 3339)"},
+    "job_id": {"type": "string"}
+  },
+  "required": ["table", "format", "total_rows", "bytes"]
+}`)
+
+	scratchTableOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "table": {"type": "string", "description": "project.dataset.table to reference in queries"},
+    "name": {"type": "string", "description": "Table name without the session prefix"},
+    "rows": {"type": "integer"},
+    "bytes": {"type": "integer"},
+    "created": {"type": "string", "description": "Creation time of the table (RFC 3339)"},
+    "expires": {"type": "string", "description": "Expiration time of the table (RFC 3339)"},
+    "job_id": {"type": "string"}
+  },
+  "required": ["table", "name", "rows", "bytes"]
+}`)
+
+	listScratchTablesOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "tables": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "table": {"type": "string"},
+          "name": {"type": "string", "description": "Table name without the session prefix; the table ID for tables of other sessions"},
+          "rows": {"type": "integer"},
+          "bytes": {"type": "integer"},
+          "created": {"type": "string"},
+          "expires": {"type": "string"}
+        },
+        "required": ["table", "name", "rows", "bytes"]
+      }
+    }
+  },
+  "required": ["tables"]
+}`)
+
+	contextOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "dataset_project": {"type": "string"},
+    "dataset": {"type": "string"},
+    "location": {"type": "string"},
+    "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+  }
+}`)
+
+	explainOutputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "job_id": {"type": "string"},
+    "statement_type": {"type": "string"},
+    "cache_hit": {"type": "boolean"},
+    "total_bytes_processed": {"type": "integer"},
+    "total_bytes_billed": {"type": "integer"},
+    "slot_ms": {"type": "integer"},
+    "elapsed_ms": {"type": "integer"},
+    "peak_active_units": {"type": "integer"},
+    "stages": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string"},
+          "status": {"type": "string"},
+          "inputs": {"type": "array", "items": {"type": "integer"}, "description": "IDs of the input stages"},
+          "parallel_inputs": {"type": "integer"},
+          "records_read": {"type": "integer"},
+          "records_written": {"type": "integer"},
+          "shuffle_output_bytes": {"type": "integer"},
+          "shuffle_output_bytes_spilled": {"type": "integer"},
+          "duration_ms": {"type": "integer"},
+          "wait_avg_ms": {"type": "integer"},
+          "compute_avg_ms": {"type": "integer"},
+          "compute_max_ms": {"type": "integer"},
+          "skew": {"type": "number", "description": "Ratio of maximum to average compute time"},
+          "steps": {"type": "array", "items": {"type": "string"}}
+        },
+        "required": ["id", "name"]
+      }
+    },
+    "timeline": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "elapsed_ms": {"type": "integer"},
+          "active_units": {"type": "integer"},
+          "pending_units": {"type": "integer"},
+          "completed_units": {"type": "integer"},
+          "slot_ms": {"type": "integer"}
+        }
+      }
+    },
+    "findings": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "rule": {"type": "string", "enum": ["missing_partition_filter", "full_scan", "cross_join", "unbounded_sort", "skew", "spill"]},
+          "stage": {"type": "integer"},
+          "message": {"type": "string"}
+        },
+        "required": ["rule", "message"]
+      }
+    }
+  },
+  "required": ["stages", "findings"]
+}`)
+)
+
+type schemaOutput struct {
+	Fields []*bigquery.FieldSchema `json:"fields"`
+}
+
+func newSchemaOutput(fields []*bigquery.FieldSchema) schemaOutput {
+	if fields == nil {
+		fields = []*bigquery.FieldSchema{}
+	}
+	return schemaOutput{Fields: fields}
+}
+
+type tablesOutput struct {
+	Tables []string `json:"tables"`
+}
+
+func newTablesOutput(tables []string) tablesOutput {
+	if tables == nil {
+		tables = []string{}
+	}
+	return tablesOutput{Tables: tables}
+}
+
+type queryOutput struct {
+	Rows       []map[string]bigquery.Value `json:"rows"`
+	RowSchema  map[string]any              `json:"row_schema"`
+	Metadata   resultMetadata              `json:"metadata"`
+	Statements []statementOutput           `json:"statements,omitempty"`
+}
+
+// statementOutput is the result of one statement of a script.
+type statementOutput struct {
+	Index              int                         `json:"index"`
+	JobID              string                      `json:"job_id"`
+	StatementType      string                      `json:"statement_type,omitempty"`
+	NumDMLAffectedRows int64                       `json:"num_dml_affected_rows,omitempty"`
+	Rows               []map[string]bigquery.Value `json:"rows,omitempty"`
+	TotalRows          int                         `json:"total_rows,omitempty"`
+	Truncated          bool                        `json:"truncated,omitempty"`
+}
+
+// newStatementOutputs converts the statement results of a script, truncating
+// the rows of each statement like those of the final result.
+func newStatementOutputs(statements []*bq.StatementResult, maxRows, budget int) []statementOutput {
+	var out []statementOutput
+	for i, st := range statements {
+		o := statementOutput{Index: i, JobID: st.JobID, StatementType: st.StatementType, NumDMLAffectedRows: st.NumDMLAffectedRows}
+		if st.Schema != nil {
+			rows, meta := truncateRows(st.Rows, 0, maxRows, budget)
+			o.Rows = rows
+			o.TotalRows = max(int(st.TotalRows), len(st.Rows))
+			o.Truncated = meta.Truncated || o.TotalRows > len(rows)
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+func newQueryOutput(schema bigquery.Schema, rows []map[string]bigquery.Value, meta resultMetadata) queryOutput {
+	if rows == nil {
+		rows = []map[string]bigquery.Value{}
+	}
+	return queryOutput{Rows: rows, RowSchema: rowJSONSchema(schema), Metadata: meta}
+}
+
+// rowJSONSchema derives a JSON Schema for result rows from a BigQuery schema.
+// Without a schema any object is accepted.
+func rowJSONSchema(schema bigquery.Schema) map[string]any {
+	return recordJSONSchema(schema, 0)
+}
+
+// recordJSONSchema returns the schema of a record whose fields are nested
+// depth levels deep.
+func recordJSONSchema(schema bigquery.Schema, depth int) map[string]any {
+	out := map[string]any{"type": "object"}
+	if len(schema) == 0 {
+		return out
+	}
+	props := make(map[string]any, len(schema))
+	var required []string
+	for _, f := range schema {
+		props[f.Name] = fieldJSONSchema(f, depth)
+		required = append(required, f.Name)
+	}
+	out["properties"] = props
+	out["required"] = required
+	return out
+}
+
+// fieldJSONSchema returns the schema of a field whose value is nested depth
+// levels deep. Records nested too deep are omitted by the truncator and
+// returned as null.
+func fieldJSONSchema(f *bigquery.FieldSchema, depth int) map[string]any {
+	if f.Repeated {
+		depth++
+	}
+	var s map[string]any
+	switch f.Type {
+	case bigquery.RecordFieldType:
+		if depth >= maxNestingDepth {
+			s = map[string]any{"type": []string{"object", "null"}}
+		} else {
+			s = recordJSONSchema(f.Schema, depth+1)
+		}
+	case bigquery.IntegerFieldType:
+		s = map[string]any{"type": "integer"}
+	case bigquery.FloatFieldType:
+		s = map[string]any{"type": "number"}
+	case bigquery.BooleanFieldType:
+		s = map[string]any{"type": "boolean"}
+	case bigquery.IntervalFieldType, bigquery.RangeFieldType:
+		s = map[string]any{}
+	default:
+		// STRING, BYTES (base64), NUMERIC, temporal types, GEOGRAPHY and
+		// JSON are all encoded as strings.
+		s = map[string]any{"type": "string"}
+	}
+	if f.Description != "" {
+		s["description"] = f.Description
+	}
+	if f.Repeated {
+		return map[string]any{"type": "array", "items": s}
+	}
+	if !f.Required {
+		if t, ok := s["type"].(string); ok {
+			s["type"] = []string{t, "null"}
+		}
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package mcp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestRowJSONSchema(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType, Description: "user name"},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "addr", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "city", Type: bigquery.StringFieldType},
+		}},
+	}
+	got, err := json.Marshal(rowJSONSchema(schema))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"properties":{"addr":{"properties":{"city":{"type":["string","null"]}},"required":["city"],"type":["object","null"]},` +
+		`"id":{"type":"integer"},"name":{"description":"user name","type":["string","null"]},` +
+		`"tags":{"items":{"type":"string"},"type":"array"}},"required":["id","name","tags","addr"],"type":"object"}`
+	if string(got) != want {
+		t.Fatalf("unexpected schema:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOutputSchemasAreObjects(t *testing.T) {
+	for name, raw := range map[string]json.RawMessage{
+		"schema":               schemaOutputSchema,
+		"tables":               tablesOutputSchema,
+		"dryrun":               dryRunOutputSchema,
+		"query":                queryOutputSchema,
+		"profile":              profileOutputSchema,
+		"search":               searchColumnsOutputSchema,
+		"explain":              explainOutputSchema,
+		"format_sql":           formatSQLOutputSchema,
+		"export":               exportOutputSchema,
+		"load":                 loadOutputSchema,
+		"create_scratch_table": scratchTableOutputSchema,
+		"list_scratch_tables":  listScratchTablesOutputSchema,
+		"context":              contextOutputSchema,
+	} {
+		var s map[string]any
+		if err := json.Unmarshal(raw, &s); err != nil {
+			t.Fatalf("%s: invalid output schema: %v", name, err)
+		}
+		if s["type"] != "object" {
+			t.Fatalf("%s: output schema type must be object, got %v", name, s["type"])
+		}
+	}
+}
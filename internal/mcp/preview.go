@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// partitionPattern matches the partition IDs accepted by a table decorator:
+// YYYY, YYYYMM, YYYYMMDD or YYYYMMDDHH, or one of the special partitions.
+var partitionPattern = regexp.MustCompile(`^(\d{4}(\d{2}(\d{2}(\d{2})?)?)?|__NULL__|__UNPARTITIONED__)$`)
+
+type previewArgs struct {
+	DatasetProject string   `json:"dataset_project,omitempty"`
+	Dataset        string   `json:"dataset"`
+	Table          string   `json:"table"`
+	Fields         []string `json:"fields,omitempty"`
+	Partition      string   `json:"partition,omitempty"`
+	resultArgs
+}
+
+// previewHandler returns rows read directly from table storage. Unlike a
+// SELECT ... LIMIT query this runs no job and is not billed.
+func (s *Server) previewHandler(ctx context.Context, _ mcp.CallToolRequest, args previewArgs) (*mcp.CallToolResult, error) {
+	format, start, maxRows, err := s.page(args.resultArgs)
+	if err != nil {
+		return nil, err
+	}
+	if s.tableFilter != nil && !s.tableFilter.MatchString(args.Table) {
+		return nil, fmt.Errorf("table %q is not allowed by the table filter", args.Table)
+	}
+	table := args.Table
+	if args.Partition != "" {
+		if !partitionPattern.MatchString(args.Partition) {
+			return nil, fmt.Errorf("invalid partition %q: expected YYYY, YYYYMM, YYYYMMDD, YYYYMMDDHH, __NULL__ or __UNPARTITIONED__", args.Partition)
+		}
+		table += "$" + args.Partition
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	dp, dataset, err := s.resolveDataset(ctx, args.DatasetProject, args.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.ReadTable(ctx, dp, dataset, table, bigquery.ReadOptions{
+		StartIndex: uint64(start),
+		MaxRows:    maxRows,
+		Fields:     args.Fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Table schemas carry their policy tags.
+	red := s.newRedactor(nil)
+	schema, rows := red.result(res.Schema, res.Rows)
+	rows, meta := truncateRows(rows, 0, maxRows, s.budget(args.resultArgs))
+	meta = pageMetadata(meta, start, int(res.TotalRows))
+	meta.RedactedColumns = red.columnsRedacted()
+	text, err := encodeRows(format, schema, rows)
+	if err != nil {
+		return nil, err
+	}
+	metaData, _ := json.Marshal(meta)
+	result := mcp.NewToolResultStructured(newQueryOutput(schema, rows, meta), text)
+	result.Content = append(result.Content, mcp.NewTextContent(string(metaData)))
+	return result, nil
+}
+
+// pageMetadata rebases metadata computed over a page of rows read from
+// offset start onto a table of total rows.
+func pageMetadata(meta resultMetadata, start, total int) resultMetadata {
+	meta.StartRow = start
+	meta.TotalRows = max(total, start+meta.RowsReturned)
+	meta.paginate()
+	return meta
+}
@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+type readRecorder struct {
+	*bq.MockClient
+	table string
+	opts  bq.ReadOptions
+}
+
+func (r *readRecorder) ReadTable(ctx context.Context, projectID, datasetID, tableID string, opts bq.ReadOptions) (*bq.QueryResult, error) {
+	r.table = projectID + "." + datasetID + "." + tableID
+	r.opts = opts
+	return r.MockClient.ReadTable(ctx, projectID, datasetID, tableID, opts)
+}
+
+func TestPreviewHandler(t *testing.T) {
+	rec := &readRecorder{MockClient: &bq.MockClient{ReadRes: &bq.QueryResult{
+		Schema:    bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}},
+		Rows:      []map[string]bigquery.Value{{"id": "10"}, {"id": "11"}},
+		TotalRows: 50,
+	}}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p")
+
+	res, err := srv.previewHandler(context.Background(), mcp.CallToolRequest{}, previewArgs{
+		Dataset: "d", Table: "events", Fields: []string{"id"}, Partition: "20240101",
+		resultArgs: resultArgs{Format: "csv", StartRow: 10, MaxRows: 2},
+	})
+	if err != nil {
+		t.Fatalf("previewHandler error: %v", err)
+	}
+	if rec.table != "p.d.events$20240101" || rec.opts.StartIndex != 10 || rec.opts.MaxRows != 2 || len(rec.opts.Fields) != 1 {
+		t.Fatalf("unexpected read: %s %+v", rec.table, rec.opts)
+	}
+	tc, _ := mcp.AsTextContent(res.Content[0])
+	if tc.Text != "id\n10\n11\n" {
+		t.Fatalf("unexpected csv: %q", tc.Text)
+	}
+	mc, _ := mcp.AsTextContent(res.Content[1])
+	var meta resultMetadata
+	if err := json.Unmarshal([]byte(mc.Text), &meta); err != nil {
+		t.Fatalf("invalid metadata json: %v", err)
+	}
+	if meta.TotalRows != 50 || meta.StartRow != 10 || meta.RowsReturned != 2 || meta.NextStartRow != 12 || !meta.Truncated {
+		t.Fatalf("unexpected metadata: %#v", meta)
+	}
+}
+
+func TestPreviewHandlerRejects(t *testing.T) {
+	mock := &bq.MockClient{ReadRes: &bq.QueryResult{}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithTableFilter(regexp.MustCompile("^pub_")))
+
+	if _, err := srv.previewHandler(context.Background(), mcp.CallToolRequest{}, previewArgs{Dataset: "d", Table: "secret"}); err == nil {
+		t.Fatal("expected table filter to reject the table")
+	}
+	if _, err := srv.previewHandler(context.Background(), mcp.CallToolRequest{}, previewArgs{Dataset: "d", Table: "pub_t", Partition: "2024-01-01"}); err == nil {
+		t.Fatal("expected invalid partition to be rejected")
+	}
+	if _, err := srv.previewHandler(context.Background(), mcp.CallToolRequest{}, previewArgs{Dataset: "d", Table: "pub_t", Partition: "__NULL__"}); err != nil {
+		t.Fatalf("previewHandler error: %v", err)
+	}
+}
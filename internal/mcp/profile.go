@@ -0,0 +1,336 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqltoken"
+)
+
+const (
+	// maxProfileColumns bounds the number of columns profiled by one query.
+	maxProfileColumns = 50
+	// defaultTopK is the number of most frequent values reported per column.
+	defaultTopK = 5
+	maxTopK     = 20
+)
+
+type profileArgs struct {
+	DatasetProject string   `json:"dataset_project,omitempty"`
+	Dataset        string   `json:"dataset"`
+	Table          string   `json:"table"`
+	Columns        []string `json:"columns,omitempty"`
+	Filter         string   `json:"filter,omitempty"`
+	SamplePercent  float64  `json:"sample_percent,omitempty"`
+	TopK           int      `json:"top_k,omitempty"`
+}
+
+// columnProfile summarizes the values of one column. Statistics that do not
+// apply to the column type are omitted.
+type columnProfile struct {
+	Name         string         `json:"name"`
+	Type         string         `json:"type"`
+	Repeated     bool           `json:"repeated,omitempty"`
+	Nulls        int64          `json:"nulls"`
+	NullFraction float64        `json:"null_fraction"`
+	Distinct     *int64         `json:"approx_distinct,omitempty"`
+	Min          bigquery.Value `json:"min,omitempty"`
+	Max          bigquery.Value `json:"max,omitempty"`
+	Top          []topValue     `json:"top_values,omitempty"`
+	MinLength    *int64         `json:"min_length,omitempty"`
+	MaxLength    *int64         `json:"max_length,omitempty"`
+	AvgLength    *float64       `json:"avg_length,omitempty"`
+}
+
+type topValue struct {
+	Value bigquery.Value `json:"value"`
+	Count int64          `json:"count"`
+}
+
+type profileOutput struct {
+	Table           string          `json:"table"`
+	RowCount        int64           `json:"row_count"`
+	SamplePercent   float64         `json:"sample_percent,omitempty"`
+	BytesProcessed  int64           `json:"estimated_bytes_processed"`
+	Columns         []columnProfile `json:"columns"`
+	RedactedColumns []string        `json:"redacted_columns,omitempty"`
+	SQL             string          `json:"sql"`
+}
+
+// profileColumn is a column selected for profiling together with the alias
+// prefix of its statistics in the profile query.
+type profileColumn struct {
+	field *bigquery.FieldSchema
+	alias string
+}
+
+// profileHandler computes per-column statistics of a table with a single
+// query. The query is dry run first; when MAX_BQ_QUERY_BYTES would be
+// exceeded and no sample was requested, the table is sampled with
+// TABLESAMPLE so that the estimated scan fits the limit.
+func (s *Server) profileHandler(ctx context.Context, _ mcp.CallToolRequest, args profileArgs) (*mcp.CallToolResult, error) {
+	if s.tableFilter != nil && !s.tableFilter.MatchString(args.Table) {
+		return nil, fmt.Errorf("table %q is not allowed by the table filter", args.Table)
+	}
+	if args.SamplePercent < 0 || args.SamplePercent > 100 {
+		return nil, fmt.Errorf("sample_percent must be between 0 and 100")
+	}
+	if err := checkFilter(args.Filter); err != nil {
+		return nil, err
+	}
+	topK := args.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	if topK > maxTopK {
+		topK = maxTopK
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	dp, dataset, err := s.resolveDataset(ctx, args.DatasetProject, args.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := c.GetTableSchema(ctx, dp, dataset, args.Table)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := profileColumns(schema, args.Columns)
+	if err != nil {
+		return nil, err
+	}
+	table := fmt.Sprintf("%s.%s.%s", dp, dataset, args.Table)
+
+	sample := args.SamplePercent
+	sql := profileSQL(table, cols, args.Filter, sample, topK)
+	ctx = s.queryContext(ctx, "profile")
+	stats, err := c.DryRunQuery(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	if stats.StatementType != "SELECT" {
+		return nil, fmt.Errorf("profile query is a %s statement, not a SELECT; check the filter", stats.StatementType)
+	}
+	// Dry runs report the bytes of a full scan for sampled queries;
+	// sampling reads roughly the requested share of storage blocks.
+	estimate := sampledBytes(stats.TotalBytesProcessed, sample)
+	if limit := maxQueryBytes(); limit > 0 && estimate > limit {
+		if sample > 0 {
+			return nil, fmt.Errorf("profile query would scan %d bytes (limit %d); lower sample_percent or add a filter", estimate, limit)
+		}
+		// Round down to two decimals so that the sampled scan stays below
+		// the limit.
+		sample = math.Floor(float64(limit)/float64(estimate)*100*100) / 100
+		if sample <= 0 {
+			return nil, fmt.Errorf("profile query would scan %d bytes (limit %d) even when sampled; add a filter", estimate, limit)
+		}
+		sql = profileSQL(table, cols, args.Filter, sample, topK)
+		stats, err := c.DryRunQuery(ctx, sql)
+		if err != nil {
+			return nil, err
+		}
+		if estimate = sampledBytes(stats.TotalBytesProcessed, sample); estimate > limit {
+			return nil, fmt.Errorf("profile query would scan %d bytes (limit %d) even when sampled; add a filter", estimate, limit)
+		}
+	}
+
+	res, err := c.RunQuery(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Rows) != 1 {
+		return nil, fmt.Errorf("profile query returned %d rows, expected 1", len(res.Rows))
+	}
+	out := newProfileOutput(res.Rows[0], cols)
+	out.Table = table
+	out.SamplePercent = sample
+	out.BytesProcessed = estimate
+	out.SQL = sql
+	s.newRedactor(nil).profile(schema, out)
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+// sampledBytes estimates the bytes scanned by a query sampling percent of
+// a table whose full scan reads bytes. A zero percent means no sampling.
+func sampledBytes(bytes int64, percent float64) int64 {
+	if percent <= 0 {
+		return bytes
+	}
+	return int64(float64(bytes) * percent / 100)
+}
+
+// profileColumns selects the top-level columns to profile, in schema order
+// when names is empty and in the requested order otherwise.
+func profileColumns(schema bigquery.Schema, names []string) ([]profileColumn, error) {
+	var fields []*bigquery.FieldSchema
+	if len(names) == 0 {
+		fields = schema
+	} else {
+		byName := make(map[string]*bigquery.FieldSchema, len(schema))
+		for _, f := range schema {
+			byName[strings.ToLower(f.Name)] = f
+		}
+		for _, name := range names {
+			f, ok := byName[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q", name)
+			}
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) > maxProfileColumns {
+		return nil, fmt.Errorf("table has %d columns; select at most %d with the columns argument", len(fields), maxProfileColumns)
+	}
+	cols := make([]profileColumn, len(fields))
+	for i, f := range fields {
+		cols[i] = profileColumn{field: f, alias: "c" + strconv.Itoa(i)}
+	}
+	return cols, nil
+}
+
+// checkFilter rejects filters that could change the shape of the profile
+// query rather than restrict its rows: statement separators, comments that
+// could hide the rest of the query and unbalanced parentheses that would
+// close the group the filter is placed in.
+func checkFilter(filter string) error {
+	depth := 0
+	for _, t := range sqltoken.Tokenize(filter) {
+		switch {
+		case t.Kind == sqltoken.Comment:
+			return fmt.Errorf("filter must not contain comments")
+		case t.Text == ";":
+			return fmt.Errorf("filter must be a single expression without ';'")
+		case t.Text == "(":
+			depth++
+		case t.Text == ")":
+			if depth--; depth < 0 {
+				return fmt.Errorf("filter has unbalanced parentheses")
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("filter has unbalanced parentheses")
+	}
+	return nil
+}
+
+// groupable reports whether values of t can be counted distinctly, ranked
+// by frequency and ordered for MIN and MAX.
+func groupable(t bigquery.FieldType) bool {
+	switch t {
+	case bigquery.StringFieldType, bigquery.BytesFieldType, bigquery.IntegerFieldType,
+		bigquery.FloatFieldType, bigquery.BooleanFieldType, bigquery.TimestampFieldType,
+		bigquery.DateFieldType, bigquery.TimeFieldType, bigquery.DateTimeFieldType,
+		bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		return true
+	}
+	return false
+}
+
+// profileSQL builds the single-row profile query. Repeated columns are only
+// checked for empty arrays; other columns get null counts and, where the
+// type allows, distinct counts, min/max, top values and string lengths.
+func profileSQL(table string, cols []profileColumn, filter string, samplePercent float64, topK int) string {
+	exprs := []string{"COUNT(*) AS row_count"}
+	for _, col := range cols {
+		name := "`" + col.field.Name + "`"
+		a := col.alias
+		if col.field.Repeated {
+			exprs = append(exprs, fmt.Sprintf("COUNTIF(ARRAY_LENGTH(%s) = 0) AS %s_nulls", name, a))
+			continue
+		}
+		exprs = append(exprs, fmt.Sprintf("COUNTIF(%s IS NULL) AS %s_nulls", name, a))
+		if !groupable(col.field.Type) {
+			continue
+		}
+		exprs = append(exprs,
+			fmt.Sprintf("APPROX_COUNT_DISTINCT(%s) AS %s_distinct", name, a),
+			fmt.Sprintf("MIN(%s) AS %s_min", name, a),
+			fmt.Sprintf("MAX(%s) AS %s_max", name, a),
+			fmt.Sprintf("APPROX_TOP_COUNT(%s, %d) AS %s_top", name, topK, a),
+		)
+		if col.field.Type == bigquery.StringFieldType {
+			exprs = append(exprs,
+				fmt.Sprintf("MIN(LENGTH(%s)) AS %s_min_length", name, a),
+				fmt.Sprintf("MAX(LENGTH(%s)) AS %s_max_length", name, a),
+				fmt.Sprintf("AVG(LENGTH(%s)) AS %s_avg_length", name, a),
+			)
+		}
+	}
+	var b strings.Builder
+	b.WriteString("SELECT\n  ")
+	b.WriteString(strings.Join(exprs, ",\n  "))
+	fmt.Fprintf(&b, "\nFROM `%s`", table)
+	if samplePercent > 0 && samplePercent < 100 {
+		fmt.Fprintf(&b, " TABLESAMPLE SYSTEM (%s PERCENT)", strconv.FormatFloat(samplePercent, 'f', -1, 64))
+	}
+	if filter != "" {
+		fmt.Fprintf(&b, "\nWHERE (%s)", filter)
+	}
+	return b.String()
+}
+
+// newProfileOutput converts the profile query row into a report.
+func newProfileOutput(row map[string]bigquery.Value, cols []profileColumn) *profileOutput {
+	out := &profileOutput{RowCount: int64Value(row["row_count"]), Columns: []columnProfile{}}
+	for _, col := range cols {
+		a := col.alias
+		p := columnProfile{
+			Name:     col.field.Name,
+			Type:     string(col.field.Type),
+			Repeated: col.field.Repeated,
+			Nulls:    int64Value(row[a+"_nulls"]),
+			Min:      row[a+"_min"],
+			Max:      row[a+"_max"],
+		}
+		if out.RowCount > 0 {
+			p.NullFraction = float64(p.Nulls) / float64(out.RowCount)
+		}
+		if v, ok := row[a+"_distinct"]; ok {
+			n := int64Value(v)
+			p.Distinct = &n
+		}
+		if top, ok := row[a+"_top"].([]bigquery.Value); ok {
+			for _, e := range top {
+				if m, ok := e.(map[string]bigquery.Value); ok {
+					p.Top = append(p.Top, topValue{Value: m["value"], Count: int64Value(m["count"])})
+				}
+			}
+		}
+		if v, ok := row[a+"_min_length"]; ok && v != nil {
+			n := int64Value(v)
+			p.MinLength = &n
+		}
+		if v, ok := row[a+"_max_length"]; ok && v != nil {
+			n := int64Value(v)
+			p.MaxLength = &n
+		}
+		if v, ok := row[a+"_avg_length"].(float64); ok {
+			p.AvgLength = &v
+		}
+		out.Columns = append(out.Columns, p)
+	}
+	return out
+}
+
+func int64Value(v bigquery.Value) int64 {
+	switch x := v.(type) {
+	case int64:
+		return x
+	case int:
+		return int64(x)
+	case float64:
+		return int64(x)
+	}
+	return 0
+}
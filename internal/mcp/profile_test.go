@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+type sqlRecorder struct {
+	*bq.MockClient
+	dryRuns []string
+	queries []string
+}
+
+func (r *sqlRecorder) DryRunQuery(ctx context.Context, sql string) (*bigquery.QueryStatistics, error) {
+	r.dryRuns = append(r.dryRuns, sql)
+	return r.MockClient.DryRunQuery(ctx, sql)
+}
+
+func (r *sqlRecorder) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	r.queries = append(r.queries, sql)
+	return r.MockClient.RunQuery(ctx, sql)
+}
+
+func newProfileMock() *sqlRecorder {
+	return &sqlRecorder{MockClient: &bq.MockClient{
+		SchemaRes: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+			{Name: "loc", Type: bigquery.GeographyFieldType},
+		},
+		DryRunRes: &bigquery.QueryStatistics{StatementType: "SELECT", TotalBytesProcessed: 1000},
+		QueryRes: []map[string]bigquery.Value{{
+			"row_count": int64(10), "c0_nulls": int64(2), "c0_distinct": int64(3), "c0_min": "a", "c0_max": "c",
+			"c0_top":        []bigquery.Value{map[string]bigquery.Value{"value": "a", "count": int64(5)}},
+			"c0_min_length": int64(1), "c0_max_length": int64(1), "c0_avg_length": 1.0,
+			"c1_nulls": int64(4), "c2_nulls": int64(0),
+		}},
+	}}
+}
+
+func TestProfileHandler(t *testing.T) {
+	rec := newProfileMock()
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p")
+
+	res, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", Filter: "dt = '2024-01-01'"})
+	if err != nil {
+		t.Fatalf("profileHandler error: %v", err)
+	}
+	if len(rec.dryRuns) != 1 || len(rec.queries) != 1 || rec.dryRuns[0] != rec.queries[0] {
+		t.Fatalf("expected one dry-run-checked query, got %v %v", rec.dryRuns, rec.queries)
+	}
+	sql := rec.queries[0]
+	for _, want := range []string{"APPROX_COUNT_DISTINCT(`name`)", "APPROX_TOP_COUNT(`name`, 5)", "AVG(LENGTH(`name`))",
+		"COUNTIF(ARRAY_LENGTH(`tags`) = 0)", "COUNTIF(`loc` IS NULL)", "FROM `p.d.t`", "WHERE (dt = '2024-01-01')"} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("profile SQL missing %q:\n%s", want, sql)
+		}
+	}
+	if strings.Contains(sql, "MIN(`loc`)") || strings.Contains(sql, "TABLESAMPLE") {
+		t.Fatalf("unexpected profile SQL:\n%s", sql)
+	}
+	out := res.StructuredContent.(*profileOutput)
+	name := out.Columns[0]
+	if out.RowCount != 10 || name.Nulls != 2 || name.NullFraction != 0.2 || *name.Distinct != 3 || name.Min != "a" ||
+		len(name.Top) != 1 || name.Top[0].Count != 5 || *name.AvgLength != 1.0 {
+		t.Fatalf("unexpected profile: %+v %+v", out, name)
+	}
+	if tags := out.Columns[1]; !tags.Repeated || tags.Nulls != 4 || tags.Distinct != nil {
+		t.Fatalf("unexpected repeated column profile: %+v", tags)
+	}
+}
+
+func TestProfileHandlerSampling(t *testing.T) {
+	t.Setenv("MAX_BQ_QUERY_BYTES", "250")
+	rec := newProfileMock()
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p")
+
+	res, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", Columns: []string{"NAME"}})
+	if err != nil {
+		t.Fatalf("profileHandler error: %v", err)
+	}
+	if !strings.Contains(rec.queries[0], "TABLESAMPLE SYSTEM (25 PERCENT)") {
+		t.Fatalf("expected sampled query:\n%s", rec.queries[0])
+	}
+	out := res.StructuredContent.(*profileOutput)
+	if out.SamplePercent != 25 || out.BytesProcessed != 250 || len(out.Columns) != 1 {
+		t.Fatalf("unexpected profile: %+v", out)
+	}
+
+	if _, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", SamplePercent: 50}); err == nil {
+		t.Fatal("expected explicit sample exceeding the limit to be rejected")
+	}
+	res, err = srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", SamplePercent: 20})
+	if err != nil {
+		t.Fatalf("expected explicit sample within the limit to run: %v", err)
+	}
+	if out := res.StructuredContent.(*profileOutput); out.BytesProcessed != 200 {
+		t.Fatalf("expected sampled estimate, got %d", out.BytesProcessed)
+	}
+	if _, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", Columns: []string{"missing"}}); err == nil {
+		t.Fatal("expected unknown column to be rejected")
+	}
+}
+
+func TestProfileHandlerTableFilter(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return newProfileMock(), nil }, "p", WithTableFilter(regexp.MustCompile("^pub_")))
+	if _, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t"}); err == nil {
+		t.Fatal("expected table filter to reject the table")
+	}
+}
+
+func TestProfileHandlerFilter(t *testing.T) {
+	rec := newProfileMock()
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p")
+	for _, filter := range []string{
+		"x = 1; DROP TABLE d.t",
+		"x = 1 -- ignore",
+		"x = 1 /* note */",
+		"x = 1) UNION ALL SELECT * FROM d.other WHERE (true",
+		"(x = 1",
+	} {
+		if _, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", Filter: filter}); err == nil {
+			t.Errorf("filter %q accepted", filter)
+		}
+	}
+	if len(rec.dryRuns) != 0 {
+		t.Errorf("rejected filters were dry run: %v", rec.dryRuns)
+	}
+	if _, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t", Filter: "name IN ('a;b', '(')"}); err != nil {
+		t.Errorf("filter with literals rejected: %v", err)
+	}
+
+	rec.DryRunRes = &bigquery.QueryStatistics{StatementType: "SCRIPT"}
+	_, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "t"})
+	if err == nil || !strings.Contains(err.Error(), "not a SELECT") {
+		t.Errorf("expected statement type error, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultPromptTemplates holds the built-in prompt texts. Each can be
+// overridden by a <name>.tmpl file in the prompts directory. Templates are
+// rendered with text/template; prompt arguments are available by name, along
+// with "project" (the effective dataset project) and, for optimize_query,
+// "dry_run" (the dry run statistics as JSON) or "dry_run_error".
+var defaultPromptTemplates = map[string]string{
+	"explore_table": `Explore the BigQuery table {{.project}}.{{.dataset}}.{{.table}} and summarize what it contains.
+
+1. Read the table schema with the "schema" tool (dataset_project={{.project}}, dataset={{.dataset}}, table={{.table}}) or the resource bigquery://{{.project}}/{{.dataset}}/{{.table}}.
+2. Look at a small sample of rows with the "query" tool, selecting only the columns you need and adding a LIMIT. Use "dryrun" first to check how many bytes the query scans.
+3. Profile the important columns: null counts, APPROX_COUNT_DISTINCT, MIN/MAX for numeric and temporal columns, and APPROX_TOP_COUNT for low-cardinality columns.
+{{- if .column}} Pay particular attention to the column {{.column}}.{{end}}
+4. Report the grain of the table, likely primary keys, partitioning or date columns, and any data quality issues you noticed.`,
+
+	"write_query": `Answer the following question with BigQuery SQL against dataset {{.project}}.{{.dataset}}:
+
+{{.question}}
+
+Work step by step:
+1. Call "tables" (dataset_project={{.project}}, dataset={{.dataset}}) to find candidate tables.
+2. Call "schema" for each relevant table to learn column names, types and nesting.
+3. Draft a GoogleSQL query using fully qualified table names in backticks, selecting only the columns you need and filtering on partition columns where possible.
+4. Call "dryrun" to validate the query and check the estimated bytes processed; revise it if it fails or scans more data than necessary.
+5. Call "query" to run it and answer the question from the results.`,
+
+	"optimize_query": `Review the following BigQuery SQL for cost and performance:
+
+{{.sql}}
+{{if .dry_run}}
+Dry run statistics:
+{{.dry_run}}
+{{else if .dry_run_error}}
+The dry run failed: {{.dry_run_error}}
+{{end}}
+Suggest concrete improvements, for example: selecting fewer columns instead of SELECT *, adding partition and cluster filters, filtering before joins, avoiding CROSS JOINs and unbounded ORDER BY, and replacing exact COUNT(DISTINCT) with APPROX_COUNT_DISTINCT where acceptable. Validate each rewritten query with "dryrun" and compare the bytes processed.`,
+}
+
+// WithPromptsDir sets a directory containing <prompt>.tmpl files that
+// override the built-in prompt templates.
+func WithPromptsDir(dir string) Option {
+	return func(s *Server) {
+		s.promptsDir = dir
+	}
+}
+
+func (s *Server) registerPrompts() {
+	s.mcpServer.AddPrompt(mcp.NewPrompt(
+		"explore_table",
+		mcp.WithPromptDescription("Explore a table: schema, sample rows and column profile"),
+		mcp.WithArgument("dataset_project", mcp.ArgumentDescription("Project of the dataset; defaults to the client project")),
+		mcp.WithArgument("dataset", mcp.RequiredArgument()),
+		mcp.WithArgument("table", mcp.RequiredArgument()),
+		mcp.WithArgument("column", mcp.ArgumentDescription("Optional column to focus the profile on")),
+	), s.promptHandler)
+
+	s.mcpServer.AddPrompt(mcp.NewPrompt(
+		"write_query",
+		mcp.WithPromptDescription("Write and validate a query answering a question about a dataset"),
+		mcp.WithArgument("question", mcp.RequiredArgument(), mcp.ArgumentDescription("Question to answer")),
+		mcp.WithArgument("dataset_project", mcp.ArgumentDescription("Project of the dataset; defaults to the client project")),
+		mcp.WithArgument("dataset", mcp.RequiredArgument()),
+	), s.promptHandler)
+
+	s.mcpServer.AddPrompt(mcp.NewPrompt(
+		"optimize_query",
+		mcp.WithPromptDescription("Review a query using its dry run statistics and suggest optimizations"),
+		mcp.WithArgument("sql", mcp.RequiredArgument()),
+	), s.promptHandler)
+}
+
+func (s *Server) promptHandler(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	name := req.Params.Name
+	prompt := s.mcpServer.ListPrompts()[name]
+	if prompt == nil {
+		return nil, fmt.Errorf("unknown prompt %q", name)
+	}
+	data := map[string]any{}
+	for _, arg := range prompt.Prompt.Arguments {
+		data[arg.Name] = ""
+	}
+	for k, v := range req.Params.Arguments {
+		data[k] = v
+	}
+	project := req.Params.Arguments["dataset_project"]
+	if project == "" {
+		project = s.clientProject
+	}
+	data["project"] = project
+
+	if name == "optimize_query" {
+		data["dry_run"] = ""
+		data["dry_run_error"] = ""
+		if sql := req.Params.Arguments["sql"]; sql != "" {
+			c, err := s.bqClientProvider(ctx, s.clientProject)
+			if err != nil {
+				return nil, err
+			}
+			if stats, err := c.DryRunQuery(ctx, sql); err != nil {
+				data["dry_run_error"] = err.Error()
+			} else {
+				b, _ := json.MarshalIndent(stats, "", "  ")
+				data["dry_run"] = string(b)
+			}
+		}
+	}
+
+	text, err := s.renderPrompt(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewGetPromptResult(prompt.Prompt.Description, []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+	}), nil
+}
+
+// renderPrompt renders the template for name, preferring an override from
+// the prompts directory.
+func (s *Server) renderPrompt(name string, data map[string]any) (string, error) {
+	src, ok := defaultPromptTemplates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt %q", name)
+	}
+	if s.promptsDir != "" {
+		b, err := os.ReadFile(filepath.Join(s.promptsDir, name+".tmpl"))
+		switch {
+		case err == nil:
+			src = string(b)
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", err
+		}
+	}
+	tmpl, err := template.New(name).Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("parse prompt %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render prompt %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
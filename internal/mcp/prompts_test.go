@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func getPromptText(t *testing.T, srv *Server, name string, args map[string]string) string {
+	t.Helper()
+	req := mcp.GetPromptRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+	res, err := srv.promptHandler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("promptHandler(%s) error: %v", name, err)
+	}
+	if len(res.Messages) != 1 {
+		t.Fatalf("unexpected messages: %#v", res.Messages)
+	}
+	tc, ok := res.Messages[0].Content.(mcp.TextContent)
+	if !ok {
+		t.Fatalf("unexpected content: %#v", res.Messages[0].Content)
+	}
+	return tc.Text
+}
+
+func TestPromptsRegistered(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p")
+	prompts := srv.MCPServer().ListPrompts()
+	for _, name := range []string{"explore_table", "write_query", "optimize_query"} {
+		if prompts[name] == nil {
+			t.Fatalf("prompt %s not registered", name)
+		}
+	}
+}
+
+func TestWriteQueryPrompt(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p")
+	text := getPromptText(t, srv, "write_query", map[string]string{"question": "How many users?", "dataset": "d"})
+	if !strings.Contains(text, "How many users?") || !strings.Contains(text, "dataset p.d") {
+		t.Fatalf("unexpected prompt: %s", text)
+	}
+}
+
+func TestOptimizeQueryPromptIncludesDryRun(t *testing.T) {
+	mock := &bq.MockClient{DryRunRes: &bigquery.QueryStatistics{TotalBytesProcessed: 98765}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+	text := getPromptText(t, srv, "optimize_query", map[string]string{"sql": "SELECT * FROM t"})
+	if !strings.Contains(text, "98765") {
+		t.Fatalf("expected dry run statistics in prompt: %s", text)
+	}
+
+	mock.Err = errors.New("syntax error")
+	text = getPromptText(t, srv, "optimize_query", map[string]string{"sql": "SELEC"})
+	if !strings.Contains(text, "The dry run failed: syntax error") {
+		t.Fatalf("expected dry run error in prompt: %s", text)
+	}
+}
+
+func TestPromptOverrideFromDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "explore_table.tmpl"), []byte("custom {{.dataset}}/{{.table}} in {{.project}}"), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p", WithPromptsDir(dir))
+	text := getPromptText(t, srv, "explore_table", map[string]string{"dataset": "d", "table": "t"})
+	if text != "custom d/t in p" {
+		t.Fatalf("unexpected override: %q", text)
+	}
+	text = getPromptText(t, srv, "write_query", map[string]string{"question": "q", "dataset": "d"})
+	if !strings.Contains(text, `Call "tables"`) {
+		t.Fatalf("expected built-in template without override: %s", text)
+	}
+}
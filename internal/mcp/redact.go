@@ -0,0 +1,414 @@
+package mcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// Redaction modes.
+const (
+	redactMask = "mask"
+	redactHash = "hash"
+	redactDrop = "drop"
+)
+
+// redactedValue replaces masked values.
+const redactedValue = "[REDACTED]"
+
+// valueDetectors find personal data in string values. Matches of
+// credit_card must also pass the Luhn check.
+var valueDetectors = map[string]*regexp.Regexp{
+	"email":       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	"phone":       regexp.MustCompile(`(\+\d{1,3}[ .-]?)?(\(\d{1,4}\)[ .-]?)?\b\d{2,4}[ .-]\d{3,4}[ .-]\d{3,4}\b|\+\d{8,15}\b`),
+	"credit_card": regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+}
+
+// RedactionConfig configures the redaction of personal data in the rows
+// returned by the query tools and preview, and in the values reported by
+// profile. Columns whose name or dotted
+// path matches a pattern of Columns, or that carry a policy tag whose
+// resource name matches a pattern of PolicyTags, are redacted as a whole;
+// in other string values, the matches of the Values detectors are. Mode is
+// mask, hash or drop. Hashes are keyed with HashKey, or with a random key
+// chosen at startup when it is empty.
+type RedactionConfig struct {
+	Columns    []*regexp.Regexp
+	PolicyTags []*regexp.Regexp
+	Values     []string
+	Mode       string
+	HashKey    string
+}
+
+func (c RedactionConfig) enabled() bool {
+	return len(c.Columns) > 0 || len(c.PolicyTags) > 0 || len(c.Values) > 0
+}
+
+// WithRedaction enables the redaction of query, preview and profile results.
+func WithRedaction(cfg RedactionConfig) Option {
+	return func(s *Server) {
+		if cfg.Mode == "" {
+			cfg.Mode = redactMask
+		}
+		s.redaction = cfg
+		s.redactionKey = []byte(cfg.HashKey)
+		if len(s.redactionKey) == 0 {
+			s.redactionKey = make([]byte, 32)
+			rand.Read(s.redactionKey)
+		}
+	}
+}
+
+// ParseRedactionMode validates a redaction mode.
+func ParseRedactionMode(mode string) (string, error) {
+	switch mode {
+	case redactMask, redactHash, redactDrop:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown redaction mode %q: use mask, hash or drop", mode)
+}
+
+// ParseRedactionPatterns parses a comma separated list of regular
+// expressions, matched case-insensitively.
+func ParseRedactionPatterns(list string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// ParseValueDetectors parses a comma separated list of value detectors:
+// email, phone and credit_card.
+func ParseValueDetectors(list string) ([]string, error) {
+	var names []string
+	for _, n := range strings.Split(list, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if valueDetectors[n] == nil {
+			return nil, fmt.Errorf("unknown value detector %q: use email, phone or credit_card", n)
+		}
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+// redactor redacts the rows of one result.
+type redactor struct {
+	cfg       RedactionConfig
+	key       []byte
+	detectors []*regexp.Regexp
+	// tagged holds the lower-cased paths of the columns carrying a
+	// matching policy tag.
+	tagged   map[string]bool
+	columns  map[string]bool // decisions of matchColumn
+	redacted map[string]bool // paths reported in redacted_columns
+}
+
+// newRedactor returns the redactor of a tool call, or nil when redaction is
+// disabled. tagged lists the lower-cased names of columns known to carry a
+// matching policy tag in addition to those tagged in the result schemas.
+func (s *Server) newRedactor(tagged map[string]bool) *redactor {
+	if !s.redaction.enabled() {
+		return nil
+	}
+	r := &redactor{
+		cfg:      s.redaction,
+		key:      s.redactionKey,
+		tagged:   make(map[string]bool),
+		columns:  make(map[string]bool),
+		redacted: make(map[string]bool),
+	}
+	for _, name := range s.redaction.Values {
+		r.detectors = append(r.detectors, valueDetectors[name])
+	}
+	for name := range tagged {
+		r.tagged[name] = true
+	}
+	return r
+}
+
+// matchesPolicyTag reports whether f carries a policy tag matching the
+// configuration.
+func (c RedactionConfig) matchesPolicyTag(f *bigquery.FieldSchema) bool {
+	if f.PolicyTags == nil {
+		return false
+	}
+	for _, tag := range f.PolicyTags.Names {
+		for _, re := range c.PolicyTags {
+			if re.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyTaggedColumns returns the lower-cased names of the columns of the
+// tables referenced by a query that carry a matching policy tag. Query
+// results do not carry the policy tags of their source columns, so result
+// columns are matched to them by name. A table whose schema cannot be read
+// fails the call, as its tagged columns would otherwise be returned in the
+// clear.
+func (s *Server) policyTaggedColumns(ctx context.Context, c bq.Client, tables []*bigquery.Table) (map[string]bool, error) {
+	if len(s.redaction.PolicyTags) == 0 {
+		return nil, nil
+	}
+	tagged := make(map[string]bool)
+	for _, t := range tables {
+		schema, err := c.GetTableSchema(ctx, t.ProjectID, t.DatasetID, t.TableID)
+		if err != nil {
+			return nil, fmt.Errorf("read policy tags of %s.%s.%s: %w", t.ProjectID, t.DatasetID, t.TableID, err)
+		}
+		walkFields(schema, "", func(path string, f *bigquery.FieldSchema) {
+			if s.redaction.matchesPolicyTag(f) {
+				tagged[strings.ToLower(path)] = true
+				tagged[strings.ToLower(f.Name)] = true
+			}
+		})
+	}
+	return tagged, nil
+}
+
+// matchColumn reports whether the column at path is redacted as a whole.
+func (r *redactor) matchColumn(path string) bool {
+	if v, ok := r.columns[path]; ok {
+		return v
+	}
+	name := path[strings.LastIndex(path, ".")+1:]
+	match := r.tagged[strings.ToLower(path)] || r.tagged[strings.ToLower(name)]
+	for _, re := range r.cfg.Columns {
+		if match {
+			break
+		}
+		match = re.MatchString(path) || re.MatchString(name)
+	}
+	r.columns[path] = match
+	return match
+}
+
+// result redacts a result. The returned schema describes the redacted
+// rows: dropped columns are removed and masked or hashed columns become
+// STRING. rows is left untouched, as it may be shared with a cache.
+func (r *redactor) result(schema bigquery.Schema, rows []map[string]bigquery.Value) (bigquery.Schema, []map[string]bigquery.Value) {
+	if r == nil {
+		return schema, rows
+	}
+	r.tag(schema)
+	schema = r.schema(schema, "")
+	out := make([]map[string]bigquery.Value, len(rows))
+	for i, row := range rows {
+		out[i] = r.record("", schema, row)
+	}
+	return schema, out
+}
+
+// tag records the columns of schema that carry a matching policy tag.
+func (r *redactor) tag(schema bigquery.Schema) {
+	walkFields(schema, "", func(path string, f *bigquery.FieldSchema) {
+		if r.cfg.matchesPolicyTag(f) {
+			r.tagged[strings.ToLower(path)] = true
+		}
+	})
+}
+
+// profile redacts the values reported by profile, which come from the
+// profiled table whose schema is given. The min, max and top values of
+// redacted columns are masked or hashed, or omitted in drop mode; those of
+// other columns go through the value detectors.
+func (r *redactor) profile(schema bigquery.Schema, out *profileOutput) {
+	if r == nil {
+		return
+	}
+	r.tag(schema)
+	for i := range out.Columns {
+		p := &out.Columns[i]
+		if r.cfg.Mode == redactDrop && r.matchColumn(p.Name) {
+			r.redacted[p.Name] = true
+			p.Min, p.Max, p.Top = nil, nil, nil
+			continue
+		}
+		p.Min = r.value(p.Name, nil, p.Min)
+		p.Max = r.value(p.Name, nil, p.Max)
+		for j := range p.Top {
+			p.Top[j].Value = r.value(p.Name, nil, p.Top[j].Value)
+		}
+	}
+	out.RedactedColumns = r.columnsRedacted()
+}
+
+func (r *redactor) schema(schema bigquery.Schema, prefix string) bigquery.Schema {
+	if schema == nil {
+		return nil
+	}
+	out := make(bigquery.Schema, 0, len(schema))
+	for _, f := range schema {
+		path := prefix + f.Name
+		switch {
+		case r.matchColumn(path):
+			r.redacted[path] = true
+			if r.cfg.Mode != redactDrop {
+				out = append(out, &bigquery.FieldSchema{Name: f.Name, Type: bigquery.StringFieldType, Description: f.Description})
+			}
+		case f.Type == bigquery.RecordFieldType:
+			g := *f
+			g.Schema = r.schema(f.Schema, path+".")
+			out = append(out, &g)
+		case r.cfg.Mode == redactDrop && len(r.detectors) > 0 && f.Required && f.Type == bigquery.StringFieldType:
+			// Values with a detector match become NULL.
+			g := *f
+			g.Required = false
+			out = append(out, &g)
+		default:
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (r *redactor) record(prefix string, schema bigquery.Schema, m map[string]bigquery.Value) map[string]bigquery.Value {
+	out := make(map[string]bigquery.Value, len(m))
+	for k, v := range m {
+		path := prefix + k
+		if r.cfg.Mode == redactDrop && r.matchColumn(path) {
+			r.redacted[path] = true
+			continue
+		}
+		var fields bigquery.Schema
+		for _, f := range schema {
+			if f.Name == k {
+				fields = f.Schema
+				break
+			}
+		}
+		out[k] = r.value(path, fields, v)
+	}
+	return out
+}
+
+func (r *redactor) value(path string, fields bigquery.Schema, v bigquery.Value) bigquery.Value {
+	if v == nil {
+		return nil
+	}
+	if r.matchColumn(path) {
+		r.redacted[path] = true
+		return r.replace(cellString(v))
+	}
+	switch x := v.(type) {
+	case string:
+		return r.scan(path, x)
+	case []bigquery.Value:
+		out := make([]bigquery.Value, len(x))
+		for i, e := range x {
+			out[i] = r.value(path, fields, e)
+		}
+		return out
+	case map[string]bigquery.Value:
+		return r.record(path+".", fields, x)
+	}
+	return v
+}
+
+// scan redacts the matches of the value detectors in s. In drop mode, a
+// value with a match becomes NULL.
+func (r *redactor) scan(path, s string) bigquery.Value {
+	var spans [][]int
+	for i, re := range r.detectors {
+		for _, m := range re.FindAllStringIndex(s, -1) {
+			if r.cfg.Values[i] == "credit_card" && !luhn(s[m[0]:m[1]]) {
+				continue
+			}
+			spans = append(spans, m)
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+	r.redacted[path] = true
+	if r.cfg.Mode == redactDrop {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	end := 0
+	for i := 0; i < len(spans); i++ {
+		start, stop := spans[i][0], spans[i][1]
+		// Merge overlapping matches of different detectors.
+		for i+1 < len(spans) && spans[i+1][0] < stop {
+			i++
+			stop = max(stop, spans[i][1])
+		}
+		b.WriteString(s[end:start])
+		b.WriteString(r.replace(s[start:stop]))
+		end = stop
+	}
+	b.WriteString(s[end:])
+	return b.String()
+}
+
+// replace returns the redacted form of a value: a fixed mask, or in hash
+// mode a keyed hash that is equal for equal values, so that redacted
+// columns can still be grouped and joined on.
+func (r *redactor) replace(s string) string {
+	if r.cfg.Mode != redactHash {
+		return redactedValue
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return "hash:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// columnsRedacted returns the sorted paths of the redacted columns.
+func (r *redactor) columnsRedacted() []string {
+	if r == nil {
+		return nil
+	}
+	var paths []string
+	for p := range r.redacted {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum of card
+// numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,288 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+const piiTag = "projects/p/locations/us/taxonomies/1/policyTags/pii"
+
+// redactionSchema and redactionRows hold personal data for each kind of
+// redaction rule; piiRules matches them.
+var redactionSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.IntegerFieldType},
+	{Name: "email", Type: bigquery.StringFieldType},
+	{Name: "ssn", Type: bigquery.StringFieldType},
+	{Name: "note", Type: bigquery.StringFieldType, Required: true},
+	{Name: "contact", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "phone", Type: bigquery.StringFieldType},
+		{Name: "city", Type: bigquery.StringFieldType},
+	}},
+}
+
+var redactionRows = []map[string]bigquery.Value{
+	{"id": int64(1), "email": "a@example.com", "ssn": "123-45-6789", "note": "call +81 90-1234-5678 or mail b@example.org",
+		"contact": map[string]bigquery.Value{"phone": "555-123-4567", "city": "Tokyo"}},
+	{"id": int64(2), "email": "a@example.com", "ssn": nil, "note": "card 4111 1111 1111 1111, order 1234567890123",
+		"contact": map[string]bigquery.Value{"phone": nil, "city": "Osaka"}},
+}
+
+var piiRules = RedactionConfig{
+	Columns:    []*regexp.Regexp{regexp.MustCompile(`(?i)^email$`)},
+	PolicyTags: []*regexp.Regexp{regexp.MustCompile(`policyTags/pii$`)},
+	Values:     []string{"email", "phone", "credit_card"},
+	Mode:       redactMask,
+	HashKey:    "secret",
+}
+
+// piiSecrets must not appear in redacted results.
+var piiSecrets = []string{"a@example.com", "b@example.org", "123-45-6789", "1234-5678", "555-123-4567", "4111 1111"}
+
+func TestRedactMask(t *testing.T) {
+	mock := &bq.MockClient{
+		QuerySchemaRes: redactionSchema,
+		QueryRes:       redactionRows,
+		DryRunRes:      &bigquery.QueryStatistics{ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "users"}}},
+		SchemaRes:      bigquery.Schema{{Name: "ssn", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{piiTag}}}},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(piiRules))
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM d.users"})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	for _, secret := range piiSecrets {
+		if text := res.Content[0].(mcp.TextContent).Text; strings.Contains(text, secret) {
+			t.Errorf("result leaks %q:\n%s", secret, text)
+		}
+	}
+	out := res.StructuredContent.(queryOutput)
+	row := out.Rows[0]
+	if row["email"] != redactedValue || row["ssn"] != redactedValue || row["id"] != int64(1) {
+		t.Errorf("row = %v", row)
+	}
+	if got := row["note"]; got != "call [REDACTED] or mail [REDACTED]" {
+		t.Errorf("note = %q", got)
+	}
+	if got := row["contact"].(map[string]bigquery.Value); got["phone"] != redactedValue || got["city"] != "Tokyo" {
+		t.Errorf("contact = %v", got)
+	}
+	// The order number fails the Luhn check and is kept.
+	if got := out.Rows[1]["note"]; got != "card [REDACTED], order 1234567890123" {
+		t.Errorf("note = %q", got)
+	}
+	if out.Rows[1]["ssn"] != nil {
+		t.Errorf("NULL was masked: %v", out.Rows[1]["ssn"])
+	}
+	want := []string{"contact.phone", "email", "note", "ssn"}
+	if got := out.Metadata.RedactedColumns; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("redacted_columns = %v, want %v", got, want)
+	}
+}
+
+// schemaErrorClient fails to read table schemas.
+type schemaErrorClient struct {
+	*bq.MockClient
+	ran bool
+}
+
+func (c *schemaErrorClient) GetTableSchema(ctx context.Context, projectID, datasetID, tableID string) ([]*bigquery.FieldSchema, error) {
+	return nil, errors.New("permission denied")
+}
+
+func (c *schemaErrorClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	c.ran = true
+	return c.MockClient.RunQuery(ctx, sql)
+}
+
+func TestRedactUnreadablePolicyTags(t *testing.T) {
+	mock := &schemaErrorClient{MockClient: &bq.MockClient{
+		QuerySchemaRes: redactionSchema,
+		QueryRes:       redactionRows,
+		DryRunRes:      &bigquery.QueryStatistics{ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "users"}}},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(piiRules))
+	_, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM d.users"})
+	if err == nil || !strings.Contains(err.Error(), "p.d.users") {
+		t.Fatalf("expected the query to fail on the unreadable schema, got %v", err)
+	}
+	if mock.ran {
+		t.Error("query ran without its policy tags")
+	}
+}
+
+func TestRedactHashAndDrop(t *testing.T) {
+	mock := &bq.MockClient{
+		QuerySchemaRes: redactionSchema,
+		QueryRes:       redactionRows,
+		DryRunRes:      &bigquery.QueryStatistics{ReferencedTables: []*bigquery.Table{{ProjectID: "p", DatasetID: "d", TableID: "users"}}},
+		SchemaRes:      bigquery.Schema{{Name: "ssn", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{piiTag}}}},
+	}
+	rules := piiRules
+	rules.Mode = redactHash
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(rules))
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM d.users"})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	for _, secret := range piiSecrets {
+		if text := res.Content[0].(mcp.TextContent).Text; strings.Contains(text, secret) {
+			t.Errorf("result leaks %q:\n%s", secret, text)
+		}
+	}
+	out := res.StructuredContent.(queryOutput)
+	first, second := out.Rows[0]["email"].(string), out.Rows[1]["email"].(string)
+	if !strings.HasPrefix(first, "hash:") || first != second {
+		t.Errorf("hashes of equal emails: %q, %q", first, second)
+	}
+	other := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p",
+		WithRedaction(RedactionConfig{Values: []string{"email"}, Mode: redactHash, HashKey: "other"}))
+	res, err = other.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM d.users"})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	if got := res.StructuredContent.(queryOutput).Rows[0]["email"]; got == first || !strings.HasPrefix(got.(string), "hash:") {
+		t.Error("hash does not depend on the key")
+	}
+
+	rules.Mode = redactDrop
+	srv = NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(rules))
+	res, err = srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM d.users"})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	for _, secret := range piiSecrets {
+		if text := res.Content[0].(mcp.TextContent).Text; strings.Contains(text, secret) {
+			t.Errorf("result leaks %q:\n%s", secret, text)
+		}
+	}
+	out = res.StructuredContent.(queryOutput)
+	if _, ok := out.Rows[0]["email"]; ok {
+		t.Errorf("email not dropped: %v", out.Rows[0])
+	}
+	if props := out.RowSchema["properties"].(map[string]any); props["email"] != nil || props["ssn"] != nil || props["id"] == nil {
+		t.Errorf("row schema = %v", out.RowSchema)
+	}
+	if out.Rows[0]["note"] != nil || out.Rows[0]["id"] != int64(1) {
+		t.Errorf("row = %v", out.Rows[0])
+	}
+	// REQUIRED string columns become nullable, as detected values are NULL.
+	if note := out.RowSchema["properties"].(map[string]any)["note"].(map[string]any); !strings.Contains(fmt.Sprint(note["type"]), "null") {
+		t.Errorf("note schema = %v, want nullable", note)
+	}
+	// Values matching a detector become NULL.
+	if contact := out.Rows[0]["contact"].(map[string]bigquery.Value); contact["phone"] != nil || contact["city"] != "Tokyo" {
+		t.Errorf("contact = %v", contact)
+	}
+}
+
+func TestRedactPreview(t *testing.T) {
+	rec := &readRecorder{MockClient: &bq.MockClient{ReadRes: &bq.QueryResult{
+		Schema: bigquery.Schema{
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "ssn", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{piiTag}}},
+		},
+		Rows:      []map[string]bigquery.Value{{"id": int64(1), "ssn": "123-45-6789"}},
+		TotalRows: 1,
+	}}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p", WithRedaction(piiRules))
+	res, err := srv.previewHandler(context.Background(), mcp.CallToolRequest{}, previewArgs{Dataset: "d", Table: "users"})
+	if err != nil {
+		t.Fatalf("previewHandler error: %v", err)
+	}
+	out := res.StructuredContent.(queryOutput)
+	if out.Rows[0]["ssn"] != redactedValue || len(out.Metadata.RedactedColumns) != 1 {
+		t.Errorf("preview = %+v", out)
+	}
+	mc, _ := mcp.AsTextContent(res.Content[1])
+	var meta resultMetadata
+	if err := json.Unmarshal([]byte(mc.Text), &meta); err != nil || meta.RedactedColumns[0] != "ssn" {
+		t.Errorf("metadata = %s", mc.Text)
+	}
+	// The rows read from the client are left untouched.
+	if rec.ReadRes.Rows[0]["ssn"] != "123-45-6789" {
+		t.Error("redaction modified the client result")
+	}
+}
+
+func TestParseRedaction(t *testing.T) {
+	if _, err := ParseValueDetectors("email, ssn"); err == nil {
+		t.Error("unknown detector accepted")
+	}
+	if _, err := ParseRedactionMode("blur"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	patterns, err := ParseRedactionPatterns("^email$, phone")
+	if err != nil || len(patterns) != 2 || !patterns[0].MatchString("EMAIL") {
+		t.Errorf("patterns = %v, %v", patterns, err)
+	}
+	if _, err := ParseRedactionPatterns("("); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestRedactProfile(t *testing.T) {
+	mock := &bq.MockClient{
+		SchemaRes: bigquery.Schema{
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "email", Type: bigquery.StringFieldType},
+			{Name: "ssn", Type: bigquery.StringFieldType, PolicyTags: &bigquery.PolicyTagList{Names: []string{piiTag}}},
+			{Name: "note", Type: bigquery.StringFieldType},
+		},
+		DryRunRes: &bigquery.QueryStatistics{StatementType: "SELECT"},
+		QueryRes: []map[string]bigquery.Value{{
+			"row_count": int64(2),
+			"c0_min":    int64(1),
+			"c0_max":    int64(2),
+			"c1_min":    "a@example.com",
+			"c1_max":    "a@example.com",
+			"c1_top":    []bigquery.Value{map[string]bigquery.Value{"value": "a@example.com", "count": int64(2)}},
+			"c2_min":    "123-45-6789",
+			"c2_max":    "123-45-6789",
+			"c3_min":    "mail b@example.org",
+			"c3_max":    "no contact",
+		}},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(piiRules))
+	res, err := srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "users"})
+	if err != nil {
+		t.Fatalf("profileHandler error: %v", err)
+	}
+	for _, secret := range piiSecrets {
+		if text := res.Content[0].(mcp.TextContent).Text; strings.Contains(text, secret) {
+			t.Errorf("profile leaks %q:\n%s", secret, text)
+		}
+	}
+	out := res.StructuredContent.(*profileOutput)
+	id, email, ssn, note := out.Columns[0], out.Columns[1], out.Columns[2], out.Columns[3]
+	if id.Min != int64(1) || email.Min != redactedValue || email.Top[0].Value != redactedValue || email.Top[0].Count != 2 || ssn.Max != redactedValue {
+		t.Errorf("profile = %+v", out.Columns)
+	}
+	if note.Min != "mail [REDACTED]" || note.Max != "no contact" {
+		t.Errorf("note = %+v", note)
+	}
+	if got := strings.Join(out.RedactedColumns, ","); got != "email,note,ssn" {
+		t.Errorf("redacted_columns = %s", got)
+	}
+
+	rules := piiRules
+	rules.Mode = redactDrop
+	srv = NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithRedaction(rules))
+	res, err = srv.profileHandler(context.Background(), mcp.CallToolRequest{}, profileArgs{Dataset: "d", Table: "users"})
+	if err != nil {
+		t.Fatalf("profileHandler error: %v", err)
+	}
+	out = res.StructuredContent.(*profileOutput)
+	if email := out.Columns[1]; email.Min != nil || email.Max != nil || email.Top != nil || out.Columns[2].Min != nil {
+		t.Errorf("profile = %+v", out.Columns)
+	}
+}
@@ -0,0 +1,349 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	resourceScheme      = "bigquery://"
+	tableURITemplate    = resourceScheme + "{project}/{dataset}/{table}"
+	resourceMIMEType    = "application/json"
+	defaultPollInterval = 5 * time.Minute
+)
+
+// tableURI returns the resource URI of a table.
+func tableURI(project, dataset, table string) string {
+	return resourceScheme + project + "/" + dataset + "/" + table
+}
+
+// parseTableURI splits a bigquery://{project}/{dataset}/{table} URI.
+func parseTableURI(uri string) (project, dataset, table string, err error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok {
+		return "", "", "", fmt.Errorf("unsupported resource URI %q", uri)
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("resource URI %q must have the form %s", uri, tableURITemplate)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// tableResource is the JSON document returned when reading a table resource.
+type tableResource struct {
+	Project          string                     `json:"project"`
+	Dataset          string                     `json:"dataset"`
+	Table            string                     `json:"table"`
+	Type             string                     `json:"type,omitempty"`
+	Description      string                     `json:"description,omitempty"`
+	NumRows          uint64                     `json:"num_rows"`
+	NumBytes         int64                      `json:"num_bytes"`
+	CreationTime     time.Time                  `json:"creation_time"`
+	LastModifiedTime time.Time                  `json:"last_modified_time"`
+	ExpirationTime   *time.Time                 `json:"expiration_time,omitempty"`
+	TimePartitioning *bigquery.TimePartitioning `json:"time_partitioning,omitempty"`
+	Clustering       []string                   `json:"clustering,omitempty"`
+	Labels           map[string]string          `json:"labels,omitempty"`
+	Schema           bigquery.Schema            `json:"schema"`
+}
+
+func newTableResource(project, dataset, table string, meta *bigquery.TableMetadata) tableResource {
+	r := tableResource{Project: project, Dataset: dataset, Table: table}
+	if meta == nil {
+		return r
+	}
+	r.Type = string(meta.Type)
+	r.Description = meta.Description
+	r.NumRows = meta.NumRows
+	r.NumBytes = meta.NumBytes
+	r.CreationTime = meta.CreationTime
+	r.LastModifiedTime = meta.LastModifiedTime
+	if !meta.ExpirationTime.IsZero() {
+		t := meta.ExpirationTime
+		r.ExpirationTime = &t
+	}
+	r.TimePartitioning = meta.TimePartitioning
+	if meta.Clustering != nil {
+		r.Clustering = meta.Clustering.Fields
+	}
+	r.Labels = meta.Labels
+	r.Schema = meta.Schema
+	return r
+}
+
+// registerResources installs the table resource template and the hooks that
+// track resource subscriptions.
+func (s *Server) registerResources(hooks *server.Hooks) {
+	s.mcpServer.AddResourceTemplate(mcp.NewResourceTemplate(
+		tableURITemplate,
+		"BigQuery table",
+		mcp.WithTemplateDescription("Schema and metadata of a BigQuery table"),
+		mcp.WithTemplateMIMEType(resourceMIMEType),
+	), s.tableResourceHandler)
+
+	hooks.AddAfterSubscribe(func(ctx context.Context, _ any, req *mcp.SubscribeRequest, _ *mcp.EmptyResult) {
+		session := server.ClientSessionFromContext(ctx)
+		if session == nil {
+			return
+		}
+		s.subscriptions.subscribe(session.SessionID(), req.Params.URI)
+		// Record the current schema so that the first poll can detect a change.
+		if fp, err := s.schemaFingerprint(ctx, req.Params.URI); err == nil {
+			s.subscriptions.changed(req.Params.URI, fp)
+		}
+	})
+	hooks.AddAfterUnsubscribe(func(ctx context.Context, _ any, req *mcp.UnsubscribeRequest, _ *mcp.EmptyResult) {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			s.subscriptions.unsubscribe(session.SessionID(), req.Params.URI)
+		}
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		s.subscriptions.removeSession(session.SessionID())
+	})
+}
+
+func (s *Server) tableResourceHandler(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	project, dataset, table, err := parseTableURI(req.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+	if s.tableFilter != nil && !s.tableFilter.MatchString(table) {
+		return nil, fmt.Errorf("table %q is not allowed by the table filter", table)
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := c.GetTableMetadata(ctx, project, dataset, table)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(newTableResource(project, dataset, table, meta))
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      req.Params.URI,
+		MIMEType: resourceMIMEType,
+		Text:     string(data),
+	}}, nil
+}
+
+// RefreshResources lists the tables of the allowed datasets and publishes
+// them as resources. Datasets default to all datasets of the client project.
+func (s *Server) RefreshResources(ctx context.Context) error {
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return err
+	}
+	datasets := s.datasets
+	if len(datasets) == 0 {
+		ids, err := c.ListDatasets(ctx, s.clientProject)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			datasets = append(datasets, s.clientProject+"."+id)
+		}
+	}
+	var resources []server.ServerResource
+	for _, ds := range datasets {
+		project, dataset := s.splitDataset(ds)
+		tables, err := c.ListTables(ctx, project, dataset)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if s.tableFilter != nil && !s.tableFilter.MatchString(t) {
+				continue
+			}
+			resources = append(resources, server.ServerResource{
+				Resource: mcp.NewResource(
+					tableURI(project, dataset, t),
+					project+"."+dataset+"."+t,
+					mcp.WithResourceDescription("Schema and metadata of BigQuery table "+dataset+"."+t),
+					mcp.WithMIMEType(resourceMIMEType),
+				),
+				Handler: s.tableResourceHandler,
+			})
+		}
+	}
+	uris := make([]string, len(resources))
+	for i, r := range resources {
+		uris[i] = r.Resource.URI
+	}
+	slices.Sort(uris)
+	var current []string
+	for uri := range s.mcpServer.ListResources() {
+		current = append(current, uri)
+	}
+	slices.Sort(current)
+	if !slices.Equal(uris, current) {
+		s.mcpServer.SetResources(resources...)
+	}
+	return nil
+}
+
+// splitDataset splits "project.dataset" and defaults the project to the
+// client project.
+func (s *Server) splitDataset(ds string) (project, dataset string) {
+	if p, d, ok := strings.Cut(ds, "."); ok {
+		return p, d
+	}
+	return s.clientProject, ds
+}
+
+// WatchResources periodically refreshes the resource list and notifies
+// subscribed sessions when the schema of a table changes. It blocks until
+// ctx is cancelled.
+func (s *Server) WatchResources(ctx context.Context) {
+	if s.pollInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RefreshResources(ctx); err != nil {
+				log.Printf("refresh resources: %v", err)
+			}
+			s.checkSubscriptions(ctx)
+		}
+	}
+}
+
+// checkSubscriptions compares the schema of every subscribed table with the
+// last seen fingerprint and sends notifications/resources/updated on change.
+func (s *Server) checkSubscriptions(ctx context.Context) {
+	for _, uri := range s.subscriptions.uris() {
+		fp, err := s.schemaFingerprint(ctx, uri)
+		if err != nil {
+			log.Printf("check subscription %s: %v", uri, err)
+			continue
+		}
+		if !s.subscriptions.changed(uri, fp) {
+			continue
+		}
+		for _, sid := range s.subscriptions.sessions(uri) {
+			if err := s.mcpServer.SendNotificationToSpecificClient(sid, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri}); err != nil {
+				log.Printf("notify %s of %s: %v", sid, uri, err)
+			}
+		}
+	}
+}
+
+// schemaFingerprint returns a string that changes whenever the schema of the
+// table identified by uri changes.
+func (s *Server) schemaFingerprint(ctx context.Context, uri string) (string, error) {
+	project, dataset, table, err := parseTableURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if s.tableFilter != nil && !s.tableFilter.MatchString(table) {
+		return "", fmt.Errorf("table %q is not allowed by the table filter", table)
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return "", err
+	}
+	meta, err := c.GetTableMetadata(ctx, project, dataset, table)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(meta.Schema)
+	return string(data), err
+}
+
+// subscriptionRegistry tracks which sessions subscribed to which resource
+// URIs and the last observed schema fingerprint of each URI.
+type subscriptionRegistry struct {
+	mu           sync.Mutex
+	subs         map[string]map[string]bool
+	fingerprints map[string]string
+}
+
+func (r *subscriptionRegistry) subscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.subs == nil {
+		r.subs = make(map[string]map[string]bool)
+	}
+	if r.subs[uri] == nil {
+		r.subs[uri] = make(map[string]bool)
+	}
+	r.subs[uri][sessionID] = true
+}
+
+func (r *subscriptionRegistry) unsubscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subs[uri], sessionID)
+	if len(r.subs[uri]) == 0 {
+		delete(r.subs, uri)
+		delete(r.fingerprints, uri)
+	}
+}
+
+func (r *subscriptionRegistry) removeSession(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uri, sessions := range r.subs {
+		delete(sessions, sessionID)
+		if len(sessions) == 0 {
+			delete(r.subs, uri)
+			delete(r.fingerprints, uri)
+		}
+	}
+}
+
+func (r *subscriptionRegistry) uris() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for uri := range r.subs {
+		out = append(out, uri)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func (r *subscriptionRegistry) sessions(uri string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for sid := range r.subs[uri] {
+		out = append(out, sid)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// changed records fingerprint for uri and reports whether it differs from a
+// previously recorded one. The first observation is never a change.
+func (r *subscriptionRegistry) changed(uri, fingerprint string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fingerprints == nil {
+		r.fingerprints = make(map[string]string)
+	}
+	prev, ok := r.fingerprints[uri]
+	r.fingerprints[uri] = fingerprint
+	return ok && prev != fingerprint
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+type testSession struct {
+	id     string
+	notify chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()                                         {}
+func (s *testSession) Initialized() bool                                   { return true }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notify }
+func (s *testSession) SessionID() string                                   { return s.id }
+
+func TestParseTableURI(t *testing.T) {
+	p, d, tbl, err := parseTableURI("bigquery://proj/ds/tbl")
+	if err != nil || p != "proj" || d != "ds" || tbl != "tbl" {
+		t.Fatalf("unexpected parse result: %q %q %q %v", p, d, tbl, err)
+	}
+	for _, uri := range []string{"bigquery://proj/ds", "bq://proj/ds/tbl", "bigquery://proj//tbl"} {
+		if _, _, _, err := parseTableURI(uri); err == nil {
+			t.Fatalf("expected error for %q", uri)
+		}
+	}
+}
+
+func TestTableResourceHandler(t *testing.T) {
+	mock := &bq.MockClient{MetadataRes: &bigquery.TableMetadata{
+		Description: "users table",
+		NumRows:     42,
+		Schema:      bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithTableFilter(regexp.MustCompile("^u")))
+
+	req := mcp.ReadResourceRequest{}
+	req.Params.URI = "bigquery://p/d/users"
+	contents, err := srv.tableResourceHandler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("tableResourceHandler error: %v", err)
+	}
+	tc, ok := contents[0].(mcp.TextResourceContents)
+	if !ok {
+		t.Fatalf("unexpected contents: %#v", contents[0])
+	}
+	var res tableResource
+	if err := json.Unmarshal([]byte(tc.Text), &res); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if res.Table != "users" || res.NumRows != 42 || len(res.Schema) != 1 || res.Description != "users table" {
+		t.Fatalf("unexpected resource: %#v", res)
+	}
+
+	req.Params.URI = "bigquery://p/d/orders"
+	if _, err := srv.tableResourceHandler(context.Background(), req); err == nil {
+		t.Fatalf("expected table filter to reject orders")
+	}
+}
+
+func TestRefreshResources(t *testing.T) {
+	mock := &bq.MockClient{DatasetsRes: []string{"d"}, TablesRes: []string{"users", "orders"}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithTableFilter(regexp.MustCompile("^u")))
+
+	if err := srv.RefreshResources(context.Background()); err != nil {
+		t.Fatalf("RefreshResources error: %v", err)
+	}
+	resources := srv.MCPServer().ListResources()
+	if len(resources) != 1 || resources["bigquery://p/d/users"] == nil {
+		t.Fatalf("unexpected resources: %v", resources)
+	}
+
+	srv = NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithDatasets([]string{"other.d2"}))
+	if err := srv.RefreshResources(context.Background()); err != nil {
+		t.Fatalf("RefreshResources error: %v", err)
+	}
+	resources = srv.MCPServer().ListResources()
+	if len(resources) != 2 || resources["bigquery://other/d2/orders"] == nil {
+		t.Fatalf("unexpected resources: %v", resources)
+	}
+}
+
+func TestSubscriptionNotifiesOnSchemaChange(t *testing.T) {
+	mock := &bq.MockClient{MetadataRes: &bigquery.TableMetadata{
+		Schema: bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 4)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	msg := `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"bigquery://p/d/t"}}`
+	srv.MCPServer().HandleMessage(ctx, json.RawMessage(msg))
+
+	srv.checkSubscriptions(context.Background())
+	if len(session.notify) != 0 {
+		t.Fatalf("unexpected notification without schema change")
+	}
+
+	mock.MetadataRes = &bigquery.TableMetadata{Schema: bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+	}}
+	srv.checkSubscriptions(context.Background())
+	select {
+	case n := <-session.notify:
+		if n.Method != mcp.MethodNotificationResourceUpdated || n.Params.AdditionalFields["uri"] != "bigquery://p/d/t" {
+			t.Fatalf("unexpected notification: %#v", n)
+		}
+	default:
+		t.Fatalf("expected resource updated notification")
+	}
+
+	srv.MCPServer().UnregisterSession(context.Background(), "s1")
+	if uris := srv.subscriptions.uris(); len(uris) != 0 {
+		t.Fatalf("expected subscriptions to be removed, got %v", uris)
+	}
+}
+
+var _ server.ClientSession = (*testSession)(nil)
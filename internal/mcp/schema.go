@@ -0,0 +1,234 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Schema modes of the schema tool.
+const (
+	schemaModeNested  = "nested"
+	schemaModeFlatten = "flatten"
+	schemaModeDDL     = "ddl"
+)
+
+// flatColumn describes one column or nested field addressed by its dotted
+// path.
+type flatColumn struct {
+	Path                   string   `json:"path"`
+	Type                   string   `json:"type"`
+	Mode                   string   `json:"mode"`
+	Description            string   `json:"description,omitempty"`
+	PolicyTags             []string `json:"policy_tags,omitempty"`
+	DefaultValueExpression string   `json:"default_value_expression,omitempty"`
+}
+
+type flatSchemaOutput struct {
+	Columns []flatColumn `json:"columns"`
+}
+
+type ddlOutput struct {
+	DDL string `json:"ddl"`
+}
+
+// fieldMode returns the mode of f as reported by the BigQuery API.
+func fieldMode(f *bigquery.FieldSchema) string {
+	switch {
+	case f.Repeated:
+		return "REPEATED"
+	case f.Required:
+		return "REQUIRED"
+	}
+	return "NULLABLE"
+}
+
+// flattenSchema lists every field of schema, including nested fields, in
+// schema order. RECORD fields are reported as STRUCT without their nested
+// field types.
+func flattenSchema(schema bigquery.Schema) []flatColumn {
+	cols := []flatColumn{}
+	walkFields(schema, "", func(path string, f *bigquery.FieldSchema) {
+		typ := ddlType(f)
+		if f.Type == bigquery.RecordFieldType {
+			// Nested fields are listed separately.
+			typ = "STRUCT"
+			if f.Repeated {
+				typ = "ARRAY<STRUCT>"
+			}
+		}
+		c := flatColumn{
+			Path:                   path,
+			Type:                   typ,
+			Mode:                   fieldMode(f),
+			Description:            f.Description,
+			DefaultValueExpression: f.DefaultValueExpression,
+		}
+		if f.PolicyTags != nil {
+			c.PolicyTags = f.PolicyTags.Names
+		}
+		cols = append(cols, c)
+	})
+	return cols
+}
+
+// ddlType renders the GoogleSQL type of f, including parameters, nested
+// STRUCT fields and the ARRAY wrapper of repeated fields.
+func ddlType(f *bigquery.FieldSchema) string {
+	var t string
+	switch f.Type {
+	case bigquery.RecordFieldType:
+		fields := make([]string, len(f.Schema))
+		for i, sub := range f.Schema {
+			fields[i] = ddlColumn(sub, false)
+		}
+		t = "STRUCT<" + strings.Join(fields, ", ") + ">"
+	case bigquery.RangeFieldType:
+		elem := "DATE"
+		if f.RangeElementType != nil {
+			elem = string(f.RangeElementType.Type)
+		}
+		t = "RANGE<" + elem + ">"
+	default:
+		t = string(f.Type)
+		if n, ok := legacyTypeNames[t]; ok {
+			t = n
+		}
+		switch {
+		case f.MaxLength > 0:
+			t += fmt.Sprintf("(%d)", f.MaxLength)
+		case f.Precision > 0 && f.Scale > 0:
+			t += fmt.Sprintf("(%d, %d)", f.Precision, f.Scale)
+		case f.Precision > 0:
+			t += fmt.Sprintf("(%d)", f.Precision)
+		}
+	}
+	if f.Repeated {
+		t = "ARRAY<" + t + ">"
+	}
+	return t
+}
+
+// ddlColumn renders a column definition: name, type, constraints and
+// options. Default values are only allowed on top-level columns.
+func ddlColumn(f *bigquery.FieldSchema, topLevel bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "`%s` %s", f.Name, ddlType(f))
+	if f.Required {
+		b.WriteString(" NOT NULL")
+	}
+	if topLevel && f.DefaultValueExpression != "" {
+		b.WriteString(" DEFAULT " + f.DefaultValueExpression)
+	}
+	if f.Description != "" {
+		b.WriteString(" OPTIONS(description=" + sqlString(f.Description) + ")")
+	}
+	return b.String()
+}
+
+// tableDDL renders a CREATE statement for a table or view. Table
+// statements include partitioning, clustering and the main table options.
+func tableDDL(table string, meta *bigquery.TableMetadata) string {
+	switch {
+	case meta.Type == bigquery.ViewTable && meta.ViewQuery != "":
+		return fmt.Sprintf("CREATE VIEW `%s`%s\nAS %s;", table, ddlOptions(meta, false), meta.ViewQuery)
+	case meta.Type == bigquery.MaterializedView && meta.MaterializedView != nil:
+		return fmt.Sprintf("CREATE MATERIALIZED VIEW `%s`%s\nAS %s;", table, ddlOptions(meta, false), meta.MaterializedView.Query)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE `%s` (\n", table)
+	for i, f := range meta.Schema {
+		b.WriteString("  " + ddlColumn(f, true))
+		if i < len(meta.Schema)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")")
+	if p := partitionExpr(meta); p != "" {
+		b.WriteString("\nPARTITION BY " + p)
+	}
+	if meta.Clustering != nil && len(meta.Clustering.Fields) > 0 {
+		b.WriteString("\nCLUSTER BY " + strings.Join(meta.Clustering.Fields, ", "))
+	}
+	b.WriteString(ddlOptions(meta, true))
+	b.WriteString(";")
+	return b.String()
+}
+
+// partitionExpr renders the PARTITION BY expression of a table, or "" when
+// it is not partitioned.
+func partitionExpr(meta *bigquery.TableMetadata) string {
+	if rp := meta.RangePartitioning; rp != nil && rp.Range != nil {
+		return fmt.Sprintf("RANGE_BUCKET(%s, GENERATE_ARRAY(%d, %d, %d))", rp.Field, rp.Range.Start, rp.Range.End, rp.Range.Interval)
+	}
+	tp := meta.TimePartitioning
+	if tp == nil {
+		return ""
+	}
+	unit := string(tp.Type)
+	if unit == "" {
+		unit = string(bigquery.DayPartitioningType)
+	}
+	if tp.Field == "" {
+		if unit == string(bigquery.DayPartitioningType) {
+			return "_PARTITIONDATE"
+		}
+		return fmt.Sprintf("TIMESTAMP_TRUNC(_PARTITIONTIME, %s)", unit)
+	}
+	var typ bigquery.FieldType
+	for _, f := range meta.Schema {
+		if f.Name == tp.Field {
+			typ = f.Type
+		}
+	}
+	switch typ {
+	case bigquery.DateFieldType:
+		if unit == string(bigquery.DayPartitioningType) {
+			return tp.Field
+		}
+		return fmt.Sprintf("DATE_TRUNC(%s, %s)", tp.Field, unit)
+	case bigquery.DateTimeFieldType:
+		return fmt.Sprintf("DATETIME_TRUNC(%s, %s)", tp.Field, unit)
+	}
+	if unit == string(bigquery.DayPartitioningType) {
+		return fmt.Sprintf("DATE(%s)", tp.Field)
+	}
+	return fmt.Sprintf("TIMESTAMP_TRUNC(%s, %s)", tp.Field, unit)
+}
+
+// ddlOptions renders the OPTIONS clause of a CREATE statement. Partition
+// options only apply to tables.
+func ddlOptions(meta *bigquery.TableMetadata, table bool) string {
+	var opts []string
+	if meta.Description != "" {
+		opts = append(opts, "description="+sqlString(meta.Description))
+	}
+	if len(meta.Labels) > 0 {
+		keys := make([]string, 0, len(meta.Labels))
+		for k := range meta.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, len(keys))
+		for i, k := range keys {
+			labels[i] = fmt.Sprintf("(%s, %s)", sqlString(k), sqlString(meta.Labels[k]))
+		}
+		opts = append(opts, "labels=["+strings.Join(labels, ", ")+"]")
+	}
+	if table {
+		tp := meta.TimePartitioning
+		if tp != nil && tp.Expiration > 0 {
+			opts = append(opts, fmt.Sprintf("partition_expiration_days=%g", tp.Expiration.Hours()/24))
+		}
+		if meta.RequirePartitionFilter || (tp != nil && tp.RequirePartitionFilter) {
+			opts = append(opts, "require_partition_filter=TRUE")
+		}
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return "\nOPTIONS(\n  " + strings.Join(opts, ",\n  ") + "\n)"
+}
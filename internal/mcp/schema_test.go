@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+var testSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.IntegerFieldType, Required: true, Description: "user id"},
+	{Name: "ts", Type: bigquery.TimestampFieldType, DefaultValueExpression: "CURRENT_TIMESTAMP()"},
+	{Name: "code", Type: bigquery.StringFieldType, MaxLength: 8, PolicyTags: &bigquery.PolicyTagList{Names: []string{"projects/p/taxonomies/1/policyTags/2"}}},
+	{Name: "amount", Type: bigquery.NumericFieldType, Precision: 10, Scale: 2},
+	{Name: "address", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "city", Type: bigquery.StringFieldType, Description: `the "city"`},
+	}},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "items", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+		{Name: "sku", Type: bigquery.StringFieldType},
+	}},
+}
+
+func TestFlattenSchema(t *testing.T) {
+	cols := flattenSchema(testSchema)
+	want := []flatColumn{
+		{Path: "id", Type: "INT64", Mode: "REQUIRED", Description: "user id"},
+		{Path: "ts", Type: "TIMESTAMP", Mode: "NULLABLE", DefaultValueExpression: "CURRENT_TIMESTAMP()"},
+		{Path: "code", Type: "STRING(8)", Mode: "NULLABLE", PolicyTags: []string{"projects/p/taxonomies/1/policyTags/2"}},
+		{Path: "amount", Type: "NUMERIC(10, 2)", Mode: "NULLABLE"},
+		{Path: "address", Type: "STRUCT", Mode: "NULLABLE"},
+		{Path: "address.city", Type: "STRING", Mode: "NULLABLE", Description: `the "city"`},
+		{Path: "tags", Type: "ARRAY<STRING>", Mode: "REPEATED"},
+		{Path: "items", Type: "ARRAY<STRUCT>", Mode: "REPEATED"},
+		{Path: "items.sku", Type: "STRING", Mode: "NULLABLE"},
+	}
+	if len(cols) != len(want) {
+		t.Fatalf("got %d columns, want %d: %+v", len(cols), len(want), cols)
+	}
+	for i := range want {
+		got, w := cols[i], want[i]
+		if got.Path != w.Path || got.Type != w.Type || got.Mode != w.Mode || got.Description != w.Description ||
+			got.DefaultValueExpression != w.DefaultValueExpression || len(got.PolicyTags) != len(w.PolicyTags) {
+			t.Fatalf("column %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestTableDDL(t *testing.T) {
+	meta := &bigquery.TableMetadata{
+		Schema:                 testSchema,
+		Description:            "Users",
+		Labels:                 map[string]string{"team": "data", "env": "prod"},
+		TimePartitioning:       &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "ts", Expiration: 30 * 24 * time.Hour},
+		Clustering:             &bigquery.Clustering{Fields: []string{"id"}},
+		RequirePartitionFilter: true,
+	}
+	want := "CREATE TABLE `p.d.users` (\n" +
+		"  `id` INT64 NOT NULL OPTIONS(description=\"user id\"),\n" +
+		"  `ts` TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),\n" +
+		"  `code` STRING(8),\n" +
+		"  `amount` NUMERIC(10, 2),\n" +
+		"  `address` STRUCT<`city` STRING OPTIONS(description=\"the \\\"city\\\"\")>,\n" +
+		"  `tags` ARRAY<STRING>,\n" +
+		"  `items` ARRAY<STRUCT<`sku` STRING>>\n" +
+		")\n" +
+		"PARTITION BY DATE(ts)\n" +
+		"CLUSTER BY id\n" +
+		"OPTIONS(\n" +
+		"  description=\"Users\",\n" +
+		"  labels=[(\"env\", \"prod\"), (\"team\", \"data\")],\n" +
+		"  partition_expiration_days=30,\n" +
+		"  require_partition_filter=TRUE\n" +
+		");"
+	if got := tableDDL("p.d.users", meta); got != want {
+		t.Fatalf("unexpected DDL:\n%s\nwant:\n%s", got, want)
+	}
+
+	record := &bigquery.FieldSchema{Name: "r", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "n", Type: bigquery.IntegerFieldType, DefaultValueExpression: "0"},
+	}}
+	if got := ddlColumn(record, true); got != "`r` STRUCT<`n` INT64>" {
+		t.Fatalf("unexpected DEFAULT on a STRUCT field: %q", got)
+	}
+
+	view := &bigquery.TableMetadata{Type: bigquery.ViewTable, ViewQuery: "SELECT 1 AS x"}
+	if got := tableDDL("p.d.v", view); got != "CREATE VIEW `p.d.v`\nAS SELECT 1 AS x;" {
+		t.Fatalf("unexpected view DDL: %q", got)
+	}
+}
+
+func TestPartitionExpr(t *testing.T) {
+	schema := bigquery.Schema{{Name: "d", Type: bigquery.DateFieldType}, {Name: "dt", Type: bigquery.DateTimeFieldType}}
+	cases := []struct {
+		meta *bigquery.TableMetadata
+		want string
+	}{
+		{&bigquery.TableMetadata{TimePartitioning: &bigquery.TimePartitioning{}}, "_PARTITIONDATE"},
+		{&bigquery.TableMetadata{TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType}}, "TIMESTAMP_TRUNC(_PARTITIONTIME, HOUR)"},
+		{&bigquery.TableMetadata{Schema: schema, TimePartitioning: &bigquery.TimePartitioning{Field: "d"}}, "d"},
+		{&bigquery.TableMetadata{Schema: schema, TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.MonthPartitioningType, Field: "d"}}, "DATE_TRUNC(d, MONTH)"},
+		{&bigquery.TableMetadata{Schema: schema, TimePartitioning: &bigquery.TimePartitioning{Field: "dt"}}, "DATETIME_TRUNC(dt, DAY)"},
+		{&bigquery.TableMetadata{RangePartitioning: &bigquery.RangePartitioning{Field: "n", Range: &bigquery.RangePartitioningRange{Start: 0, End: 100, Interval: 10}}}, "RANGE_BUCKET(n, GENERATE_ARRAY(0, 100, 10))"},
+		{&bigquery.TableMetadata{}, ""},
+	}
+	for _, c := range cases {
+		if got := partitionExpr(c.meta); got != c.want {
+			t.Errorf("partitionExpr = %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestSchemaHandlerModes(t *testing.T) {
+	mock := &bq.MockClient{SchemaRes: testSchema, MetadataRes: &bigquery.TableMetadata{Schema: testSchema[:1]}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	res, err := srv.schemaHandler(context.Background(), mcp.CallToolRequest{}, schemaArgs{Dataset: "d", Table: "t", Mode: schemaModeFlatten})
+	if err != nil {
+		t.Fatalf("schemaHandler error: %v", err)
+	}
+	if out := res.StructuredContent.(flatSchemaOutput); len(out.Columns) != 9 || out.Columns[5].Path != "address.city" {
+		t.Fatalf("unexpected flattened schema: %+v", out)
+	}
+
+	res, err = srv.schemaHandler(context.Background(), mcp.CallToolRequest{}, schemaArgs{Dataset: "d", Table: "t", Mode: schemaModeDDL})
+	if err != nil {
+		t.Fatalf("schemaHandler error: %v", err)
+	}
+	tc, _ := mcp.AsTextContent(res.Content[0])
+	if want := "CREATE TABLE `p.d.t` (\n  `id` INT64 NOT NULL OPTIONS(description=\"user id\")\n);"; tc.Text != want {
+		t.Fatalf("unexpected DDL: %q", tc.Text)
+	}
+
+	if _, err := srv.schemaHandler(context.Background(), mcp.CallToolRequest{}, schemaArgs{Dataset: "d", Table: "t", Mode: "tree"}); err == nil {
+		t.Fatal("expected unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,366 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/api/googleapi"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// scratchTablePrefix starts the name of every table the server creates in
+// the scratch dataset. It is followed by a hash of the MCP session ID, so
+// that sessions neither see nor overwrite each other's tables. Callers
+// without a session, such as stateless HTTP clients, cannot create tables.
+const scratchTablePrefix = "mcp_"
+
+// dropScratchTimeout bounds dropping the scratch tables of an ended session.
+const dropScratchTimeout = 30 * time.Second
+
+// ScratchConfig names the dataset owned by the server, into which the tools
+// that create tables write. Dataset is "dataset" in the client project or
+// "project.dataset". Expiration is the default lifetime of the tables
+// created there; zero keeps them until they are dropped.
+type ScratchConfig struct {
+	Dataset    string
+	Expiration time.Duration
+}
+
+// WithScratchDataset configures the scratch dataset.
+func WithScratchDataset(cfg ScratchConfig) Option {
+	return func(s *Server) {
+		s.scratch = cfg
+	}
+}
+
+// WithWriteMode enables the tools that create or modify BigQuery tables.
+// They are not offered otherwise, whatever else is configured.
+func WithWriteMode(enabled bool) Option {
+	return func(s *Server) {
+		s.writes = enabled
+	}
+}
+
+// scratchDataset returns the project and ID of the scratch dataset.
+func (s *Server) scratchDataset() (project, dataset string) {
+	return s.splitDataset(s.scratch.Dataset)
+}
+
+// tableExpiration returns the expiration time of a table created now with a
+// lifetime of hours, defaulting to the scratch dataset expiration. The zero
+// time means no expiration.
+func (s *Server) tableExpiration(now time.Time, hours float64) time.Time {
+	d := s.scratch.Expiration
+	if hours > 0 {
+		d = time.Duration(hours * float64(time.Hour))
+	}
+	if d <= 0 {
+		return time.Time{}
+	}
+	return now.Add(d)
+}
+
+// scratchPrefix returns the prefix of the scratch tables of an MCP session.
+func scratchPrefix(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return scratchTablePrefix + hex.EncodeToString(sum[:4]) + "_"
+}
+
+// scratchTable returns the ID of the scratch table name of the MCP session
+// of ctx.
+func scratchTable(ctx context.Context, name string) string {
+	return scratchPrefix(sessionID(ctx)) + name
+}
+
+// scratchRegistry keeps the scratch tables created by each live MCP session,
+// so that they are dropped when the session ends or the server shuts down.
+type scratchRegistry struct {
+	mu     sync.Mutex
+	tables map[string]map[string]bool // table IDs keyed by session ID
+}
+
+// open starts tracking the tables of a new session.
+func (r *scratchRegistry) open(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tables == nil {
+		r.tables = make(map[string]map[string]bool)
+	}
+	if r.tables[sessionID] == nil {
+		r.tables[sessionID] = make(map[string]bool)
+	}
+}
+
+// add registers a table of a session. It reports false when the session is
+// not live, e.g. because it ended while the table was being written; the
+// caller must then drop the table, as nothing else will.
+func (r *scratchRegistry) add(sessionID, table string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables, ok := r.tables[sessionID]
+	if !ok {
+		return false
+	}
+	tables[table] = true
+	return true
+}
+
+// take removes the tables of a session from the registry and returns them.
+func (r *scratchRegistry) take(sessionID string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tables []string
+	for t := range r.tables[sessionID] {
+		tables = append(tables, t)
+	}
+	delete(r.tables, sessionID)
+	return tables
+}
+
+// sessions returns the IDs of the sessions with registered tables.
+func (r *scratchRegistry) sessions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, tables := range r.tables {
+		if len(tables) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type createScratchTableArgs struct {
+	SQL              string  `json:"sql"`
+	Name             string  `json:"name"`
+	WriteDisposition string  `json:"write_disposition,omitempty"`
+	ExpirationHours  float64 `json:"expiration_hours,omitempty"`
+}
+
+type listScratchTablesArgs struct {
+	All bool `json:"all,omitempty"`
+}
+
+type scratchTableOutput struct {
+	Table   string `json:"table"`
+	Name    string `json:"name"`
+	Rows    uint64 `json:"rows"`
+	Bytes   int64  `json:"bytes"`
+	Created string `json:"created,omitempty"`
+	Expires string `json:"expires,omitempty"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+type listScratchTablesOutput struct {
+	Tables []scratchTableOutput `json:"tables"`
+}
+
+// registerScratch installs the scratch table tools and the hook dropping
+// the tables of a session when it ends. The tools are only offered in write
+// mode with the scratch dataset set.
+func (s *Server) registerScratch(hooks *server.Hooks) {
+	if !s.writes || s.scratch.Dataset == "" {
+		return
+	}
+	s.mcpServer.AddTool(mcp.NewTool(
+		"create_scratch_table",
+		mcp.WithDescription("Write the result of a query to a table of the scratch dataset, to reuse an intermediate result in later queries. The table is private to this session and dropped when the session ends"),
+		mcp.WithString("sql", mcp.Required(), mcp.Description("Query whose result fills the table")),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Table name; the table ID returned carries a per-session prefix")),
+		mcp.WithString("write_disposition", mcp.Enum(writeEmpty, writeAppend, writeTruncate), mcp.Description("empty: fail if the table has rows (default); append: add the rows; truncate: replace the rows")),
+		mcp.WithNumber("expiration_hours", mcp.Description("Hours until the table expires; defaults to the scratch dataset setting")),
+		mcp.WithRawOutputSchema(scratchTableOutputSchema),
+	), mcp.NewTypedToolHandler(s.createScratchTableHandler))
+
+	s.mcpServer.AddTool(mcp.NewTool(
+		"list_scratch_tables",
+		mcp.WithDescription("List the tables of the scratch dataset created in this session, with their size and expiration"),
+		mcp.WithBoolean("all", mcp.Description("List the tables of every session")),
+		mcp.WithRawOutputSchema(listScratchTablesOutputSchema),
+	), mcp.NewTypedToolHandler(s.listScratchTablesHandler))
+
+	hooks.AddOnRegisterSession(func(_ context.Context, session server.ClientSession) {
+		s.scratchTables.open(session.SessionID())
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		// The tables are taken at once, so that a table written after this
+		// point is not registered and gets dropped by its handler.
+		tables := s.scratchTables.take(session.SessionID())
+		if len(tables) == 0 {
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), dropScratchTimeout)
+			defer cancel()
+			s.dropScratchTables(ctx, tables)
+		}()
+	})
+}
+
+func (s *Server) createScratchTableHandler(ctx context.Context, req mcp.CallToolRequest, args createScratchTableArgs) (*mcp.CallToolResult, error) {
+	if !s.writes || s.scratch.Dataset == "" {
+		return nil, errors.New("write mode is disabled")
+	}
+	if sessionID(ctx) == "" {
+		return nil, errors.New("create_scratch_table requires an MCP session")
+	}
+	tool := toolName(req, "create_scratch_table")
+	if !validTableName(args.Name) {
+		return nil, fmt.Errorf("invalid table name %q: use letters, digits and underscores", args.Name)
+	}
+	disposition := writeEmpty
+	if args.WriteDisposition != "" {
+		disposition = args.WriteDisposition
+	}
+	wd, ok := writeDispositions[disposition]
+	if !ok {
+		return nil, fmt.Errorf("unknown write disposition %q", args.WriteDisposition)
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	s.logQuery(tool, args.SQL)
+	ctx = s.queryContext(ctx, tool)
+	if maxBytes := maxQueryBytes(); maxBytes > 0 {
+		stats, err := c.DryRunQuery(ctx, args.SQL)
+		if err != nil {
+			return nil, err
+		}
+		if stats.TotalBytesProcessed > maxBytes {
+			return nil, fmt.Errorf("query would scan %d bytes (limit %d)", stats.TotalBytesProcessed, maxBytes)
+		}
+	}
+
+	project, dataset := s.scratchDataset()
+	table := scratchTable(ctx, args.Name)
+	dst := &bq.Destination{
+		Project:          project,
+		Dataset:          dataset,
+		Table:            table,
+		WriteDisposition: wd,
+		Expiration:       s.tableExpiration(time.Now(), args.ExpirationHours),
+	}
+	cfg := bq.QueryConfigFrom(ctx)
+	cfg.Destination = dst
+	res, err := c.RunQuery(bq.WithQueryConfig(ctx, cfg), args.SQL)
+	if err != nil {
+		return nil, err
+	}
+	if !s.scratchTables.add(sessionID(ctx), table) {
+		s.dropOrphanedTable(ctx, c, table)
+		return nil, errors.New("the MCP session ended while the table was created; it was dropped")
+	}
+
+	out := scratchTableOutput{Table: project + "." + dataset + "." + table, Name: args.Name, JobID: res.JobID}
+	if meta, err := c.GetTableMetadata(bq.WithRefresh(ctx), project, dataset, table); err == nil {
+		out = newScratchTableOutput(project, dataset, table, args.Name, meta)
+		out.JobID = res.JobID
+	} else if !dst.Expiration.IsZero() {
+		out.Expires = dst.Expiration.UTC().Format(time.RFC3339)
+	}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+func (s *Server) listScratchTablesHandler(ctx context.Context, _ mcp.CallToolRequest, args listScratchTablesArgs) (*mcp.CallToolResult, error) {
+	if !s.writes || s.scratch.Dataset == "" {
+		return nil, errors.New("write mode is disabled")
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	ctx = bq.WithRefresh(ctx)
+	project, dataset := s.scratchDataset()
+	ids, err := c.ListTables(ctx, project, dataset)
+	if err != nil {
+		return nil, err
+	}
+	prefix := scratchPrefix(sessionID(ctx))
+	out := listScratchTablesOutput{Tables: []scratchTableOutput{}}
+	for _, id := range ids {
+		name, own := strings.CutPrefix(id, prefix)
+		if !own && !(args.All && strings.HasPrefix(id, scratchTablePrefix)) {
+			continue
+		}
+		if !own {
+			name = id
+		}
+		meta, err := c.GetTableMetadata(ctx, project, dataset, id)
+		if notFound(err) {
+			// Expired or dropped since the listing.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Tables = append(out.Tables, newScratchTableOutput(project, dataset, id, name, meta))
+	}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+func newScratchTableOutput(project, dataset, table, name string, meta *bigquery.TableMetadata) scratchTableOutput {
+	out := scratchTableOutput{Table: project + "." + dataset + "." + table, Name: name, Rows: meta.NumRows, Bytes: meta.NumBytes}
+	if !meta.CreationTime.IsZero() {
+		out.Created = meta.CreationTime.UTC().Format(time.RFC3339)
+	}
+	if !meta.ExpirationTime.IsZero() {
+		out.Expires = meta.ExpirationTime.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+// dropScratchTables drops scratch tables taken from the registry.
+func (s *Server) dropScratchTables(ctx context.Context, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		log.Printf("drop scratch tables: %v", err)
+		return
+	}
+	for _, t := range tables {
+		s.dropScratchTable(ctx, c, t)
+	}
+}
+
+// dropOrphanedTable drops a table created for a session that ended while
+// the table was written. The call may have been cancelled with the session,
+// so the drop gets a context of its own.
+func (s *Server) dropOrphanedTable(ctx context.Context, c bq.Client, table string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dropScratchTimeout)
+	defer cancel()
+	s.dropScratchTable(ctx, c, table)
+}
+
+// dropScratchTable drops a table of the scratch dataset. A table already
+// gone is skipped; other failures are logged, leaving the table to its
+// expiration.
+func (s *Server) dropScratchTable(ctx context.Context, c bq.Client, table string) {
+	project, dataset := s.scratchDataset()
+	if err := c.DeleteTable(ctx, project, dataset, table); err != nil && !notFound(err) {
+		log.Printf("drop scratch table %s.%s.%s: %v", project, dataset, table, err)
+	}
+}
+
+// notFound reports whether err is a BigQuery "not found" error.
+func notFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
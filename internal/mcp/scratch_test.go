@@ -0,0 +1,202 @@
+package mcp
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/api/googleapi"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// scratchClient keeps the tables written by queries in memory.
+type scratchClient struct {
+	*bq.MockClient
+	mu      sync.Mutex
+	tables  map[string]*bigquery.TableMetadata
+	dst     *bq.Destination
+	dropped chan string
+	// running is called when a query starts.
+	running func()
+}
+
+func (c *scratchClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	if c.running != nil {
+		c.running()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dst = bq.QueryConfigFrom(ctx).Destination
+	if c.dst != nil {
+		c.tables[c.dst.Table] = &bigquery.TableMetadata{NumRows: 3, NumBytes: 24, CreationTime: time.Now(), ExpirationTime: c.dst.Expiration}
+	}
+	return &bq.QueryResult{JobID: "job_1"}, nil
+}
+
+func (c *scratchClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	for id := range c.tables {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (c *scratchClient) GetTableMetadata(ctx context.Context, projectID, datasetID, tableID string) (*bigquery.TableMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	meta, ok := c.tables[tableID]
+	if !ok {
+		return nil, &googleapi.Error{Code: 404}
+	}
+	return meta, nil
+}
+
+func (c *scratchClient) DeleteTable(ctx context.Context, projectID, datasetID, tableID string) error {
+	c.mu.Lock()
+	delete(c.tables, tableID)
+	c.mu.Unlock()
+	c.dropped <- projectID + "." + datasetID + "." + tableID
+	return nil
+}
+
+func TestCreateScratchTable(t *testing.T) {
+	client := &scratchClient{MockClient: &bq.MockClient{}, dropped: make(chan string, 10), tables: map[string]*bigquery.TableMetadata{
+		scratchPrefix("s2") + "other": {NumRows: 1},
+		"orders":                      {NumRows: 1},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "data.scratch", Expiration: 24 * time.Hour}))
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 1)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+
+	res, err := srv.createScratchTableHandler(ctx, mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "top", WriteDisposition: writeTruncate})
+	if err != nil {
+		t.Fatalf("createScratchTableHandler error: %v", err)
+	}
+	table := scratchPrefix("s1") + "top"
+	out := res.StructuredContent.(scratchTableOutput)
+	if out.Table != "data.scratch."+table || out.Name != "top" || out.Rows != 3 || out.JobID != "job_1" || out.Expires == "" {
+		t.Errorf("create_scratch_table = %+v", out)
+	}
+	dst := client.dst
+	if dst == nil || dst.Project != "data" || dst.Dataset != "scratch" || dst.Table != table || dst.WriteDisposition != bigquery.WriteTruncate {
+		t.Fatalf("destination = %+v", dst)
+	}
+	if exp := time.Until(dst.Expiration); exp > 24*time.Hour || exp < 23*time.Hour {
+		t.Errorf("expiration in %v, want 24 hours", exp)
+	}
+
+	res, err = srv.listScratchTablesHandler(ctx, mcp.CallToolRequest{}, listScratchTablesArgs{})
+	if err != nil {
+		t.Fatalf("listScratchTablesHandler error: %v", err)
+	}
+	if tables := res.StructuredContent.(listScratchTablesOutput).Tables; len(tables) != 1 || tables[0].Name != "top" {
+		t.Errorf("list_scratch_tables = %+v", tables)
+	}
+	res, _ = srv.listScratchTablesHandler(ctx, mcp.CallToolRequest{}, listScratchTablesArgs{All: true})
+	if tables := res.StructuredContent.(listScratchTablesOutput).Tables; len(tables) != 2 {
+		t.Errorf("list_scratch_tables all = %+v, want the tables of both sessions", tables)
+	}
+
+	if _, err := srv.createScratchTableHandler(ctx, mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "a.b"}); err == nil {
+		t.Error("invalid table name accepted")
+	}
+
+	srv.MCPServer().UnregisterSession(context.Background(), "s1")
+	select {
+	case got := <-client.dropped:
+		if got != "data.scratch."+table {
+			t.Errorf("dropped %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scratch table not dropped at session end")
+	}
+}
+
+func TestScratchTablesDroppedAtShutdown(t *testing.T) {
+	client := &scratchClient{MockClient: &bq.MockClient{}, tables: make(map[string]*bigquery.TableMetadata), dropped: make(chan string, 10)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "data.scratch"}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	if _, err := srv.createScratchTableHandler(ctx, mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "t"}); err != nil {
+		t.Fatalf("createScratchTableHandler error: %v", err)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	if len(client.dropped) != 1 || len(client.tables) != 0 {
+		t.Errorf("dropped %d tables, %d left", len(client.dropped), len(client.tables))
+	}
+}
+
+func TestScratchTableOfEndedSession(t *testing.T) {
+	client := &scratchClient{MockClient: &bq.MockClient{}, tables: make(map[string]*bigquery.TableMetadata), dropped: make(chan string, 10)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "data.scratch"}))
+	session := &testSession{id: "s1"}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	// The session ends while the query writes the table.
+	client.running = func() { srv.MCPServer().UnregisterSession(context.Background(), "s1") }
+
+	_, err := srv.createScratchTableHandler(ctx, mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "t"})
+	if err == nil || !strings.Contains(err.Error(), "session ended") {
+		t.Errorf("expected ended session error, got %v", err)
+	}
+	select {
+	case got := <-client.dropped:
+		if got != "data.scratch."+scratchPrefix("s1")+"t" {
+			t.Errorf("dropped %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("table of the ended session not dropped")
+	}
+	if ids := srv.scratchTables.sessions(); len(ids) != 0 {
+		t.Errorf("tables registered for ended sessions %v", ids)
+	}
+}
+
+func TestScratchRequiresWriteMode(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p",
+		WithScratchDataset(ScratchConfig{Dataset: "data.scratch"}))
+	for _, name := range []string{"create_scratch_table", "list_scratch_tables"} {
+		if srv.MCPServer().GetTool(name) != nil {
+			t.Errorf("%s registered without write mode", name)
+		}
+	}
+	_, err := srv.createScratchTableHandler(context.Background(), mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "t"})
+	if err == nil || !strings.Contains(err.Error(), "write mode") {
+		t.Errorf("expected write mode error, got %v", err)
+	}
+}
+
+func TestScratchRequiresSession(t *testing.T) {
+	client := &scratchClient{MockClient: &bq.MockClient{}, tables: make(map[string]*bigquery.TableMetadata)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p",
+		WithWriteMode(true), WithScratchDataset(ScratchConfig{Dataset: "data.scratch"}))
+	_, err := srv.createScratchTableHandler(context.Background(), mcp.CallToolRequest{}, createScratchTableArgs{SQL: "SELECT 1", Name: "t"})
+	if err == nil || !strings.Contains(err.Error(), "requires an MCP session") {
+		t.Errorf("expected session error, got %v", err)
+	}
+	if len(client.tables) != 0 {
+		t.Errorf("created %d tables without a session", len(client.tables))
+	}
+}
@@ -0,0 +1,337 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+const (
+	searchSourceInformationSchema = "information_schema"
+	searchSourceSchemas           = "schemas"
+)
+
+// identifierPattern matches dataset and region names that can be quoted
+// safely with backticks.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// legacyTypeNames maps legacy SQL type names, as used in table schemas, to
+// the GoogleSQL names reported by INFORMATION_SCHEMA.
+var legacyTypeNames = map[string]string{
+	"INTEGER": "INT64",
+	"FLOAT":   "FLOAT64",
+	"BOOLEAN": "BOOL",
+	"RECORD":  "STRUCT",
+}
+
+type searchColumnsArgs struct {
+	DatasetProject string   `json:"dataset_project,omitempty"`
+	Datasets       []string `json:"datasets,omitempty"`
+	Region         string   `json:"region,omitempty"`
+	NamePattern    string   `json:"name_pattern,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Source         string   `json:"source,omitempty"`
+}
+
+// columnMatch is a column or nested field found by search_columns.
+type columnMatch struct {
+	Table       string `json:"table"`
+	FieldPath   string `json:"field_path"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+type searchColumnsOutput struct {
+	Matches   []columnMatch `json:"matches"`
+	Truncated bool          `json:"truncated"`
+	Source    string        `json:"source"`
+}
+
+// columnCriteria holds the search criteria; empty criteria match anything.
+type columnCriteria struct {
+	name        *regexp.Regexp
+	typ         string
+	description string
+}
+
+func (c columnCriteria) match(path, typ, description string) bool {
+	if c.name != nil && !c.name.MatchString(path) {
+		return false
+	}
+	if c.typ != "" && !strings.HasPrefix(strings.ToUpper(typ), c.typ) {
+		return false
+	}
+	if c.description != "" && !strings.Contains(strings.ToLower(description), strings.ToLower(c.description)) {
+		return false
+	}
+	return true
+}
+
+// searchColumnsHandler finds columns by name pattern, type prefix or
+// description substring across datasets. By default it queries
+// INFORMATION_SCHEMA.COLUMN_FIELD_PATHS; with source "schemas" it walks
+// table schemas instead, which are served from the metadata cache.
+func (s *Server) searchColumnsHandler(ctx context.Context, _ mcp.CallToolRequest, args searchColumnsArgs) (*mcp.CallToolResult, error) {
+	if args.NamePattern == "" && args.Type == "" && args.Description == "" {
+		return nil, fmt.Errorf("at least one of name_pattern, type or description is required")
+	}
+	crit := columnCriteria{description: args.Description}
+	if args.NamePattern != "" {
+		re, err := regexp.Compile("(?i)" + args.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name_pattern: %w", err)
+		}
+		crit.name = re
+	}
+	if args.Type != "" {
+		crit.typ = strings.ToUpper(args.Type)
+		if t, ok := legacyTypeNames[crit.typ]; ok {
+			crit.typ = t
+		}
+	}
+	c, err := s.bqClientProvider(ctx, s.clientProject)
+	if err != nil {
+		return nil, err
+	}
+	project := args.DatasetProject
+	if project == "" {
+		project = s.clientProject
+	}
+
+	out := &searchColumnsOutput{Matches: []columnMatch{}, Source: args.Source}
+	switch args.Source {
+	case "", searchSourceInformationSchema:
+		out.Source = searchSourceInformationSchema
+		err = s.searchInformationSchema(ctx, c, project, args, crit, out)
+	case searchSourceSchemas:
+		if args.Region != "" {
+			return nil, fmt.Errorf("region is only supported with source %q", searchSourceInformationSchema)
+		}
+		err = s.searchSchemas(ctx, c, project, args.Datasets, crit, out)
+	default:
+		return nil, fmt.Errorf("unknown source %q", args.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Matches) > defaultRowLimit {
+		out.Matches = out.Matches[:defaultRowLimit]
+		out.Truncated = true
+	}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
+
+// searchDatasets resolves the datasets to search as "project.dataset"
+// entries: the requested ones, the configured ones, or all datasets of
+// project.
+func (s *Server) searchDatasets(ctx context.Context, c bq.Client, project string, requested []string) ([]string, error) {
+	qualify := func(ds string) string {
+		if strings.Contains(ds, ".") {
+			return ds
+		}
+		return project + "." + ds
+	}
+	var datasets []string
+	switch {
+	case len(requested) > 0:
+		for _, ds := range requested {
+			datasets = append(datasets, qualify(ds))
+		}
+	case len(s.datasets) > 0:
+		for _, ds := range s.datasets {
+			if p, _ := s.splitDataset(ds); p == project {
+				datasets = append(datasets, qualify(ds))
+			}
+		}
+	default:
+		ids, err := c.ListDatasets(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			datasets = append(datasets, project+"."+id)
+		}
+	}
+	return datasets, nil
+}
+
+func (s *Server) searchInformationSchema(ctx context.Context, c bq.Client, project string, args searchColumnsArgs, crit columnCriteria, out *searchColumnsOutput) error {
+	var sources, scope []string
+	// Filter tables in SQL so that filtered tables do not count against the
+	// row limit.
+	if s.tableFilter != nil {
+		scope = append(scope, fmt.Sprintf("REGEXP_CONTAINS(table_name, %s)", sqlString(s.tableFilter.String())))
+	}
+	if args.Region != "" {
+		if !identifierPattern.MatchString(args.Region) || strings.ContainsAny(project, "`\\") {
+			return fmt.Errorf("invalid region %q", args.Region)
+		}
+		sources = append(sources, fmt.Sprintf("`%s`.`region-%s`", project, strings.TrimPrefix(strings.ToLower(args.Region), "region-")))
+		// A region covers every dataset of project; restrict it to the
+		// requested or configured ones.
+		if len(args.Datasets) > 0 || len(s.datasets) > 0 {
+			datasets, err := s.searchDatasets(ctx, c, project, args.Datasets)
+			if err != nil {
+				return err
+			}
+			var names []string
+			for _, ds := range datasets {
+				if p, d := s.splitDataset(ds); p == project {
+					names = append(names, sqlString(d))
+				}
+			}
+			if len(names) == 0 {
+				return nil
+			}
+			scope = append(scope, fmt.Sprintf("table_schema IN (%s)", strings.Join(names, ", ")))
+		}
+	} else {
+		datasets, err := s.searchDatasets(ctx, c, project, args.Datasets)
+		if err != nil {
+			return err
+		}
+		for _, ds := range datasets {
+			p, d := s.splitDataset(ds)
+			if !identifierPattern.MatchString(d) || strings.ContainsAny(p, "`\\") {
+				return fmt.Errorf("invalid dataset %q", ds)
+			}
+			sources = append(sources, fmt.Sprintf("`%s`.`%s`", p, d))
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	sql := columnSearchSQL(sources, scope, args, crit)
+	if maxBytes := maxQueryBytes(); maxBytes > 0 {
+		stats, err := c.DryRunQuery(ctx, sql)
+		if err != nil {
+			return err
+		}
+		if stats.TotalBytesProcessed > maxBytes {
+			return fmt.Errorf("column search would scan %d bytes (limit %d)", stats.TotalBytesProcessed, maxBytes)
+		}
+	}
+	// Skip the result cache: INFORMATION_SCHEMA is not versioned by the
+	// last modified time of a table, so cached results would go stale.
+	res, err := c.RunQuery(bq.WithoutResultCache(ctx), sql)
+	if err != nil {
+		return err
+	}
+	for _, row := range res.Rows {
+		table := fmt.Sprint(row["table_name"])
+		// Check again in case the SQL and Go regular expression dialects
+		// disagree.
+		if s.tableFilter != nil && !s.tableFilter.MatchString(table) {
+			continue
+		}
+		m := columnMatch{
+			Table:     fmt.Sprintf("%v.%v.%s", row["table_catalog"], row["table_schema"], table),
+			FieldPath: fmt.Sprint(row["field_path"]),
+			Type:      fmt.Sprint(row["data_type"]),
+		}
+		if d, ok := row["description"].(string); ok {
+			m.Description = d
+		}
+		out.Matches = append(out.Matches, m)
+	}
+	return nil
+}
+
+// columnSearchSQL builds a query over COLUMN_FIELD_PATHS of each source,
+// which is either a dataset or a region qualifier, restricted by the scope
+// conditions. One extra row is requested so that truncation can be detected.
+func columnSearchSQL(sources, scope []string, args searchColumnsArgs, crit columnCriteria) string {
+	conds := append([]string(nil), scope...)
+	if args.NamePattern != "" {
+		conds = append(conds, fmt.Sprintf("REGEXP_CONTAINS(field_path, %s)", sqlString("(?i)"+args.NamePattern)))
+	}
+	if crit.typ != "" {
+		conds = append(conds, fmt.Sprintf("STARTS_WITH(UPPER(data_type), %s)", sqlString(crit.typ)))
+	}
+	if crit.description != "" {
+		conds = append(conds, fmt.Sprintf("CONTAINS_SUBSTR(description, %s)", sqlString(crit.description)))
+	}
+	where := strings.Join(conds, " AND ")
+	selects := make([]string, len(sources))
+	for i, src := range sources {
+		selects[i] = fmt.Sprintf("SELECT table_catalog, table_schema, table_name, field_path, data_type, description\nFROM %s.INFORMATION_SCHEMA.COLUMN_FIELD_PATHS\nWHERE %s", src, where)
+	}
+	return strings.Join(selects, "\nUNION ALL\n") + fmt.Sprintf("\nORDER BY table_catalog, table_schema, table_name, field_path\nLIMIT %d", defaultRowLimit+1)
+}
+
+// sqlString quotes s as a GoogleSQL string literal.
+func sqlString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// searchSchemas walks the schemas of all tables in the datasets. Listings and
+// schemas are served from the metadata cache when it is enabled, so repeated
+// searches do not contact BigQuery. All tables are walked so that the
+// matches kept after sorting are the same as with INFORMATION_SCHEMA.
+func (s *Server) searchSchemas(ctx context.Context, c bq.Client, project string, requested []string, crit columnCriteria, out *searchColumnsOutput) error {
+	datasets, err := s.searchDatasets(ctx, c, project, requested)
+	if err != nil {
+		return err
+	}
+	for _, ds := range datasets {
+		p, d := s.splitDataset(ds)
+		tables, err := c.ListTables(ctx, p, d)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if s.tableFilter != nil && !s.tableFilter.MatchString(t) {
+				continue
+			}
+			schema, err := c.GetTableSchema(ctx, p, d, t)
+			if err != nil {
+				return err
+			}
+			table := p + "." + d + "." + t
+			walkFields(schema, "", func(path string, f *bigquery.FieldSchema) {
+				typ := googleSQLType(f)
+				if crit.match(path, typ, f.Description) {
+					out.Matches = append(out.Matches, columnMatch{Table: table, FieldPath: path, Type: typ, Description: f.Description})
+				}
+			})
+		}
+	}
+	sort.Slice(out.Matches, func(i, j int) bool {
+		a, b := out.Matches[i], out.Matches[j]
+		return a.Table < b.Table || a.Table == b.Table && a.FieldPath < b.FieldPath
+	})
+	return nil
+}
+
+// walkFields calls fn for every field of schema, including nested fields,
+// with its dotted path.
+func walkFields(schema bigquery.Schema, prefix string, fn func(path string, f *bigquery.FieldSchema)) {
+	for _, f := range schema {
+		fn(prefix+f.Name, f)
+		walkFields(f.Schema, prefix+f.Name+".", fn)
+	}
+}
+
+// googleSQLType returns the GoogleSQL type name of f as reported by
+// INFORMATION_SCHEMA, without the field types of STRUCTs.
+func googleSQLType(f *bigquery.FieldSchema) string {
+	t := string(f.Type)
+	if n, ok := legacyTypeNames[t]; ok {
+		t = n
+	}
+	if f.Repeated {
+		t = "ARRAY<" + t + ">"
+	}
+	return t
+}
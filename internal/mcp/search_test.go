@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func TestSearchColumnsInformationSchema(t *testing.T) {
+	rec := &sqlRecorder{MockClient: &bq.MockClient{
+		DatasetsRes: []string{"sales", "crm"},
+		QueryRes: []map[string]bigquery.Value{
+			{"table_catalog": "p", "table_schema": "sales", "table_name": "orders", "field_path": "customer_id", "data_type": "INT64", "description": nil},
+			{"table_catalog": "p", "table_schema": "crm", "table_name": "secret_customers", "field_path": "id", "data_type": "INT64", "description": "customer id"},
+		},
+	}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p", WithTableFilter(regexp.MustCompile("^[^s]")))
+
+	res, err := srv.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, searchColumnsArgs{NamePattern: "customer", Type: "integer"})
+	if err != nil {
+		t.Fatalf("searchColumnsHandler error: %v", err)
+	}
+	sql := rec.queries[0]
+	for _, want := range []string{"FROM `p`.`sales`.INFORMATION_SCHEMA.COLUMN_FIELD_PATHS", "UNION ALL", "FROM `p`.`crm`.INFORMATION_SCHEMA",
+		`REGEXP_CONTAINS(field_path, "(?i)customer")`, `STARTS_WITH(UPPER(data_type), "INT64")`, `REGEXP_CONTAINS(table_name, "^[^s]")`, "LIMIT 101"} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("search SQL missing %q:\n%s", want, sql)
+		}
+	}
+	out := res.StructuredContent.(*searchColumnsOutput)
+	if len(out.Matches) != 1 || out.Matches[0].Table != "p.sales.orders" || out.Matches[0].FieldPath != "customer_id" {
+		t.Fatalf("unexpected matches: %+v", out.Matches)
+	}
+
+	if _, err := srv.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, searchColumnsArgs{Region: "US", Description: `say "hi"`}); err != nil {
+		t.Fatalf("searchColumnsHandler error: %v", err)
+	}
+	if sql := rec.queries[1]; !strings.Contains(sql, "FROM `p`.`region-us`.INFORMATION_SCHEMA") || !strings.Contains(sql, `CONTAINS_SUBSTR(description, "say \"hi\"")`) {
+		t.Fatalf("unexpected region search SQL:\n%s", sql)
+	}
+	restricted := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return rec, nil }, "p", WithDatasets([]string{"sales", "other.crm"}))
+	if _, err := restricted.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, searchColumnsArgs{Region: "US", NamePattern: "id"}); err != nil {
+		t.Fatalf("searchColumnsHandler error: %v", err)
+	}
+	if sql := rec.queries[2]; !strings.Contains(sql, `table_schema IN ("sales")`) {
+		t.Fatalf("region search ignores the configured datasets:\n%s", sql)
+	}
+	if _, err := srv.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, searchColumnsArgs{Datasets: []string{"a`b"}, NamePattern: "x"}); err == nil {
+		t.Fatal("expected invalid dataset to be rejected")
+	}
+	if _, err := srv.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, searchColumnsArgs{}); err == nil {
+		t.Fatal("expected missing criteria to be rejected")
+	}
+}
+
+func TestSearchColumnsSchemas(t *testing.T) {
+	mock := &bq.MockClient{
+		TablesRes: []string{"orders"},
+		SchemaRes: bigquery.Schema{
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "customer", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "customer_id", Type: bigquery.StringFieldType, Description: "Customer key"},
+				{Name: "emails", Type: bigquery.StringFieldType, Repeated: true},
+			}},
+		},
+	}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p")
+
+	search := func(args searchColumnsArgs) []columnMatch {
+		t.Helper()
+		args.Source = searchSourceSchemas
+		args.Datasets = []string{"other.sales"}
+		res, err := srv.searchColumnsHandler(context.Background(), mcp.CallToolRequest{}, args)
+		if err != nil {
+			t.Fatalf("searchColumnsHandler error: %v", err)
+		}
+		return res.StructuredContent.(*searchColumnsOutput).Matches
+	}
+	if m := search(searchColumnsArgs{NamePattern: "CUSTOMER_ID$"}); len(m) != 1 || m[0].Table != "other.sales.orders" || m[0].FieldPath != "customer.customer_id" {
+		t.Fatalf("unexpected name matches: %+v", m)
+	}
+	if m := search(searchColumnsArgs{Type: "int64"}); len(m) != 1 || m[0].FieldPath != "id" {
+		t.Fatalf("unexpected type matches: %+v", m)
+	}
+	if m := search(searchColumnsArgs{Type: "array"}); len(m) != 1 || m[0].Type != "ARRAY<STRING>" {
+		t.Fatalf("unexpected array matches: %+v", m)
+	}
+	if m := search(searchColumnsArgs{Description: "key"}); len(m) != 1 || m[0].Description != "Customer key" {
+		t.Fatalf("unexpected description matches: %+v", m)
+	}
+}
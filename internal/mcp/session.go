@@ -0,0 +1,243 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// abortSessionTimeout bounds the query aborting the BigQuery session of an
+// ended MCP session.
+const abortSessionTimeout = 30 * time.Second
+
+// sessionContext holds the defaults set by set_context for one MCP session
+// and the BigQuery session its queries run in.
+type sessionContext struct {
+	DatasetProject  string            `json:"dataset_project,omitempty"`
+	Dataset         string            `json:"dataset,omitempty"`
+	Location        string            `json:"location,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	BigQuerySession string            `json:"bigquery_session_id,omitempty"`
+	sessionLocation string
+}
+
+type setContextArgs struct {
+	DatasetProject string            `json:"dataset_project,omitempty"`
+	Dataset        string            `json:"dataset,omitempty"`
+	Location       string            `json:"location,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Reset          bool              `json:"reset,omitempty"`
+}
+
+type getContextArgs struct{}
+
+// sessionStore keeps the context of each MCP session. Calls made outside of
+// a session, such as those of stateless HTTP clients, have no context.
+type sessionStore struct {
+	mu       sync.Mutex
+	contexts map[string]sessionContext
+}
+
+func (st *sessionStore) get(sessionID string) sessionContext {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c := st.contexts[sessionID]
+	c.Labels = maps.Clone(c.Labels)
+	return c
+}
+
+// add creates the empty context of a new session.
+func (st *sessionStore) add(sessionID string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.contexts == nil {
+		st.contexts = make(map[string]sessionContext)
+	}
+	if _, ok := st.contexts[sessionID]; !ok {
+		st.contexts[sessionID] = sessionContext{}
+	}
+}
+
+// update applies fn to the context of a session and returns the result. It
+// reports false and leaves the store alone when the session is not live, so
+// that a call finishing after its session ended does not bring the context
+// back.
+func (st *sessionStore) update(sessionID string, fn func(*sessionContext)) (sessionContext, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, ok := st.contexts[sessionID]
+	if !ok {
+		return sessionContext{}, false
+	}
+	fn(&c)
+	st.contexts[sessionID] = c
+	c.Labels = maps.Clone(c.Labels)
+	return c, true
+}
+
+// remove drops the context of a session and returns it.
+func (st *sessionStore) remove(sessionID string) sessionContext {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c := st.contexts[sessionID]
+	delete(st.contexts, sessionID)
+	return c
+}
+
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// registerSessions installs the context tools and the hook that clears the
+// context of a session when it ends.
+func (s *Server) registerSessions(hooks *server.Hooks) {
+	s.mcpServer.AddTool(mcp.NewTool(
+		"set_context",
+		mcp.WithDescription("Set defaults for the rest of this session: the project and dataset used when a tool's dataset_project or dataset is omitted and to resolve unqualified table names in SQL, the query location and job labels"),
+		mcp.WithString("dataset_project", mcp.Description("Default project of datasets")),
+		mcp.WithString("dataset", mcp.Description("Default dataset")),
+		mcp.WithString("location", mcp.Description("Location of query jobs, e.g. US or asia-northeast1")),
+		mcp.WithObject("labels", mcp.Description("Labels attached to query jobs"), mcp.AdditionalProperties(map[string]any{"type": "string"})),
+		mcp.WithBoolean("reset", mcp.Description("Clear all defaults before applying the given ones")),
+		mcp.WithRawOutputSchema(contextOutputSchema),
+	), mcp.NewTypedToolHandler(s.setContextHandler))
+
+	s.mcpServer.AddTool(mcp.NewTool(
+		"get_context",
+		mcp.WithDescription("Show the defaults set with set_context for this session"),
+		mcp.WithRawOutputSchema(contextOutputSchema),
+	), mcp.NewTypedToolHandler(s.getContextHandler))
+
+	hooks.AddOnRegisterSession(func(_ context.Context, session server.ClientSession) {
+		s.sessions.add(session.SessionID())
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		c := s.sessions.remove(session.SessionID())
+		if c.BigQuerySession != "" {
+			go s.abortSession(c)
+		}
+	})
+}
+
+// abortSession terminates the BigQuery session of an ended MCP session, so
+// that its temporary tables are dropped without waiting for the session to
+// expire. Failures are only logged.
+func (s *Server) abortSession(c sessionContext) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortSessionTimeout)
+	defer cancel()
+	client, err := s.bqClientProvider(ctx, s.clientProject)
+	if err == nil {
+		ctx = bigquery.WithQueryConfig(bigquery.WithoutResultCache(ctx), bigquery.QueryConfig{SessionID: c.BigQuerySession, Location: c.sessionLocation})
+		_, err = client.RunQuery(ctx, "CALL BQ.ABORT_SESSION()")
+	}
+	if err != nil {
+		log.Printf("abort BigQuery session %s: %v", c.BigQuerySession, err)
+	}
+}
+
+func (s *Server) setContextHandler(ctx context.Context, _ mcp.CallToolRequest, args setContextArgs) (*mcp.CallToolResult, error) {
+	if sessionID(ctx) == "" {
+		return nil, errors.New("set_context requires an MCP session")
+	}
+	c, live := s.sessions.update(sessionID(ctx), func(c *sessionContext) {
+		if args.Reset {
+			// The BigQuery session is not a default and outlives a reset.
+			*c = sessionContext{BigQuerySession: c.BigQuerySession, sessionLocation: c.sessionLocation}
+		}
+		if args.DatasetProject != "" {
+			c.DatasetProject = args.DatasetProject
+		}
+		if args.Dataset != "" {
+			c.Dataset = args.Dataset
+		}
+		if args.Location != "" {
+			c.Location = args.Location
+		}
+		for k, v := range args.Labels {
+			if c.Labels == nil {
+				c.Labels = make(map[string]string)
+			}
+			c.Labels[k] = v
+		}
+	})
+	if !live {
+		return nil, errors.New("the MCP session has ended")
+	}
+	return contextResult(c), nil
+}
+
+func (s *Server) getContextHandler(ctx context.Context, _ mcp.CallToolRequest, _ getContextArgs) (*mcp.CallToolResult, error) {
+	if sessionID(ctx) == "" {
+		return nil, errors.New("get_context requires an MCP session")
+	}
+	return contextResult(s.sessions.get(sessionID(ctx))), nil
+}
+
+func contextResult(c sessionContext) *mcp.CallToolResult {
+	data, _ := json.Marshal(c)
+	return mcp.NewToolResultStructured(c, string(data))
+}
+
+// resolveDataset fills in the dataset project and dataset of a tool call
+// from the session defaults, falling back to the client project.
+func (s *Server) resolveDataset(ctx context.Context, project, dataset string) (string, string, error) {
+	c := s.sessions.get(sessionID(ctx))
+	if project == "" {
+		project = c.DatasetProject
+	}
+	if project == "" {
+		project = s.clientProject
+	}
+	if dataset == "" {
+		dataset = c.Dataset
+	}
+	if dataset == "" {
+		return "", "", errors.New("dataset is required; pass it or set a default with set_context")
+	}
+	return project, dataset, nil
+}
+
+// queryContext attaches the session defaults and job labels to ctx for the
+// query jobs run on behalf of a call of tool. With BigQuery sessions enabled, queries run in
+// the BigQuery session of the MCP session once the query tool started one.
+func (s *Server) queryContext(ctx context.Context, tool string) context.Context {
+	c := s.sessions.get(sessionID(ctx))
+	cfg := bigquery.QueryConfig{Location: c.Location, Labels: s.jobLabels(ctx, tool, c.Labels), TagSQL: s.labels.TagSQL}
+	if c.Dataset != "" {
+		cfg.DefaultDataset = c.Dataset
+		cfg.DefaultProject = c.DatasetProject
+		if cfg.DefaultProject == "" {
+			cfg.DefaultProject = s.clientProject
+		}
+	}
+	if s.bqSessions && c.BigQuerySession != "" {
+		cfg.SessionID = c.BigQuerySession
+		// A session is bound to the location it was created in.
+		if c.sessionLocation != "" {
+			cfg.Location = c.sessionLocation
+		}
+	}
+	return bigquery.WithQueryConfig(ctx, cfg)
+}
+
+// WithBigQuerySessions makes the query tools of each MCP session run in a
+// BigQuery session, created by the first query, so that temporary tables
+// and variables persist across calls. The session is aborted when the MCP
+// session ends.
+func WithBigQuerySessions(enabled bool) Option {
+	return func(s *Server) {
+		s.bqSessions = enabled
+	}
+}
@@ -0,0 +1,297 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+// contextClient records the dataset and query settings of its calls.
+type contextClient struct {
+	*bq.MockClient
+	project, dataset string
+	cfg              bq.QueryConfig
+}
+
+func (c *contextClient) ListTables(ctx context.Context, projectID, datasetID string) ([]string, error) {
+	c.project, c.dataset = projectID, datasetID
+	return c.MockClient.ListTables(ctx, projectID, datasetID)
+}
+
+func (c *contextClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	c.cfg = bq.QueryConfigFrom(ctx)
+	return c.MockClient.RunQuery(ctx, sql)
+}
+
+func TestSessionContext(t *testing.T) {
+	client := &contextClient{MockClient: &bq.MockClient{TablesRes: []string{"t"}}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p")
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 1)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+
+	if _, err := srv.tablesHandler(ctx, mcp.CallToolRequest{}, tablesArgs{}); err == nil || !strings.Contains(err.Error(), "set_context") {
+		t.Fatalf("expected missing dataset error, got %v", err)
+	}
+	if _, err := srv.setContextHandler(ctx, mcp.CallToolRequest{}, setContextArgs{
+		DatasetProject: "data", Dataset: "sales", Location: "EU", Labels: map[string]string{"team": "bi"},
+	}); err != nil {
+		t.Fatalf("setContextHandler error: %v", err)
+	}
+	if _, err := srv.tablesHandler(ctx, mcp.CallToolRequest{}, tablesArgs{}); err != nil {
+		t.Fatalf("tablesHandler error: %v", err)
+	}
+	if client.project != "data" || client.dataset != "sales" {
+		t.Errorf("tables listed %s.%s, want data.sales", client.project, client.dataset)
+	}
+	if _, err := srv.tablesHandler(ctx, mcp.CallToolRequest{}, tablesArgs{Dataset: "other"}); err != nil || client.dataset != "other" {
+		t.Errorf("explicit dataset not used: %s %v", client.dataset, err)
+	}
+	if _, err := srv.queryHandler(ctx, mcp.CallToolRequest{}, queryArgs{SQL: "SELECT * FROM orders"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	want := bq.QueryConfig{DefaultProject: "data", DefaultDataset: "sales", Location: "EU", Labels: map[string]string{"team": "bi"}}
+	if client.cfg.DefaultProject != want.DefaultProject || client.cfg.DefaultDataset != want.DefaultDataset ||
+		client.cfg.Location != want.Location || client.cfg.Labels["team"] != "bi" {
+		t.Errorf("query config = %+v, want %+v", client.cfg, want)
+	}
+
+	// Other sessions do not see the context.
+	if _, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	if client.cfg.DefaultDataset != "" {
+		t.Errorf("context leaked to another session: %+v", client.cfg)
+	}
+
+	res, err := srv.getContextHandler(ctx, mcp.CallToolRequest{}, getContextArgs{})
+	if err != nil {
+		t.Fatalf("getContextHandler error: %v", err)
+	}
+	if got := res.StructuredContent.(sessionContext); got.Dataset != "sales" || got.Location != "EU" {
+		t.Errorf("get_context = %+v", got)
+	}
+	res, _ = srv.setContextHandler(ctx, mcp.CallToolRequest{}, setContextArgs{Reset: true, Dataset: "tmp"})
+	if got := res.StructuredContent.(sessionContext); got.Dataset != "tmp" || got.DatasetProject != "" || got.Labels != nil {
+		t.Errorf("reset context = %+v", got)
+	}
+
+	srv.MCPServer().UnregisterSession(context.Background(), "s1")
+	if got := srv.sessions.get("s1"); got.Dataset != "" {
+		t.Errorf("context not cleared at session end: %+v", got)
+	}
+}
+
+// sessionClient starts a BigQuery session when asked to and reports the
+// session queries ran in.
+type sessionClient struct {
+	*bq.MockClient
+	mu      sync.Mutex
+	configs []bq.QueryConfig
+	aborted chan string
+	// created is called when a query creates a session.
+	created func()
+}
+
+func (c *sessionClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	cfg := bq.QueryConfigFrom(ctx)
+	c.mu.Lock()
+	c.configs = append(c.configs, cfg)
+	c.mu.Unlock()
+	if sql == "CALL BQ.ABORT_SESSION()" {
+		c.aborted <- cfg.SessionID
+		return &bq.QueryResult{}, nil
+	}
+	res := &bq.QueryResult{Location: "EU", SessionID: cfg.SessionID}
+	if cfg.CreateSession {
+		res.SessionID = "bq-session-1"
+		if c.created != nil {
+			c.created()
+		}
+	}
+	return res, nil
+}
+
+func TestSessionContextRequiresSession(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return &bq.MockClient{}, nil }, "p")
+	if _, err := srv.setContextHandler(context.Background(), mcp.CallToolRequest{}, setContextArgs{Dataset: "sales"}); err == nil || !strings.Contains(err.Error(), "MCP session") {
+		t.Errorf("expected session error, got %v", err)
+	}
+	if _, err := srv.getContextHandler(context.Background(), mcp.CallToolRequest{}, getContextArgs{}); err == nil || !strings.Contains(err.Error(), "MCP session") {
+		t.Errorf("expected session error, got %v", err)
+	}
+	if len(srv.sessions.contexts) != 0 {
+		t.Errorf("contexts stored without a session: %v", srv.sessions.contexts)
+	}
+}
+
+func TestBigQuerySessions(t *testing.T) {
+	client := &sessionClient{MockClient: &bq.MockClient{}, aborted: make(chan string, 1)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p", WithBigQuerySessions(true))
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 1)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+
+	for _, sql := range []string{"CREATE TEMP TABLE t AS SELECT 1 AS x", "SELECT * FROM t"} {
+		res, err := srv.queryHandler(ctx, mcp.CallToolRequest{}, queryArgs{SQL: sql})
+		if err != nil {
+			t.Fatalf("queryHandler error: %v", err)
+		}
+		if got := res.StructuredContent.(queryOutput).Metadata.SessionID; got != "bq-session-1" {
+			t.Errorf("session_id = %q", got)
+		}
+	}
+	if !client.configs[0].CreateSession || client.configs[0].SessionID != "" {
+		t.Errorf("first query config = %+v, want a new session", client.configs[0])
+	}
+	if client.configs[1].CreateSession || client.configs[1].SessionID != "bq-session-1" || client.configs[1].Location != "EU" {
+		t.Errorf("second query config = %+v, want session bq-session-1 in EU", client.configs[1])
+	}
+	res, _ := srv.getContextHandler(ctx, mcp.CallToolRequest{}, getContextArgs{})
+	if got := res.StructuredContent.(sessionContext).BigQuerySession; got != "bq-session-1" {
+		t.Errorf("get_context session = %q", got)
+	}
+
+	srv.MCPServer().UnregisterSession(context.Background(), "s1")
+	select {
+	case id := <-client.aborted:
+		if id != "bq-session-1" {
+			t.Errorf("aborted session %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("BigQuery session not aborted at session end")
+	}
+}
+
+func TestBigQuerySessionsWithoutMCPSession(t *testing.T) {
+	client := &sessionClient{MockClient: &bq.MockClient{}, aborted: make(chan string, 1)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p", WithBigQuerySessions(true))
+	if _, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	if client.configs[0].CreateSession {
+		t.Error("session created for a call without an MCP session")
+	}
+}
+
+func TestBigQuerySessionsRace(t *testing.T) {
+	client := &sessionClient{MockClient: &bq.MockClient{}, aborted: make(chan string, 1)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p", WithBigQuerySessions(true))
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 1)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	// A concurrent first query records its session while this one runs.
+	client.created = func() {
+		srv.sessions.update("s1", func(c *sessionContext) { c.BigQuerySession = "bq-session-0" })
+	}
+	if _, err := srv.queryHandler(ctx, mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	select {
+	case id := <-client.aborted:
+		if id != "bq-session-1" {
+			t.Errorf("aborted session %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("losing BigQuery session not aborted")
+	}
+	if got := srv.sessions.get("s1").BigQuerySession; got != "bq-session-0" {
+		t.Errorf("kept session %q", got)
+	}
+}
+
+func TestBigQuerySessionsEndDuringQuery(t *testing.T) {
+	client := &sessionClient{MockClient: &bq.MockClient{}, aborted: make(chan string, 1)}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return client, nil }, "p", WithBigQuerySessions(true))
+	session := &testSession{id: "s1", notify: make(chan mcp.JSONRPCNotification, 1)}
+	if err := srv.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("register session: %v", err)
+	}
+	ctx := srv.MCPServer().WithContext(context.Background(), session)
+	started, release := make(chan struct{}), make(chan struct{})
+	client.created = func() {
+		close(started)
+		<-release
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := srv.queryHandler(ctx, mcp.CallToolRequest{}, queryArgs{SQL: "SELECT 1"})
+		done <- err
+	}()
+	<-started
+	srv.MCPServer().UnregisterSession(context.Background(), "s1")
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	select {
+	case id := <-client.aborted:
+		if id != "bq-session-1" {
+			t.Errorf("aborted session %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("BigQuery session of an ended MCP session not aborted")
+	}
+	srv.sessions.mu.Lock()
+	defer srv.sessions.mu.Unlock()
+	if _, ok := srv.sessions.contexts["s1"]; ok {
+		t.Error("context of the ended session was recreated")
+	}
+}
+
+type scriptClient struct {
+	*bq.MockClient
+}
+
+func (c *scriptClient) RunQuery(ctx context.Context, sql string) (*bq.QueryResult, error) {
+	schema := bigquery.Schema{{Name: "n", Type: bigquery.IntegerFieldType}}
+	return &bq.QueryResult{
+		Schema: schema,
+		Rows:   []map[string]bigquery.Value{{"n": int64(2)}},
+		JobID:  "script",
+		Statements: []*bq.StatementResult{
+			{JobID: "child1", StatementType: "INSERT", NumDMLAffectedRows: 3},
+			{JobID: "child2", StatementType: "SELECT", Schema: schema, Rows: []map[string]bigquery.Value{{"n": int64(1)}, {"n": int64(2)}, {"n": int64(3)}}, TotalRows: 5},
+		},
+	}, nil
+}
+
+func TestQueryHandlerScriptStatements(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) {
+		return &scriptClient{MockClient: &bq.MockClient{}}, nil
+	}, "p")
+	res, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "INSERT ...; SELECT ...", resultArgs: resultArgs{MaxRows: 2}})
+	if err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	statements := res.StructuredContent.(queryOutput).Statements
+	if len(statements) != 2 {
+		t.Fatalf("statements = %+v", statements)
+	}
+	if st := statements[0]; st.Index != 0 || st.StatementType != "INSERT" || st.NumDMLAffectedRows != 3 || st.Rows != nil {
+		t.Errorf("first statement = %+v", st)
+	}
+	if st := statements[1]; st.JobID != "child2" || len(st.Rows) != 2 || st.TotalRows != 5 || !st.Truncated {
+		t.Errorf("second statement = %+v", st)
+	}
+	if len(res.Content) != 3 {
+		t.Fatalf("expected rows, metadata and statements content, got %d items", len(res.Content))
+	}
+	tc, _ := mcp.AsTextContent(res.Content[2])
+	if !strings.Contains(tc.Text, `"job_id":"child1"`) {
+		t.Errorf("statements content = %s", tc.Text)
+	}
+}
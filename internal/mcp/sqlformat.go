@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqlfmt"
+)
+
+type formatSQLArgs struct {
+	SQL string `json:"sql"`
+}
+
+type formatSQLOutput struct {
+	SQL string `json:"sql"`
+}
+
+// WithQueryLog logs the SQL of every query and dry run. With format set,
+// the SQL is formatted first so that one-line queries stay readable in the
+// log.
+func WithQueryLog(format bool) Option {
+	return func(s *Server) {
+		s.queryLog = true
+		s.queryLogFormat = format
+	}
+}
+
+// logQuery logs sql for tool when query logging is enabled.
+func (s *Server) logQuery(tool, sql string) {
+	if !s.queryLog {
+		return
+	}
+	if s.queryLogFormat {
+		sql = "\n" + sqlfmt.Format(sql)
+	}
+	log.Printf("%s: %s", tool, sql)
+}
+
+// formatSQLHandler formats GoogleSQL for review. It needs no BigQuery
+// client.
+func (s *Server) formatSQLHandler(_ context.Context, _ mcp.CallToolRequest, args formatSQLArgs) (*mcp.CallToolResult, error) {
+	out := formatSQLOutput{SQL: sqlfmt.Format(args.SQL)}
+	data, _ := json.Marshal(out)
+	return mcp.NewToolResultStructured(out, string(data)), nil
+}
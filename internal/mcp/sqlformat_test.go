@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	bq "github.com/masudahiroto/bigquery-mcp-server/internal/bigquery"
+)
+
+func TestFormatSQLHandler(t *testing.T) {
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) {
+		t.Fatal("format_sql must not create a client")
+		return nil, nil
+	}, "p")
+	res, err := srv.formatSQLHandler(context.Background(), mcp.CallToolRequest{}, formatSQLArgs{SQL: "select a, b from `p.d.t` where a = 1"})
+	if err != nil {
+		t.Fatalf("formatSQLHandler error: %v", err)
+	}
+	want := "SELECT\n  a,\n  b\nFROM\n  `p.d.t`\nWHERE\n  a = 1"
+	if got := res.StructuredContent.(formatSQLOutput).SQL; got != want {
+		t.Fatalf("unexpected formatted SQL:\n%s", got)
+	}
+}
+
+func TestQueryLog(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	mock := &bq.MockClient{QueryRes: []map[string]bigquery.Value{{"id": "1"}}}
+	srv := NewServer(func(ctx context.Context, project string) (bq.Client, error) { return mock, nil }, "p", WithQueryLog(true))
+	if _, err := srv.queryHandler(context.Background(), mcp.CallToolRequest{}, queryArgs{SQL: "select id from ds.t"}); err != nil {
+		t.Fatalf("queryHandler error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "query: \nSELECT\n  id\nFROM\n  ds.t") {
+		t.Fatalf("unexpected log output: %q", buf.String())
+	}
+}
@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const (
+	// defaultResultBytes is the default response-size budget for query results.
+	defaultResultBytes = 64 * 1024
+	// maxRowLimit caps the max_rows argument regardless of the byte budget.
+	maxRowLimit = 10000
+	// bytesPerToken approximates the number of bytes per model token.
+	bytesPerToken = 4
+
+	maxStringBytes  = 1024
+	maxArrayItems   = 50
+	maxNestingDepth = 5
+)
+
+// resultMetadata describes how a query result was paged and truncated.
+type resultMetadata struct {
+	TotalRows       int       `json:"total_rows"`
+	StartRow        int       `json:"start_row"`
+	RowsReturned    int       `json:"rows_returned"`
+	Truncated       bool      `json:"truncated"`
+	TruncatedFields []string  `json:"truncated_fields,omitempty"`
+	NextStartRow    int       `json:"next_start_row,omitempty"`
+	Hint            string    `json:"hint,omitempty"`
+	CacheHit        bool      `json:"cache_hit,omitempty"`
+	JobID           string    `json:"job_id,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	Warnings        []finding `json:"warnings,omitempty"`
+	RedactedColumns []string  `json:"redacted_columns,omitempty"`
+}
+
+// truncator shortens oversized values and records the affected field paths.
+type truncator struct {
+	fields map[string]bool
+}
+
+func (t *truncator) mark(path string) {
+	if t.fields == nil {
+		t.fields = make(map[string]bool)
+	}
+	t.fields[path] = true
+}
+
+func (t *truncator) row(row map[string]bigquery.Value) map[string]bigquery.Value {
+	out := make(map[string]bigquery.Value, len(row))
+	for k, v := range row {
+		out[k] = t.value(k, v, 0)
+	}
+	return out
+}
+
+func (t *truncator) value(path string, v bigquery.Value, depth int) bigquery.Value {
+	switch x := v.(type) {
+	case string:
+		if len(x) <= maxStringBytes {
+			return x
+		}
+		t.mark(path)
+		cut := maxStringBytes
+		for cut > 0 && !utf8.RuneStart(x[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s…[%d bytes truncated]", x[:cut], len(x)-cut)
+	case []byte:
+		if len(x) <= maxStringBytes {
+			return x
+		}
+		t.mark(path)
+		return x[:maxStringBytes]
+	case []bigquery.Value:
+		// Omitted elements are only reported in truncated_fields: markers
+		// in the array would not match the element type of row_schema.
+		if depth >= maxNestingDepth {
+			t.mark(path)
+			return []bigquery.Value{}
+		}
+		n := len(x)
+		if n > maxArrayItems {
+			t.mark(path)
+			n = maxArrayItems
+		}
+		out := make([]bigquery.Value, 0, n)
+		for _, e := range x[:n] {
+			out = append(out, t.value(path+"[]", e, depth+1))
+		}
+		return out
+	case map[string]bigquery.Value:
+		if depth >= maxNestingDepth {
+			// row_schema allows null for records nested this deep.
+			t.mark(path)
+			return nil
+		}
+		out := make(map[string]bigquery.Value, len(x))
+		for k, e := range x {
+			out[k] = t.value(path+"."+k, e, depth+1)
+		}
+		return out
+	}
+	return v
+}
+
+// truncateRows selects rows starting at start, limited by maxRows and by an
+// approximate byte budget measured on the JSON encoding of each row. A budget
+// of zero disables the size limit. At least one row is returned when any are
+// available so that callers can always make progress.
+func truncateRows(rows []map[string]bigquery.Value, start, maxRows, budget int) ([]map[string]bigquery.Value, resultMetadata) {
+	meta := resultMetadata{TotalRows: len(rows), StartRow: start}
+	if start > len(rows) {
+		start = len(rows)
+		meta.StartRow = start
+	}
+	var t truncator
+	var out []map[string]bigquery.Value
+	used := 0
+	for _, row := range rows[start:] {
+		if len(out) >= maxRows {
+			break
+		}
+		r := t.row(row)
+		if budget > 0 {
+			data, _ := json.Marshal(r)
+			if len(out) > 0 && used+len(data)+1 > budget {
+				break
+			}
+			used += len(data) + 1
+		}
+		out = append(out, r)
+	}
+	meta.RowsReturned = len(out)
+	for f := range t.fields {
+		meta.TruncatedFields = append(meta.TruncatedFields, f)
+	}
+	sort.Strings(meta.TruncatedFields)
+	meta.paginate()
+	return out, meta
+}
+
+// paginate derives Truncated, NextStartRow and Hint from the row counts and
+// truncated fields.
+func (m *resultMetadata) paginate() {
+	m.Truncated, m.NextStartRow, m.Hint = false, 0, ""
+	next := m.StartRow + m.RowsReturned
+	if next < m.TotalRows {
+		m.Truncated = true
+		m.NextStartRow = next
+		m.Hint = fmt.Sprintf("%d more rows available; call the tool again with start_row=%d to fetch them", m.TotalRows-next, next)
+	}
+	if len(m.TruncatedFields) > 0 {
+		m.Truncated = true
+		hint := "long strings and arrays in truncated_fields were shortened and records nested too deep returned as null; select them explicitly (e.g. with SUBSTR or UNNEST) to see full values"
+		if m.Hint != "" {
+			m.Hint += "; " + hint
+		} else {
+			m.Hint = hint
+		}
+	}
+}
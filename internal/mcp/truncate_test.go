@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestTruncateRowsBudget(t *testing.T) {
+	var rows []map[string]bigquery.Value
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]bigquery.Value{"id": strconv.Itoa(i), "pad": strings.Repeat("x", 90)})
+	}
+	out, meta := truncateRows(rows, 0, 100, 350)
+	if len(out) != 3 {
+		t.Fatalf("expected 3 rows within budget, got %d", len(out))
+	}
+	if meta.TotalRows != 10 || meta.RowsReturned != 3 || !meta.Truncated || meta.NextStartRow != 3 {
+		t.Fatalf("unexpected metadata: %#v", meta)
+	}
+
+	out, meta = truncateRows(rows, 8, 100, 0)
+	if len(out) != 2 || out[0]["id"] != "8" {
+		t.Fatalf("unexpected page: %#v", out)
+	}
+	if meta.Truncated || meta.NextStartRow != 0 || meta.Hint != "" {
+		t.Fatalf("unexpected metadata for last page: %#v", meta)
+	}
+}
+
+func TestTruncateRowsAlwaysReturnsOneRow(t *testing.T) {
+	rows := []map[string]bigquery.Value{{"id": "1"}, {"id": "2"}}
+	out, meta := truncateRows(rows, 0, 100, 1)
+	if len(out) != 1 || meta.NextStartRow != 1 {
+		t.Fatalf("expected a single row, got %d (%#v)", len(out), meta)
+	}
+}
+
+func TestTruncateRowsValues(t *testing.T) {
+	var items []bigquery.Value
+	for i := 0; i < maxArrayItems+5; i++ {
+		items = append(items, int64(i))
+	}
+	rows := []map[string]bigquery.Value{{
+		"body":  strings.Repeat("é", maxStringBytes),
+		"items": items,
+		"addr":  map[string]bigquery.Value{"city": strings.Repeat("c", maxStringBytes+1)},
+	}}
+	out, meta := truncateRows(rows, 0, 100, 0)
+	body := out[0]["body"].(string)
+	if !strings.Contains(body, "bytes truncated]") || !strings.HasPrefix(body, "é") {
+		t.Fatalf("unexpected body: %q", body[:10])
+	}
+	if got := out[0]["items"].([]bigquery.Value); len(got) != maxArrayItems || got[maxArrayItems-1] != int64(maxArrayItems-1) {
+		t.Fatalf("expected the first %d items without a marker, got %v", maxArrayItems, got)
+	}
+	want := "addr.city,body,items"
+	if got := strings.Join(meta.TruncatedFields, ","); got != want {
+		t.Fatalf("unexpected truncated fields: %s", got)
+	}
+	if !meta.Truncated || meta.Hint == "" {
+		t.Fatalf("expected truncation hint: %#v", meta)
+	}
+}
+
+func TestTruncateRowsNestingMatchesRowSchema(t *testing.T) {
+	// a: ARRAY<STRUCT<b: STRUCT<c: ARRAY<STRUCT<d: STRUCT<e: INT64>>>>>>
+	schema := bigquery.Schema{{Name: "a", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+		{Name: "b", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+			{Name: "c", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "d", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+					{Name: "e", Type: bigquery.IntegerFieldType},
+				}},
+			}},
+		}},
+	}}}
+	d := map[string]bigquery.Value{"e": int64(1)}
+	rows := []map[string]bigquery.Value{{"a": []bigquery.Value{
+		map[string]bigquery.Value{"b": map[string]bigquery.Value{"c": []bigquery.Value{map[string]bigquery.Value{"d": d}}}},
+	}}}
+	out, meta := truncateRows(rows, 0, 100, 0)
+	c := out[0]["a"].([]bigquery.Value)[0].(map[string]bigquery.Value)["b"].(map[string]bigquery.Value)["c"].([]bigquery.Value)
+	if got := c[0].(map[string]bigquery.Value)["d"]; got != nil {
+		t.Fatalf("expected the deepest record to be omitted, got %v", got)
+	}
+	if len(meta.TruncatedFields) != 1 || meta.TruncatedFields[0] != "a[].b.c[].d" {
+		t.Fatalf("unexpected truncated fields: %v", meta.TruncatedFields)
+	}
+	items := rowJSONSchema(schema)["properties"].(map[string]any)["a"].(map[string]any)["items"].(map[string]any)
+	b := items["properties"].(map[string]any)["b"].(map[string]any)
+	cItems := b["properties"].(map[string]any)["c"].(map[string]any)["items"].(map[string]any)
+	dSchema := cItems["properties"].(map[string]any)["d"].(map[string]any)
+	if types, ok := dSchema["type"].([]string); !ok || types[1] != "null" || dSchema["properties"] != nil {
+		t.Fatalf("row_schema of the omitted record = %v, want a nullable object", dSchema)
+	}
+}
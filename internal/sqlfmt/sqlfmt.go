@@ -0,0 +1,512 @@
+// Package sqlfmt formats GoogleSQL queries and scripts for human review.
+// Clauses start on their own lines with their contents indented, subqueries
+// and script blocks are nested, keywords are upper-cased and everything else,
+// including comments, literals and quoted identifiers, is kept verbatim.
+package sqlfmt
+
+import (
+	"strings"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqltoken"
+)
+
+type frameKind int
+
+const (
+	// blockFrame holds a list of statements: the whole script or the body
+	// of BEGIN, IF, LOOP and similar statements.
+	blockFrame frameKind = iota
+	// queryFrame is a statement or a parenthesized subquery.
+	queryFrame
+	// parenFrame is any other parenthesized expression, printed inline.
+	parenFrame
+	caseFrame
+)
+
+type frame struct {
+	kind frameKind
+	// base is the indentation of the frame's clauses or statements.
+	base int
+	// closeIndent is the indentation of the closing parenthesis of a
+	// subquery.
+	closeIndent int
+	subquery    bool
+	// opener is the first keyword of a statement.
+	opener string
+	clause string
+	first  bool
+}
+
+// contentIndent returns the indentation of lines continuing the frame.
+func (f *frame) contentIndent() int {
+	if f.kind == queryFrame && f.clause != "" {
+		return f.base + 1
+	}
+	return f.base
+}
+
+// clauses start a new line within a statement or subquery and indent their
+// contents. LIMIT and set operations keep their operands on the same line.
+var clauses = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "HAVING": true,
+	"QUALIFY": true, "WINDOW": true, "ORDER": true, "VALUES": true,
+}
+
+// conditionClauses break AND and OR onto separate lines.
+var conditionClauses = map[string]bool{"WHERE": true, "HAVING": true, "QUALIFY": true, "FROM": true}
+
+// callKeywords are keywords written directly before their parenthesis.
+var callKeywords = map[string]bool{
+	"CAST": true, "EXTRACT": true, "IF": true, "ARRAY": true, "STRUCT": true, "UNNEST": true,
+	"LEFT": true, "RIGHT": true, "REPLACE": true, "GROUPING": true, "RANGE": true, "HASH": true,
+	"OFFSET": true,
+}
+
+type printer struct {
+	out    strings.Builder
+	line   strings.Builder
+	indent int
+	frames []*frame
+	prev   sqltoken.Token
+
+	breakNext   bool
+	breakIndent int
+	blank       bool // a blank line precedes the next line
+	between     bool // the next AND belongs to BETWEEN
+	unary       bool // the previous token was a unary sign
+	angles      int  // depth of ARRAY<...> and STRUCT<...> type parameters
+	spaceParen  bool // a table name whose column list follows
+}
+
+// Format returns sql formatted for reading. Formatting only changes
+// whitespace and the case of keywords, so the result is equivalent to the
+// input. Input that does not parse as GoogleSQL is still formatted on a best
+// effort basis.
+func Format(sql string) string {
+	toks := sqltoken.Tokenize(sql)
+	var sig []int // indexes of significant tokens
+	for i, t := range toks {
+		if t.Kind != sqltoken.Whitespace && t.Kind != sqltoken.Comment {
+			sig = append(sig, i)
+		}
+	}
+	p := &printer{frames: []*frame{{kind: blockFrame}}}
+	newline := true // whether a line break precedes the current token
+	s, skipTo := 0, -1
+	for i, t := range toks {
+		switch {
+		case t.Kind == sqltoken.Whitespace:
+			newline = newline || strings.Contains(t.Text, "\n")
+			continue
+		case t.Kind == sqltoken.Comment:
+			p.comment(t, newline)
+			newline = false
+			continue
+		case i <= skipTo:
+			continue
+		}
+		newline = false
+		next := func(k int) sqltoken.Token {
+			if s+k < len(sig) {
+				return toks[sig[s+k]]
+			}
+			return sqltoken.Token{}
+		}
+		skip := p.token(t, next)
+		if skip > 0 {
+			skipTo = sig[s+skip]
+		}
+		s += 1 + skip
+	}
+	p.flush()
+	return strings.TrimRight(p.out.String(), "\n")
+}
+
+func keyword(t sqltoken.Token) sqltoken.Token {
+	if t.Kind == sqltoken.Keyword {
+		t.Text = strings.ToUpper(t.Text)
+	}
+	return t
+}
+
+func (p *printer) top() *frame {
+	return p.frames[len(p.frames)-1]
+}
+
+func (p *printer) push(f *frame) {
+	p.frames = append(p.frames, f)
+}
+
+func (p *printer) pop() *frame {
+	f := p.top()
+	if len(p.frames) > 1 {
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+	return f
+}
+
+func (p *printer) flush() {
+	if p.line.Len() == 0 {
+		return
+	}
+	p.out.WriteString(strings.Repeat("  ", p.indent))
+	p.out.WriteString(strings.TrimRight(p.line.String(), " "))
+	p.out.WriteByte('\n')
+	p.line.Reset()
+	if p.blank {
+		p.out.WriteByte('\n')
+		p.blank = false
+	}
+}
+
+// newline ends the current line; the next token starts at indent.
+func (p *printer) newline(indent int) {
+	p.flush()
+	p.breakNext = false
+	p.indent = indent
+}
+
+// breakAfter starts a new line at indent before the next token.
+func (p *printer) breakAfter(indent int) {
+	p.breakNext = true
+	p.breakIndent = indent
+}
+
+func (p *printer) write(t sqltoken.Token, space bool) {
+	if p.breakNext {
+		p.newline(p.breakIndent)
+	}
+	if space && p.line.Len() > 0 {
+		p.line.WriteByte(' ')
+	}
+	p.line.WriteString(t.Text)
+	p.prev = t
+	p.unary = false
+}
+
+func (p *printer) comment(t sqltoken.Token, ownLine bool) {
+	text := strings.TrimRight(t.Text, " \t\r\n")
+	if ownLine || p.line.Len() == 0 {
+		ind := p.top().contentIndent()
+		if p.breakNext {
+			ind = p.breakIndent
+		}
+		p.newline(ind)
+		p.line.WriteString(text)
+		p.breakAfter(ind)
+		return
+	}
+	p.line.WriteString(" " + text)
+	if !strings.HasPrefix(text, "/*") && !p.breakNext {
+		p.breakAfter(p.top().contentIndent())
+	}
+}
+
+// space reports whether t is separated from the previous token.
+func (p *printer) space(t sqltoken.Token) bool {
+	prev := p.prev
+	switch {
+	case p.unary:
+		return false
+	case prev.Text == "(" || prev.Text == "[" || prev.Text == ".":
+		return false
+	case t.Text == "," || t.Text == ")" || t.Text == "]" || t.Text == "." || t.Text == ";":
+		return false
+	case p.angles > 0 && (prev.Text == "<" || t.Text == ">" || t.Text == ">>"):
+		return false
+	case t.Text == "<" && (prev.Is("ARRAY") || prev.Is("STRUCT") || prev.Is("RANGE")):
+		return false
+	case t.Text == "(":
+		if p.spaceParen {
+			return true
+		}
+		switch prev.Kind {
+		case sqltoken.Identifier, sqltoken.QuotedIdentifier:
+			return false
+		case sqltoken.Keyword:
+			return !callKeywords[prev.Upper()]
+		}
+		return prev.Text != ">"
+	case t.Text == "[":
+		return prev.Kind != sqltoken.Identifier && prev.Kind != sqltoken.QuotedIdentifier && prev.Text != ")" && prev.Text != "]"
+	}
+	return true
+}
+
+// isUnary reports whether a sign at the current position is unary.
+func (p *printer) isUnary(t sqltoken.Token) bool {
+	if t.Text != "-" && t.Text != "+" {
+		return false
+	}
+	prev := p.prev
+	switch {
+	case prev.Text == "":
+		return true
+	case prev.Kind == sqltoken.Operator:
+		return true
+	case prev.Kind == sqltoken.Punct:
+		return prev.Text == "(" || prev.Text == "," || prev.Text == "[" || prev.Text == ";"
+	case prev.Kind == sqltoken.Keyword:
+		return !prev.Is("NULL") && !prev.Is("TRUE") && !prev.Is("FALSE") && !prev.Is("END")
+	}
+	return false
+}
+
+// token prints one significant token. Compound keywords such as GROUP BY or
+// UNION ALL are printed at once; token returns the number of following
+// tokens it consumed.
+func (p *printer) token(t sqltoken.Token, next func(int) sqltoken.Token) int {
+	t = keyword(t)
+	kw := t.Kind == sqltoken.Keyword
+	up := t.Upper()
+	n1 := next(1)
+
+	// Script block terminators and separators.
+	if kw && p.top().kind != caseFrame {
+		switch up {
+		case "END", "ELSE", "ELSEIF", "EXCEPTION", "UNTIL":
+			if stmt := p.scriptStatement(); stmt != nil {
+				return p.blockKeyword(t, stmt, n1)
+			}
+		}
+	}
+	if p.top().kind == blockFrame {
+		b := p.top()
+		p.newline(b.base)
+		p.push(&frame{kind: queryFrame, base: b.base, opener: up, first: true})
+	}
+	f := p.top()
+	first := f.first
+	f.first = false
+
+	if p.spaceParen && t.Text != "(" && t.Text != "." && t.Kind != sqltoken.Identifier && t.Kind != sqltoken.QuotedIdentifier && !t.Is("INTO") {
+		p.spaceParen = false
+	}
+
+	switch {
+	case t.Text == "(":
+		p.write(t, p.space(t))
+		p.spaceParen = false
+		if n1.Is("SELECT") || n1.Is("WITH") {
+			p.push(&frame{kind: queryFrame, base: p.indent + 1, closeIndent: p.indent, subquery: true, first: true})
+		} else {
+			p.push(&frame{kind: parenFrame, base: p.indent + 1})
+		}
+		return 0
+	case t.Text == ")":
+		for len(p.frames) > 1 {
+			g := p.pop()
+			if g.kind == parenFrame {
+				break
+			}
+			if g.subquery {
+				p.newline(g.closeIndent)
+				break
+			}
+		}
+		p.write(t, false)
+		return 0
+	case t.Text == ";":
+		p.write(t, false)
+		for p.top().kind != blockFrame {
+			p.pop()
+		}
+		b := p.top()
+		p.breakAfter(b.base)
+		if len(p.frames) == 1 && n1.Text != "" {
+			p.blank = true
+		}
+		return 0
+	case t.Text == "," && f.kind == queryFrame:
+		p.write(t, false)
+		if f.clause != "" && f.clause != "LIMIT" {
+			p.breakAfter(f.base + 1)
+		}
+		return 0
+	case t.Text == "<" && p.angles == 0 && !p.space(t):
+		p.angles++
+		p.write(t, false)
+		return 0
+	case p.angles > 0 && (t.Text == "<" || t.Text == ">" || t.Text == ">>"):
+		p.write(t, p.space(t))
+		switch t.Text {
+		case "<":
+			p.angles++
+		case ">":
+			p.angles--
+		default:
+			p.angles -= 2
+		}
+		if p.angles < 0 {
+			p.angles = 0
+		}
+		return 0
+	}
+
+	if !kw {
+		unary := p.isUnary(t)
+		p.write(t, p.space(t))
+		p.unary = unary
+		return 0
+	}
+	switch up {
+	case "CASE":
+		p.write(t, p.space(t))
+		p.push(&frame{kind: caseFrame, base: p.indent + 1})
+		return 0
+	case "END":
+		if f.kind == caseFrame {
+			p.pop()
+		}
+		p.write(t, p.space(t))
+		return 0
+	case "BETWEEN":
+		p.between = true
+	case "TABLE", "INTO", "INSERT":
+		p.write(t, p.space(t))
+		p.spaceParen = true
+		return 0
+	}
+	if f.kind != queryFrame {
+		p.write(t, p.space(t))
+		return 0
+	}
+
+	// Script statements opening a block.
+	if first {
+		switch up {
+		case "BEGIN":
+			if n1.Is("TRANSACTION") {
+				break
+			}
+			p.write(t, false)
+			p.push(&frame{kind: blockFrame, base: f.base + 1})
+			return 0
+		case "LOOP", "REPEAT":
+			p.write(t, false)
+			p.push(&frame{kind: blockFrame, base: f.base + 1})
+			return 0
+		}
+	}
+	if up == "THEN" && (f.opener == "IF" || f.opener == "BEGIN") || up == "DO" && (f.opener == "WHILE" || f.opener == "FOR") {
+		p.write(t, true)
+		p.push(&frame{kind: blockFrame, base: f.base + 1})
+		return 0
+	}
+
+	switch {
+	case up == "WITH" && (first || p.prev.Is("AS")):
+		skip := 0
+		if n1.Is("RECURSIVE") {
+			skip = 1
+		}
+		p.clause(f, t, "WITH", next, skip)
+		return skip
+	case clauses[up] && (up != "GROUP" && up != "ORDER" || n1.Is("BY")) && !(up == "FROM" && p.prev.Is("DELETE")):
+		skip := 0
+		if up == "GROUP" || up == "ORDER" {
+			skip = 1
+		}
+		if up == "SELECT" {
+			for {
+				m := next(1 + skip)
+				if m.Is("DISTINCT") || m.Is("ALL") {
+					skip++
+					continue
+				}
+				if m.Is("AS") && (next(2+skip).Is("STRUCT") || next(2+skip).Upper() == "VALUE") {
+					skip += 2
+					continue
+				}
+				break
+			}
+		}
+		p.clause(f, t, up, next, skip)
+		return skip
+	case up == "SET" && (f.opener == "UPDATE" || f.opener == "MERGE"):
+		p.clause(f, t, up, next, 0)
+		return 0
+	case up == "LIMIT":
+		p.newline(f.base)
+		p.write(t, false)
+		f.clause = "LIMIT"
+		return 0
+	case up == "UNION" || up == "INTERSECT" || up == "EXCEPT" && n1.Text != "(":
+		p.newline(f.base)
+		p.write(t, false)
+		f.clause = ""
+		if n1.Is("ALL") || n1.Is("DISTINCT") {
+			p.words(next, 1)
+			return 1
+		}
+		return 0
+	case (up == "WHEN" || up == "USING") && f.opener == "MERGE":
+		p.newline(f.base)
+		p.write(t, false)
+		f.clause = ""
+		return 0
+	case f.clause == "FROM" && !isJoinModifier(p.prev) && (up == "JOIN" || isJoinModifier(t) && (n1.Is("JOIN") || n1.Is("OUTER"))):
+		p.newline(f.base + 1)
+		p.write(t, false)
+		return 0
+	case (up == "AND" || up == "OR") && conditionClauses[f.clause]:
+		if up == "AND" && p.between {
+			p.between = false
+			break
+		}
+		p.newline(f.base + 1)
+		p.write(t, false)
+		return 0
+	}
+	p.write(t, p.space(t))
+	return 0
+}
+
+func isJoinModifier(t sqltoken.Token) bool {
+	return t.Is("LEFT") || t.Is("RIGHT") || t.Is("FULL") || t.Is("INNER") || t.Is("CROSS") || t.Is("OUTER")
+}
+
+// clause starts clause name of f with keyword t followed by the first n
+// tokens of more.
+func (p *printer) clause(f *frame, t sqltoken.Token, name string, next func(int) sqltoken.Token, n int) {
+	p.newline(f.base)
+	p.write(t, false)
+	p.words(next, n)
+	p.spaceParen = false
+	f.clause = name
+	p.breakAfter(f.base + 1)
+}
+
+// words prints the n tokens following the current one.
+func (p *printer) words(next func(int) sqltoken.Token, n int) {
+	for k := 1; k <= n; k++ {
+		p.write(keyword(next(k)), true)
+	}
+}
+
+// scriptStatement returns the statement owning the innermost script block
+// when the current statement has ended, or nil outside script blocks.
+func (p *printer) scriptStatement() *frame {
+	if p.top().kind != blockFrame || len(p.frames) < 3 {
+		return nil
+	}
+	return p.frames[len(p.frames)-2]
+}
+
+// blockKeyword prints a keyword ending or continuing the script block of
+// stmt.
+func (p *printer) blockKeyword(t sqltoken.Token, stmt *frame, n1 sqltoken.Token) int {
+	p.pop()
+	p.newline(stmt.base)
+	p.write(t, false)
+	switch t.Upper() {
+	case "END":
+		if n1.Is("IF") || n1.Is("LOOP") || n1.Is("WHILE") || n1.Is("FOR") || n1.Is("REPEAT") {
+			p.write(keyword(n1), true)
+			return 1
+		}
+	case "ELSE":
+		p.push(&frame{kind: blockFrame, base: stmt.base + 1})
+	}
+	return 0
+}
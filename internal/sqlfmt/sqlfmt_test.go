@@ -0,0 +1,81 @@
+package sqlfmt
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/masudahiroto/bigquery-mcp-server/internal/sqltoken"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestFormatGolden formats testdata/*.sql and compares the result with the
+// matching .golden file. Run with -update to regenerate the golden files.
+func TestFormatGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.sql")
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no test inputs: %v", err)
+	}
+	for _, in := range inputs {
+		t.Run(filepath.Base(in), func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Format(string(src)) + "\n"
+			golden := strings.TrimSuffix(in, ".sql") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Fatalf("Format mismatch for %s:\n--- got\n%s--- want\n%s", in, got, want)
+			}
+			if again := Format(got) + "\n"; again != got {
+				t.Fatalf("Format is not idempotent for %s:\n%s", in, again)
+			}
+		})
+	}
+}
+
+// TestFormatPreservesTokens checks that formatting only changes whitespace
+// and keyword case.
+func TestFormatPreservesTokens(t *testing.T) {
+	inputs, _ := filepath.Glob("testdata/*.sql")
+	for _, in := range inputs {
+		src, _ := os.ReadFile(in)
+		before := sqltoken.Tokenize(string(src))
+		after := sqltoken.Tokenize(Format(string(src)))
+		var a, b []string
+		for _, tok := range before {
+			if tok.Kind != sqltoken.Whitespace {
+				a = append(a, strings.ToUpper(strings.TrimSpace(tok.Text)))
+			}
+		}
+		for _, tok := range after {
+			if tok.Kind != sqltoken.Whitespace {
+				b = append(b, strings.ToUpper(strings.TrimSpace(tok.Text)))
+			}
+		}
+		if strings.Join(a, "\x00") != strings.Join(b, "\x00") {
+			t.Errorf("%s: tokens changed:\n%v\n%v", in, a, b)
+		}
+	}
+}
+
+func TestFormatMalformed(t *testing.T) {
+	for _, in := range []string{"", "SELECT (", "))) END END IF;", "SELECT 'unterminated", "BEGIN SELECT 1", "-- only a comment"} {
+		_ = Format(in)
+	}
+	if got := Format("  select 1 -- one\n"); got != "SELECT\n  1 -- one" {
+		t.Fatalf("unexpected format: %q", got)
+	}
+}
@@ -0,0 +1,9 @@
+-- daily active users
+# legacy style comment
+SELECT user_id, /* inline */ COUNT(*) AS n -- per user
+FROM ds.events
+/* only recent
+   events */
+WHERE ts > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 1 DAY)
+GROUP BY user_id;
+SELECT r'\d+' AS re, b"bytes" AS b, """triple "quoted" string""" AS t, `select` FROM `p.d.t`;
@@ -0,0 +1 @@
+WITH recursive base AS (SELECT id, parent FROM ds.tree WHERE parent IS NULL), agg as (select b.id, array_agg(struct(c.id as cid, c.name) order by c.name limit 5) as kids from base b cross join unnest(b.children) c group by b.id) select * except (kids), (select count(*) from agg) as total, case when id > 10 then 'big' else 'small' end as size from agg where id in (select id from ds.allowed union all select id from ds.extra) qualify row_number() over (partition by id order by id) = 1
@@ -0,0 +1 @@
+insert into ds.t (a, b) values (1, 'x'), (2, 'y'); update ds.t set a = a + 1, b = upper(b) where a < 5; delete from ds.t where true; merge ds.t t using ds.s s on t.a = s.a when matched then update set b = s.b when not matched then insert (a, b) values (s.a, s.b); create or replace table ds.n (a int64, b struct<x string, y array<int64>>) partition by date(ts) options(description = 'n') as select 1 as a
@@ -0,0 +1 @@
+declare n int64 default 0; declare ids array<int64>; set n = (select count(*) from ds.t); if n > 10 then select 'many'; elseif n > 0 then select 'some'; else begin select 'none'; exception when error then select @@error.message; end; end if; while n > 0 do set n = n - 1; end while; loop break; end loop; for r in (select id from ds.t) do select r.id; end for; begin transaction; commit transaction;
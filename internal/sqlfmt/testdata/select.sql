@@ -0,0 +1 @@
+select distinct a.id, count(*) as n, sum(-a.amount) total, cast(a.ts as date) d, a.items[offset(0)] first from `my-proj.ds.orders` a left outer join ds.users u on a.user_id = u.id and u.active where a.ts between '2024-01-01' and '2024-02-01' and (a.status = 'done' or a.status is null) group by 1, 2, 3, 4, 5 having count(*) > 1 order by n desc limit 10 offset 5
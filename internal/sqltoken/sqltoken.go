@@ -0,0 +1,248 @@
+// Package sqltoken splits GoogleSQL text into tokens. It understands
+// comments, string and bytes literals (including raw and triple-quoted
+// forms), backtick-quoted identifiers and query parameters, which is enough
+// for linting and formatting without a full parser.
+package sqltoken
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind classifies a token.
+type Kind int
+
+const (
+	Whitespace Kind = iota
+	Comment
+	Keyword
+	Identifier
+	QuotedIdentifier
+	String
+	Number
+	Parameter
+	Punct
+	Operator
+)
+
+// Token is a lexical token. Text is the exact source text, so concatenating
+// the tokens of Tokenize reproduces the input.
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+// Upper returns the upper-cased text of keywords and identifiers, used for
+// case-insensitive comparisons.
+func (t Token) Upper() string {
+	return strings.ToUpper(t.Text)
+}
+
+// Is reports whether t is the keyword kw, compared case-insensitively.
+func (t Token) Is(kw string) bool {
+	return t.Kind == Keyword && strings.EqualFold(t.Text, kw)
+}
+
+// Tokenize splits sql into tokens. Unterminated literals and comments extend
+// to the end of the input.
+func Tokenize(sql string) []Token {
+	var toks []Token
+	afterDot := false
+	for i := 0; i < len(sql); {
+		n, kind := scan(sql[i:])
+		text := sql[i : i+n]
+		// Names following a dot are path components, never keywords.
+		if kind == Identifier && !afterDot && keywords[strings.ToUpper(text)] {
+			kind = Keyword
+		}
+		if kind != Whitespace && kind != Comment {
+			afterDot = text == "."
+		}
+		toks = append(toks, Token{Kind: kind, Text: text})
+		i += n
+	}
+	return toks
+}
+
+// Significant returns toks without whitespace and comments.
+func Significant(toks []Token) []Token {
+	out := make([]Token, 0, len(toks))
+	for _, t := range toks {
+		if t.Kind != Whitespace && t.Kind != Comment {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// scan returns the length and kind of the token at the start of s.
+func scan(s string) (int, Kind) {
+	c := s[0]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+		n := 1
+		for n < len(s) && strings.IndexByte(" \t\n\r\f", s[n]) >= 0 {
+			n++
+		}
+		return n, Whitespace
+	case c == '#' || strings.HasPrefix(s, "--"):
+		n := strings.IndexByte(s, '\n')
+		if n < 0 {
+			n = len(s)
+		}
+		return n, Comment
+	case strings.HasPrefix(s, "/*"):
+		n := strings.Index(s[2:], "*/")
+		if n < 0 {
+			return len(s), Comment
+		}
+		return n + 4, Comment
+	case c == '`':
+		return quoted(s, 1, "`"), QuotedIdentifier
+	case c == '\'' || c == '"':
+		return stringLiteral(s, 0), String
+	case isLiteralPrefix(s):
+		return stringLiteral(s, prefixLen(s)), String
+	case c >= '0' && c <= '9' || c == '.' && len(s) > 1 && s[1] >= '0' && s[1] <= '9':
+		return number(s), Number
+	case c == '@':
+		n := 1
+		if n < len(s) && s[n] == '@' {
+			n++
+		}
+		for n < len(s) && isIdentByte(s[n]) {
+			n++
+		}
+		return n, Parameter
+	case c == '?':
+		return 1, Parameter
+	case isIdentStart(s):
+		n := 0
+		for n < len(s) {
+			r, size := utf8.DecodeRuneInString(s[n:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			n += size
+		}
+		// Unquoted dashed project names such as my-project.dataset.
+		for n+1 < len(s) && s[n] == '-' && isIdentByte(s[n+1]) {
+			n++
+			for n < len(s) && isIdentByte(s[n]) {
+				n++
+			}
+		}
+		return n, Identifier
+	case strings.ContainsRune("(),;.[]{}", rune(c)):
+		return 1, Punct
+	}
+	for _, op := range []string{"<=>", "<>", "!=", "<=", ">=", "<<", ">>", "||", "=>", "->"} {
+		if strings.HasPrefix(s, op) {
+			return len(op), Operator
+		}
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return size, Operator
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// prefixLen returns the length of a string literal prefix (r, b, rb, br in
+// any case), or zero.
+func prefixLen(s string) int {
+	n := 0
+	for n < len(s) && n < 2 && strings.IndexByte("rRbB", s[n]) >= 0 {
+		n++
+	}
+	if n < len(s) && (s[n] == '\'' || s[n] == '"') {
+		return n
+	}
+	return 0
+}
+
+func isLiteralPrefix(s string) bool {
+	return prefixLen(s) > 0
+}
+
+// stringLiteral returns the length of the string literal whose opening
+// quote is at s[p].
+func stringLiteral(s string, p int) int {
+	q := s[p : p+1]
+	if strings.HasPrefix(s[p:], q+q+q) {
+		return quoted(s, p+3, q+q+q)
+	}
+	return quoted(s, p+1, q)
+}
+
+// quoted returns the length up to and including the closing quote, starting
+// the search at offset start. A backslash always protects the following
+// character: even raw strings cannot contain an unescaped closing quote.
+func quoted(s string, start int, closing string) int {
+	for i := start; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], closing) {
+			return i + len(closing)
+		}
+	}
+	return len(s)
+}
+
+func number(s string) int {
+	n := 0
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		n = 2
+		for n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+			n++
+		}
+		return n
+	}
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.') {
+		n++
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && s[m] >= '0' && s[m] <= '9' {
+			n = m
+			for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// keywords lists the GoogleSQL reserved keywords together with the
+// non-reserved keywords that start clauses and scripting statements.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, kw := range strings.Fields(`
+		ALL AND ANY ARRAY AS ASC ASSERT_ROWS_MODIFIED AT BETWEEN BY CASE CAST COLLATE CONTAINS
+		CREATE CROSS CUBE CURRENT DEFAULT DEFINE DESC DISTINCT ELSE END ENUM ESCAPE EXCEPT
+		EXCLUDE EXISTS EXTRACT FALSE FETCH FOLLOWING FOR FROM FULL GROUP GROUPING GROUPS HASH
+		HAVING IF IGNORE IN INNER INTERSECT INTERVAL INTO IS JOIN LATERAL LEFT LIKE LIMIT
+		LOOKUP MERGE NATURAL NEW NO NOT NULL NULLS OF ON OR ORDER OUTER OVER PARTITION
+		PRECEDING PROTO QUALIFY RANGE RECURSIVE RESPECT RIGHT ROLLUP ROWS SELECT SET SOME
+		STRUCT TABLESAMPLE THEN TO TREAT TRUE UNBOUNDED UNION UNNEST USING WHEN WHERE WINDOW
+		WITH WITHIN
+		OFFSET INSERT UPDATE DELETE VALUES REPLACE TABLE VIEW DROP ALTER TRUNCATE
+		DECLARE BEGIN LOOP WHILE DO REPEAT UNTIL BREAK LEAVE CONTINUE ITERATE RETURN CALL
+		RAISE EXCEPTION ELSEIF EXECUTE IMMEDIATE TRANSACTION COMMIT ROLLBACK PIVOT UNPIVOT
+		MATCHED TEMP TEMPORARY FUNCTION PROCEDURE CLUSTER OPTIONS`) {
+		keywords[kw] = true
+	}
+}
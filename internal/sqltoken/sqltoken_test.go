@@ -0,0 +1,56 @@
+package sqltoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	sql := "# comment\nSELECT `my-proj.ds.t`.a, r'x\\'y', b\"\"\"z\"\"\", 1.5e3 -- tail\nFROM my-proj.ds.t /* block */ WHERE a <> @p AND b >= ?"
+	var b strings.Builder
+	for _, tok := range Tokenize(sql) {
+		b.WriteString(tok.Text)
+	}
+	if b.String() != sql {
+		t.Fatalf("round trip mismatch:\n%q\n%q", b.String(), sql)
+	}
+}
+
+func TestTokenizeKinds(t *testing.T) {
+	toks := Significant(Tokenize("SELECT t.select, 'a''s' FROM my-proj.ds.t WHERE x <> @p -- c"))
+	want := []Token{
+		{Keyword, "SELECT"}, {Identifier, "t"}, {Punct, "."}, {Identifier, "select"}, {Punct, ","},
+		{String, "'a'"}, {String, "'s'"}, {Keyword, "FROM"}, {Identifier, "my-proj"}, {Punct, "."},
+		{Identifier, "ds"}, {Punct, "."}, {Identifier, "t"}, {Keyword, "WHERE"}, {Identifier, "x"},
+		{Operator, "<>"}, {Parameter, "@p"},
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("unexpected tokens: %+v", toks)
+	}
+	for i := range want {
+		if toks[i] != want[i] {
+			t.Fatalf("token %d = %+v, want %+v", i, toks[i], want[i])
+		}
+	}
+}
+
+func TestTokenizeLiteralsAndComments(t *testing.T) {
+	cases := map[string]Kind{
+		"'it\\'s'":          String,
+		`"""a "b" c"""`:     String,
+		"rb'\\d'":           String,
+		"`a.b`":             QuotedIdentifier,
+		"/* x */":           Comment,
+		"-- x":              Comment,
+		"0x1F":              Number,
+		"@@dataset_id":      Parameter,
+		"/* unterminated":   Comment,
+		"'unterminated str": String,
+	}
+	for in, kind := range cases {
+		toks := Tokenize(in)
+		if len(toks) != 1 || toks[0].Kind != kind {
+			t.Errorf("Tokenize(%q) = %+v, want one token of kind %d", in, toks, kind)
+		}
+	}
+}
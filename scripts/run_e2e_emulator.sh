@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# Run the E2E tests against a local bigquery-emulator container instead of
+# BigQuery. Requires docker; no Google credentials are needed.
+PORT="${BQ_EMULATOR_PORT:-9050}"
+IMAGE="${BQ_EMULATOR_IMAGE:-ghcr.io/goccy/bigquery-emulator:latest}"
+ROOT="$(cd "$(dirname "$0")/.." && pwd)"
+
+container=$(docker run -d --rm -p "${PORT}:9050" \
+  -v "${ROOT}/e2e/testdata:/data:ro" \
+  "${IMAGE}" --project=test --data-from-yaml=/data/emulator.yaml)
+trap 'docker stop "${container}" >/dev/null' EXIT
+
+# Wait for the emulator to accept requests.
+for _ in $(seq 1 30); do
+  if curl -sf "http://localhost:${PORT}/bigquery/v2/projects/test/datasets" >/dev/null; then
+    break
+  fi
+  sleep 1
+done
+
+BQ_EMULATOR_ENDPOINT="http://localhost:${PORT}" BQ_REGION=US \
+  go test -tags=e2e ./e2e -run TestBigQueryServer_Emulator -v